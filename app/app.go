@@ -1,14 +1,37 @@
 package app
 
 import (
-	"database/sql"
-
 	"github.com/go-chi/oauth"
 	"github.com/mbolis/quick-survey/config"
+	"github.com/mbolis/quick-survey/events"
+	"github.com/mbolis/quick-survey/notify"
+	"github.com/mbolis/quick-survey/privacy"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/webhooks"
 )
 
 type App struct {
-	*sql.DB
+	Surveys     store.SurveyStore
+	Submissions store.SubmissionStore
+	Invites     store.InviteStore
+	Users       store.UserStore
+	// Tenants, owning surveys and members
+	Workspaces store.WorkspaceStore
+	// Survey ownership and the access granted to users and groups
+	Shares store.ShareStore
+	Groups store.GroupStore
+	// Live presentations
+	Presentations store.PresentationStore
+	// Webhook registrations and their delivery queue
+	Webhooks store.WebhookStore
+	// Email subscriptions and their outgoing queue
+	Notifications store.NotificationStore
+	Anonymizer    *privacy.Anonymizer
+	Events        *events.Hub
+	// Delivers events to webhooks
+	Dispatcher *webhooks.Dispatcher
+	// Emails subscribers about submissions
+	Notifier *notify.Notifier
 	*oauth.BearerServer
 	config.Config
 }
@@ -0,0 +1,148 @@
+// Package auth maps user roles to the permissions they grant.
+//
+// Users have a role in each workspace they are a member of, granting permissions on its surveys and members,
+// and a role on the whole deployment, granting permissions on user accounts and workspaces.
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/oauth"
+)
+
+// Roles, from the most to the least powerful
+const (
+	// Everything, including managing other owners
+	RoleOwner = "owner"
+	// Everything but managing owners
+	RoleAdmin = "admin"
+	// Designs surveys and reads their results
+	RoleEditor = "editor"
+	// Reads survey results
+	RoleAnalyst = "analyst"
+	// Only sees surveys
+	RoleViewer = "viewer"
+)
+
+// Roles in order, from the most to the least powerful
+var Roles = []string{RoleOwner, RoleAdmin, RoleEditor, RoleAnalyst, RoleViewer}
+
+type Permission string
+
+const (
+	// See surveys and their history
+	SurveyRead Permission = "survey:read"
+	// Create, edit, publish, present and delete surveys
+	SurveyWrite Permission = "survey:write"
+	// See submissions, export them and compute statistics
+	SubmissionsRead Permission = "submissions:read"
+	// Register webhooks and inspect their deliveries
+	WebhooksManage Permission = "webhooks:manage"
+	// Access every survey, whoever owns it
+	SurveyAll Permission = "survey:all"
+	// Add members to the workspace, change their role and group them
+	MembersManage Permission = "members:manage"
+
+	// Create and edit user accounts; granted by the deployment role
+	UsersManage Permission = "users:manage"
+	// Create workspaces and add members to any of them; granted by the deployment role
+	WorkspacesManage Permission = "workspaces:manage"
+)
+
+var permissions = map[string][]Permission{
+	RoleOwner:   {SurveyRead, SurveyWrite, SubmissionsRead, WebhooksManage, SurveyAll, MembersManage, UsersManage, WorkspacesManage},
+	RoleAdmin:   {SurveyRead, SurveyWrite, SubmissionsRead, WebhooksManage, SurveyAll, MembersManage, UsersManage, WorkspacesManage},
+	RoleEditor:  {SurveyRead, SurveyWrite, SubmissionsRead},
+	RoleAnalyst: {SurveyRead, SubmissionsRead},
+	RoleViewer:  {SurveyRead},
+}
+
+// Tells whether the given name is a known role
+func IsRole(role string) bool {
+	_, ok := permissions[role]
+	return ok
+}
+
+// Lists the permissions granted by a role
+func Permissions(role string) []Permission {
+	return permissions[role]
+}
+
+// Tells whether the comma-separated roles include the given one
+func HasRole(roles string, role string) bool {
+	for _, r := range strings.Split(roles, ",") {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Tells whether any of the comma-separated roles grants the permission
+func Can(roles string, p Permission) bool {
+	for _, role := range strings.Split(roles, ",") {
+		for _, granted := range permissions[role] {
+			if granted == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Token claims
+const (
+	// Role in the active workspace
+	ClaimRoles = "roles"
+	// ID of the active workspace
+	ClaimWorkspace = "workspace"
+	// Role on the whole deployment
+	ClaimUserRole = "user_role"
+)
+
+// Prefix of the OAuth scope selecting the workspace to log in to
+const workspaceScope = "workspace:"
+
+// OAuth scope selecting the given workspace
+func WorkspaceScope(id int) string {
+	return workspaceScope + strconv.Itoa(id)
+}
+
+// Parses the workspace selected by an OAuth scope, 0 if none
+func ScopeWorkspace(scope string) (int, error) {
+	for _, s := range strings.Fields(scope) {
+		if id, ok := strings.CutPrefix(s, workspaceScope); ok {
+			return strconv.Atoi(id)
+		}
+	}
+	return 0, nil
+}
+
+// Name of the authenticated user making the request, if any
+func Username(r *http.Request) string {
+	credential, _ := r.Context().Value(oauth.CredentialContext).(string)
+	return credential
+}
+
+func claim(r *http.Request, name string) string {
+	claims, _ := r.Context().Value(oauth.ClaimsContext).(map[string]string)
+	return claims[name]
+}
+
+// Comma-separated roles in the active workspace claimed by the token of the request
+func ClaimedRoles(r *http.Request) string {
+	return claim(r, ClaimRoles)
+}
+
+// Active workspace claimed by the token of the request, 0 if none
+func ClaimedWorkspace(r *http.Request) int {
+	id, _ := strconv.Atoi(claim(r, ClaimWorkspace))
+	return id
+}
+
+// Deployment role claimed by the token of the request
+func ClaimedUserRole(r *http.Request) string {
+	return claim(r, ClaimUserRole)
+}
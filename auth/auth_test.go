@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/oauth"
+)
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		roles string
+		p     Permission
+		want  bool
+	}{
+		{RoleViewer, SurveyRead, true},
+		{RoleViewer, SurveyWrite, false},
+		{RoleViewer, SubmissionsRead, false},
+		{RoleAnalyst, SubmissionsRead, true},
+		{RoleAnalyst, SurveyWrite, false},
+		{RoleEditor, SurveyWrite, true},
+		{RoleEditor, SurveyAll, false},
+		{RoleEditor, WebhooksManage, false},
+		{RoleEditor, MembersManage, false},
+		{RoleAdmin, SurveyAll, true},
+		{RoleAdmin, MembersManage, true},
+		{RoleAdmin, WorkspacesManage, true},
+		{RoleOwner, UsersManage, true},
+		// any of several roles
+		{"viewer,editor", SurveyWrite, true},
+		{"viewer,analyst", SurveyWrite, false},
+		// roles are matched whole
+		{"", SurveyRead, false},
+		{"unknown", SurveyRead, false},
+		{"Admin", SurveyRead, false},
+		{"viewer, editor", SurveyWrite, false},
+	}
+	for _, tt := range tests {
+		if got := Can(tt.roles, tt.p); got != tt.want {
+			t.Errorf("Can(%q, %s) = %t, want %t", tt.roles, tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestRolesOrder(t *testing.T) {
+	// each role grants at least the permissions of the roles after it
+	for i := 1; i < len(Roles); i++ {
+		for _, p := range Permissions(Roles[i]) {
+			if !Can(Roles[i-1], p) {
+				t.Errorf("%s cannot %s, unlike %s", Roles[i-1], p, Roles[i])
+			}
+		}
+	}
+	for _, role := range Roles {
+		if !IsRole(role) {
+			t.Errorf("IsRole(%q) = false", role)
+		}
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		roles, role string
+		want        bool
+	}{
+		{"owner", RoleOwner, true},
+		{"editor,owner", RoleOwner, true},
+		{"admin", RoleOwner, false},
+		{"", RoleOwner, false},
+		{"owners", RoleOwner, false},
+	}
+	for _, tt := range tests {
+		if got := HasRole(tt.roles, tt.role); got != tt.want {
+			t.Errorf("HasRole(%q, %q) = %t, want %t", tt.roles, tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestScopeWorkspace(t *testing.T) {
+	tests := []struct {
+		scope   string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"read write", 0, false},
+		{WorkspaceScope(3), 3, false},
+		{"read workspace:12", 12, false},
+		{"workspace:abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ScopeWorkspace(tt.scope)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ScopeWorkspace(%q) = %d, %v; want %d, error %t", tt.scope, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestClaims(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if ClaimedRoles(r) != "" || ClaimedWorkspace(r) != 0 || Username(r) != "" {
+		t.Error("a request without a token claims something")
+	}
+
+	ctx := context.WithValue(r.Context(), oauth.CredentialContext, "alice")
+	ctx = context.WithValue(ctx, oauth.ClaimsContext, map[string]string{
+		ClaimRoles:     "editor",
+		ClaimWorkspace: "4",
+		ClaimUserRole:  "viewer",
+	})
+	r = r.WithContext(ctx)
+	if got := Username(r); got != "alice" {
+		t.Errorf("Username = %q, want alice", got)
+	}
+	if got := ClaimedRoles(r); got != "editor" {
+		t.Errorf("ClaimedRoles = %q, want editor", got)
+	}
+	if got := ClaimedWorkspace(r); got != 4 {
+		t.Errorf("ClaimedWorkspace = %d, want 4", got)
+	}
+	if got := ClaimedUserRole(r); got != "viewer" {
+		t.Errorf("ClaimedUserRole = %q, want viewer", got)
+	}
+}
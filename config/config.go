@@ -3,18 +3,59 @@ package config
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"net"
+	"net/mail"
+	"net/netip"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Addr        string
-	DBUrl       string
-	TokenSecret string
-	TokenTTL    time.Duration
-	Debug       bool
+	Addr           string
+	DBUrl          string
+	TokenSecret    string
+	TokenTTL       time.Duration
+	IPSecret       string
+	Debug          bool
+	TrustedProxies []netip.Prefix
+	// Base URL of the site, for links in notifications
+	PublicURL string
+	SMTP      SMTPConfig
+	// Local time of day when the daily digests are sent, since midnight
+	DigestTime time.Duration
+	// Subcommand and its arguments, left after the flags; none to run the server
+	Command []string
+}
+
+// SMTP TLS modes
+const (
+	// Plain connection
+	TLSNone = "none"
+	// Upgrade the connection if the server supports it
+	TLSStartTLS = "starttls"
+	// TLS from the start, usually on port 465
+	TLSImplicit = "tls"
+)
+
+// Settings of the SMTP server sending email notifications. Notifications are disabled without a Host
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLS      string
+}
+
+func (smtp SMTPConfig) Enabled() bool {
+	return smtp.Host != ""
+}
+
+func (smtp SMTPConfig) Addr() string {
+	return net.JoinHostPort(smtp.Host, strconv.Itoa(smtp.Port))
 }
 
 func ParseFlags() (cfg Config, err error) {
@@ -24,21 +65,101 @@ func ParseFlags() (cfg Config, err error) {
 	flag.UintVar(&port, "port", 80, "listen port number (default 80)")
 	flag.StringVar(&cfg.DBUrl, "db-url", "qsurvey.sqlite", "path to SQLite3 DB file (default qsurvey.sqlite)")
 	flag.StringVar(&cfg.TokenSecret, "token-secret", "", "secret key for token encryption and decryption")
+	flag.StringVar(&cfg.IPSecret, "ip-secret", "", "secret key for hashing respondent IPs (default same as -token-secret)")
 	var ttl uint
 	flag.UintVar(&ttl, "token-ttl", 120, "token TTL in seconds (default 120)")
 	flag.BoolVar(&cfg.Debug, "debug", false, "log at DEBUG level")
+	var trustedProxies string
+	flag.StringVar(&trustedProxies, "trusted-proxies", "", "comma-separated list of trusted reverse proxy IPs or CIDRs (default none)")
+	flag.StringVar(&cfg.PublicURL, "public-url", "", "base URL of the site, for links in notifications (default the listen address)")
+	flag.StringVar(&cfg.SMTP.Host, "smtp-host", "", "SMTP server host name for email notifications (default none, notifications disabled)")
+	flag.IntVar(&cfg.SMTP.Port, "smtp-port", 25, "SMTP server port number (default 25)")
+	flag.StringVar(&cfg.SMTP.Username, "smtp-user", "", "SMTP user name (default none, no authentication)")
+	flag.StringVar(&cfg.SMTP.Password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.SMTP.From, "smtp-from", "quick-survey@localhost", "sender address of email notifications")
+	flag.StringVar(&cfg.SMTP.TLS, "smtp-tls", TLSStartTLS, "SMTP TLS mode: none, starttls or tls (default starttls, when supported by the server)")
+	var digestTime string
+	flag.StringVar(&digestTime, "digest-time", "08:00", "local time of day when daily digests are sent (default 08:00)")
 	flag.Parse()
 
 	cfg.Addr = net.JoinHostPort(host, strconv.Itoa(int(port)))
 	cfg.TokenTTL = time.Duration(ttl) * time.Second
 
-	if cfg.TokenSecret == "" {
+	cfg.TrustedProxies, err = parsePrefixes(trustedProxies)
+	if err != nil {
+		return
+	}
+
+	cfg.DigestTime, err = parseTimeOfDay(digestTime)
+	if err != nil {
+		return
+	}
+
+	switch cfg.SMTP.TLS {
+	case TLSNone, TLSStartTLS, TLSImplicit:
+	default:
+		err = fmt.Errorf("invalid parameter -smtp-tls: %q", cfg.SMTP.TLS)
+		return
+	}
+
+	if cfg.SMTP.Enabled() {
+		if _, err = mail.ParseAddress(cfg.SMTP.From); err != nil {
+			err = fmt.Errorf("invalid parameter -smtp-from: %w", err)
+			return
+		}
+	}
+
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = cfg.Url()
+	}
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+
+	cfg.Command = flag.Args()
+
+	// only the server needs to issue tokens
+	if cfg.TokenSecret == "" && len(cfg.Command) == 0 {
 		err = errors.New("missing parameter -token-secret")
 	}
+	if cfg.IPSecret == "" {
+		cfg.IPSecret = cfg.TokenSecret
+	}
+
+	return
+}
 
+// Parses a comma-separated list of IPs or CIDRs
+func parsePrefixes(list string) (prefixes []netip.Prefix, err error) {
+	for _, s := range strings.Split(list, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+
+		var prefix netip.Prefix
+		if strings.Contains(s, "/") {
+			prefix, err = netip.ParsePrefix(s)
+		} else {
+			var addr netip.Addr
+			addr, err = netip.ParseAddr(s)
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter -trusted-proxies: %w", err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
 	return
 }
 
+// Parses a time of day as hh:mm
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid parameter -digest-time: %w", err)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
 func (cfg Config) Url() (url string) {
 	url = cfg.Addr
 	url = regexp.MustCompile(`^0.0.0.0`).ReplaceAllString(url, "localhost")
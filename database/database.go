@@ -2,6 +2,7 @@ package database
 
 import (
 	"database/sql"
+	"strings"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -9,14 +10,16 @@ import (
 )
 
 func Open(cfg config.Config) (db *sql.DB, err error) {
-	db, err = sql.Open("sqlite3", cfg.DBUrl)
-	if err != nil {
-		return
+	// the pragma only applies to the connection it runs on: have the driver run it on every connection in the pool
+	dsn := cfg.DBUrl
+	if strings.Contains(dsn, "?") {
+		dsn += "&_foreign_keys=on"
+	} else {
+		dsn += "?_foreign_keys=on"
 	}
 
-	_, err = db.Exec("PRAGMA foreign_keys = ON")
+	db, err = sql.Open("sqlite3", dsn)
 	if err != nil {
-		db.Close()
 		return
 	}
 
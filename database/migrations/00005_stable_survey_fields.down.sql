@@ -0,0 +1,2 @@
+ALTER TABLE survey_field DROP COLUMN retired_at;
+ALTER TABLE survey_field DROP COLUMN position;
@@ -0,0 +1,4 @@
+ALTER TABLE survey_field ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE survey_field ADD COLUMN retired_at DATETIME;
+
+UPDATE survey_field SET position = id;
@@ -0,0 +1,2 @@
+ALTER TABLE submission DROP COLUMN survey_version;
+DROP TABLE IF EXISTS survey_version;
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS survey_version (
+    survey_id INTEGER NOT NULL REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    `version` INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    definition TEXT NOT NULL,
+    PRIMARY KEY (survey_id, `version`)
+);
+
+ALTER TABLE submission ADD COLUMN survey_version INTEGER;
+
+-- snapshot the current definition of existing surveys
+INSERT INTO survey_version (survey_id, `version`, created_at, definition)
+SELECT
+    s.id,
+    s.version,
+    CURRENT_TIMESTAMP,
+    json_object(
+        'id', s.id,
+        'version', s.version,
+        'title', s.title,
+        'description', s.description,
+        'fields', json((
+            SELECT json_group_array(json_object(
+                'id', f.id,
+                'type', f.type,
+                'name', f.name,
+                'label', f.label,
+                'required', json(CASE WHEN f.required THEN 'true' ELSE 'false' END),
+                'options', json(NULLIF(f.options, ''))
+            ))
+            FROM (
+                SELECT * FROM survey_field
+                WHERE survey_id = s.id
+                    AND retired_at IS NULL
+                ORDER BY position, id
+            ) f
+        ))
+    )
+FROM survey s;
+
+-- past submissions can only be pinned to the current version
+UPDATE submission
+SET survey_version = (SELECT s.version FROM survey s WHERE s.id = submission.survey_id);
@@ -0,0 +1,3 @@
+ALTER TABLE survey DROP COLUMN close_at;
+ALTER TABLE survey DROP COLUMN open_at;
+ALTER TABLE survey DROP COLUMN `status`;
@@ -0,0 +1,7 @@
+ALTER TABLE survey ADD COLUMN `status` VARCHAR(20) NOT NULL DEFAULT 'draft'
+    CHECK (`status` IN ('draft', 'open', 'closed', 'archived'));
+ALTER TABLE survey ADD COLUMN open_at DATETIME;
+ALTER TABLE survey ADD COLUMN close_at DATETIME;
+
+-- existing surveys were already public
+UPDATE survey SET `status` = 'open';
@@ -0,0 +1,16 @@
+-- purge the surveys in the trash, children first, as foreign keys restrict deletion
+DELETE FROM submission_field
+WHERE submission_id IN (
+    SELECT sub.id FROM submission sub
+    INNER JOIN survey s ON (s.id = sub.survey_id)
+    WHERE s.deleted_at IS NOT NULL
+);
+DELETE FROM submission
+WHERE survey_id IN (SELECT id FROM survey WHERE deleted_at IS NOT NULL);
+DELETE FROM survey_version
+WHERE survey_id IN (SELECT id FROM survey WHERE deleted_at IS NOT NULL);
+DELETE FROM survey_field
+WHERE survey_id IN (SELECT id FROM survey WHERE deleted_at IS NOT NULL);
+DELETE FROM survey WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE survey DROP COLUMN deleted_at;
@@ -0,0 +1 @@
+ALTER TABLE survey ADD COLUMN deleted_at DATETIME;
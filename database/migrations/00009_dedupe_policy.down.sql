@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS survey_invite;
+DROP INDEX IF EXISTS submission_respondent_key;
+ALTER TABLE submission DROP COLUMN respondent_key;
+ALTER TABLE survey DROP COLUMN dedupe_policy;
@@ -0,0 +1,19 @@
+ALTER TABLE survey ADD COLUMN dedupe_policy VARCHAR(20) NOT NULL DEFAULT 'ip'
+    CHECK (dedupe_policy IN ('none', 'ip', 'cookie', 'invite', 'user'));
+
+-- identifies the respondent according to the survey dedupe policy (NULL when duplicates are allowed)
+ALTER TABLE submission ADD COLUMN respondent_key VARCHAR(255);
+
+UPDATE submission
+SET respondent_key = 'ip:' || ip
+WHERE id IN (SELECT MIN(id) FROM submission GROUP BY survey_id, ip);
+
+CREATE UNIQUE INDEX IF NOT EXISTS submission_respondent_key ON submission (survey_id, respondent_key);
+
+CREATE TABLE IF NOT EXISTS survey_invite (
+    token VARCHAR(255) PRIMARY KEY,
+    survey_id INTEGER NOT NULL REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    created_at DATETIME NOT NULL
+);
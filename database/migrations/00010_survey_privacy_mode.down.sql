@@ -0,0 +1 @@
+ALTER TABLE survey DROP COLUMN privacy_mode;
@@ -0,0 +1,2 @@
+ALTER TABLE survey ADD COLUMN privacy_mode VARCHAR(20) NOT NULL DEFAULT 'full'
+    CHECK (privacy_mode IN ('full', 'truncated', 'hashed'));
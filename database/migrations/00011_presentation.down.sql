@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS presentation_answer_respondent_key;
+DROP INDEX IF EXISTS presentation_answer_field;
+DROP TABLE IF EXISTS presentation_answer;
+DROP TABLE IF EXISTS presentation;
@@ -0,0 +1,29 @@
+-- live presentation of a survey, one question at a time
+CREATE TABLE IF NOT EXISTS presentation (
+    survey_id INTEGER PRIMARY KEY REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    field_id INTEGER NOT NULL REFERENCES survey_field(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    show_results BOOLEAN NOT NULL DEFAULT 0,
+    started_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+-- answers to the questions of live presentations, kept apart from the survey submissions
+CREATE TABLE IF NOT EXISTS presentation_answer (
+    id INTEGER PRIMARY KEY,
+    survey_id INTEGER NOT NULL REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    field_id INTEGER NOT NULL REFERENCES survey_field(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    `value` TEXT NOT NULL ON CONFLICT REPLACE DEFAULT '',
+    `time` DATETIME NOT NULL,
+    ip VARCHAR(50) NOT NULL CHECK (LENGTH(ip) > 0),
+    respondent_key VARCHAR(255)
+);
+CREATE INDEX IF NOT EXISTS presentation_answer_field ON presentation_answer (field_id);
+CREATE UNIQUE INDEX IF NOT EXISTS presentation_answer_respondent_key ON presentation_answer (field_id, respondent_key);
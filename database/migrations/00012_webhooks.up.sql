@@ -0,0 +1,45 @@
+-- endpoints notified of survey events; global when survey_id is NULL
+CREATE TABLE IF NOT EXISTS webhook (
+    id INTEGER PRIMARY KEY,
+    survey_id INTEGER REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    -- comma-separated list of event types
+    events VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL
+);
+
+-- queue of event payloads to deliver to each webhook
+CREATE TABLE IF NOT EXISTS webhook_delivery (
+    id INTEGER PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhook(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    event VARCHAR(50) NOT NULL,
+    payload TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'delivered', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_due ON webhook_delivery (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS webhook_delivery_webhook ON webhook_delivery (webhook_id, id);
+
+-- outcome of each attempt at a delivery
+CREATE TABLE IF NOT EXISTS webhook_attempt (
+    id INTEGER PRIMARY KEY,
+    delivery_id INTEGER NOT NULL REFERENCES webhook_delivery(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    attempted_at DATETIME NOT NULL,
+    status_code INTEGER,
+    error TEXT,
+    duration_ms INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_attempt_delivery ON webhook_attempt (delivery_id, id);
@@ -0,0 +1,31 @@
+-- email addresses notified of the submissions to a survey
+CREATE TABLE IF NOT EXISTS survey_subscriber (
+    survey_id INTEGER NOT NULL REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    email VARCHAR(255) NOT NULL,
+    -- an email per submission, or a daily digest
+    mode VARCHAR(20) NOT NULL DEFAULT 'instant'
+        CHECK (mode IN ('instant', 'digest')),
+    created_at DATETIME NOT NULL,
+    -- submissions up to this time were covered by a digest
+    last_digest_at DATETIME,
+    PRIMARY KEY (survey_id, email)
+);
+
+-- queue of emails to send
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id INTEGER PRIMARY KEY,
+    recipient VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    text_body TEXT NOT NULL,
+    html_body TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'sent', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error TEXT,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS email_outbox_due ON email_outbox (status, next_attempt_at);
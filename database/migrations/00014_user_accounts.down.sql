@@ -0,0 +1,2 @@
+ALTER TABLE user DROP COLUMN disabled_at;
+ALTER TABLE user DROP COLUMN created_at;
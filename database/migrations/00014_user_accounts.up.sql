@@ -0,0 +1,11 @@
+ALTER TABLE user ADD COLUMN created_at DATETIME;
+-- disabled users cannot log in
+ALTER TABLE user ADD COLUMN disabled_at DATETIME;
+
+-- the seed user of 00004 has a well-known password: disable it unless the password was changed,
+-- so that a first admin is generated on startup
+UPDATE user SET disabled_at = CURRENT_TIMESTAMP
+WHERE username = 'mbolis'
+    AND password_hash = '$2y$05$aemXe/8YSs7DLivA/rkPoeXUsQbDOXBbpRLlv5A1FzHPkXNibUj1S';
+
+DELETE FROM token WHERE username IN (SELECT username FROM user WHERE disabled_at IS NOT NULL);
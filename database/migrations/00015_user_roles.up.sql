@@ -0,0 +1,5 @@
+ALTER TABLE user ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'viewer'
+    CHECK (role IN ('owner', 'admin', 'editor', 'analyst', 'viewer'));
+
+-- users used to be all-powerful: existing ones become owners
+UPDATE user SET role = 'owner';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS survey_share;
+DROP TABLE IF EXISTS user_group_member;
+DROP TABLE IF EXISTS user_group;
+
+DROP INDEX IF EXISTS survey_owner;
+ALTER TABLE survey DROP COLUMN owner;
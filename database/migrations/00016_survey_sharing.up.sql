@@ -0,0 +1,47 @@
+-- the user who created the survey; surveys created before are left to the owners and admins
+ALTER TABLE survey ADD COLUMN owner VARCHAR(255) REFERENCES user(username)
+    ON UPDATE CASCADE
+    ON DELETE RESTRICT;
+
+CREATE INDEX IF NOT EXISTS survey_owner ON survey (owner);
+
+-- named sets of users, to share surveys with
+CREATE TABLE IF NOT EXISTS user_group (
+    name VARCHAR(255) PRIMARY KEY,
+    created_at DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_group_member (
+    group_name VARCHAR(255) NOT NULL REFERENCES user_group(name)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    username VARCHAR(255) NOT NULL REFERENCES user(username)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    PRIMARY KEY (group_name, username)
+);
+
+CREATE INDEX IF NOT EXISTS user_group_member_user ON user_group_member (username);
+
+-- access to a survey granted by its owner to either a user or a group
+CREATE TABLE IF NOT EXISTS survey_share (
+    id INTEGER PRIMARY KEY,
+    survey_id INTEGER NOT NULL REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    username VARCHAR(255) REFERENCES user(username)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    group_name VARCHAR(255) REFERENCES user_group(name)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    access VARCHAR(20) NOT NULL
+        CHECK (access IN ('view', 'edit')),
+    created_at DATETIME NOT NULL,
+    CHECK ((username IS NULL) <> (group_name IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS survey_share_user ON survey_share (survey_id, username)
+    WHERE username IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS survey_share_group ON survey_share (survey_id, group_name)
+    WHERE group_name IS NOT NULL;
@@ -0,0 +1,81 @@
+-- group names become unique across the deployment again: those used in more than one workspace
+-- are kept in the first one, and suffixed with the name of the workspace in the others
+CREATE TEMPORARY TABLE user_group_rename AS
+SELECT g.workspace_id, g.name,
+    CASE WHEN EXISTS (
+        SELECT 1 FROM user_group o
+        WHERE o.name = g.name
+            AND o.workspace_id < g.workspace_id
+    ) THEN g.name || ' (' || w.name || ')' ELSE g.name END AS new_name
+FROM user_group g
+INNER JOIN workspace w ON (w.id = g.workspace_id);
+
+CREATE TABLE IF NOT EXISTS user_group_old (
+    name VARCHAR(255) PRIMARY KEY,
+    created_at DATETIME NOT NULL
+);
+
+INSERT INTO user_group_old (name, created_at)
+SELECT r.new_name, g.created_at
+FROM user_group g
+INNER JOIN user_group_rename r ON (r.workspace_id = g.workspace_id AND r.name = g.name);
+
+CREATE TABLE IF NOT EXISTS user_group_member_old (
+    group_name VARCHAR(255) NOT NULL REFERENCES user_group_old(name)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    username VARCHAR(255) NOT NULL REFERENCES user(username)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    PRIMARY KEY (group_name, username)
+);
+
+INSERT INTO user_group_member_old (group_name, username)
+SELECT r.new_name, m.username
+FROM user_group_member m
+INNER JOIN user_group_rename r ON (r.workspace_id = m.workspace_id AND r.name = m.group_name);
+
+CREATE TABLE IF NOT EXISTS survey_share_old (
+    id INTEGER PRIMARY KEY,
+    survey_id INTEGER NOT NULL REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    username VARCHAR(255) REFERENCES user(username)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    group_name VARCHAR(255) REFERENCES user_group_old(name)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    access VARCHAR(20) NOT NULL
+        CHECK (access IN ('view', 'edit')),
+    created_at DATETIME NOT NULL,
+    CHECK ((username IS NULL) <> (group_name IS NULL))
+);
+
+INSERT INTO survey_share_old (id, survey_id, username, group_name, access, created_at)
+SELECT sh.id, sh.survey_id, sh.username, r.new_name, sh.access, sh.created_at
+FROM survey_share sh
+LEFT JOIN user_group_rename r ON (r.workspace_id = sh.workspace_id AND r.name = sh.group_name);
+
+DROP TABLE survey_share;
+DROP TABLE user_group_member;
+DROP TABLE user_group;
+DROP TABLE user_group_rename;
+ALTER TABLE user_group_old RENAME TO user_group;
+ALTER TABLE user_group_member_old RENAME TO user_group_member;
+ALTER TABLE survey_share_old RENAME TO survey_share;
+
+CREATE INDEX IF NOT EXISTS user_group_member_user ON user_group_member (username);
+CREATE UNIQUE INDEX IF NOT EXISTS survey_share_user ON survey_share (survey_id, username)
+    WHERE username IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS survey_share_group ON survey_share (survey_id, group_name)
+    WHERE group_name IS NOT NULL;
+
+DROP INDEX IF EXISTS webhook_workspace;
+ALTER TABLE webhook DROP COLUMN workspace_id;
+
+DROP INDEX IF EXISTS survey_workspace;
+ALTER TABLE survey DROP COLUMN workspace_id;
+
+DROP TABLE IF EXISTS workspace_member;
+DROP TABLE IF EXISTS workspace;
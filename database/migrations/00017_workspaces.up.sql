@@ -0,0 +1,110 @@
+-- separate tenants of the same deployment, each with its own surveys and members
+CREATE TABLE IF NOT EXISTS workspace (
+    id INTEGER PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at DATETIME NOT NULL
+);
+
+-- holds everything from before workspaces
+INSERT INTO workspace (id, name, created_at) VALUES (1, 'Default', CURRENT_TIMESTAMP);
+
+-- users of a workspace, with their role in it
+CREATE TABLE IF NOT EXISTS workspace_member (
+    workspace_id INTEGER NOT NULL REFERENCES workspace(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    username VARCHAR(255) NOT NULL REFERENCES user(username)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    role VARCHAR(20) NOT NULL
+        CHECK (role IN ('owner', 'admin', 'editor', 'analyst', 'viewer')),
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (workspace_id, username)
+);
+
+CREATE INDEX IF NOT EXISTS workspace_member_user ON workspace_member (username);
+
+-- users keep their role in the default workspace; user.role now applies to the whole deployment
+INSERT INTO workspace_member (workspace_id, username, role, created_at)
+SELECT 1, username, role, CURRENT_TIMESTAMP FROM user;
+
+ALTER TABLE survey ADD COLUMN workspace_id INTEGER REFERENCES workspace(id)
+    ON UPDATE CASCADE
+    ON DELETE RESTRICT;
+UPDATE survey SET workspace_id = 1;
+CREATE INDEX IF NOT EXISTS survey_workspace ON survey (workspace_id);
+
+-- webhooks without a survey receive the events of every survey in their workspace
+ALTER TABLE webhook ADD COLUMN workspace_id INTEGER REFERENCES workspace(id)
+    ON UPDATE CASCADE
+    ON DELETE RESTRICT;
+UPDATE webhook SET workspace_id = 1;
+CREATE INDEX IF NOT EXISTS webhook_workspace ON webhook (workspace_id);
+
+-- group names are only unique within a workspace: groups are keyed by both,
+-- and shares reference groups in the workspace of their survey
+CREATE TABLE IF NOT EXISTS user_group_new (
+    workspace_id INTEGER NOT NULL REFERENCES workspace(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    name VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (workspace_id, name)
+);
+
+INSERT INTO user_group_new (workspace_id, name, created_at)
+SELECT 1, name, created_at FROM user_group;
+
+CREATE TABLE IF NOT EXISTS user_group_member_new (
+    workspace_id INTEGER NOT NULL,
+    group_name VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL REFERENCES user(username)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    PRIMARY KEY (workspace_id, group_name, username),
+    FOREIGN KEY (workspace_id, group_name) REFERENCES user_group_new(workspace_id, name)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT
+);
+
+INSERT INTO user_group_member_new (workspace_id, group_name, username)
+SELECT 1, group_name, username FROM user_group_member;
+
+-- workspace_id is that of the survey, for user shares too
+CREATE TABLE IF NOT EXISTS survey_share_new (
+    id INTEGER PRIMARY KEY,
+    survey_id INTEGER NOT NULL REFERENCES survey(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    workspace_id INTEGER NOT NULL REFERENCES workspace(id)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    username VARCHAR(255) REFERENCES user(username)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT,
+    group_name VARCHAR(255),
+    access VARCHAR(20) NOT NULL
+        CHECK (access IN ('view', 'edit')),
+    created_at DATETIME NOT NULL,
+    CHECK ((username IS NULL) <> (group_name IS NULL)),
+    FOREIGN KEY (workspace_id, group_name) REFERENCES user_group_new(workspace_id, name)
+        ON UPDATE CASCADE
+        ON DELETE RESTRICT
+);
+
+INSERT INTO survey_share_new (id, survey_id, workspace_id, username, group_name, access, created_at)
+SELECT id, survey_id, 1, username, group_name, access, created_at FROM survey_share;
+
+-- the references to the new tables follow them as they are renamed
+DROP TABLE survey_share;
+DROP TABLE user_group_member;
+DROP TABLE user_group;
+ALTER TABLE user_group_new RENAME TO user_group;
+ALTER TABLE user_group_member_new RENAME TO user_group_member;
+ALTER TABLE survey_share_new RENAME TO survey_share;
+
+CREATE INDEX IF NOT EXISTS user_group_member_user ON user_group_member (username);
+CREATE UNIQUE INDEX IF NOT EXISTS survey_share_user ON survey_share (survey_id, username)
+    WHERE username IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS survey_share_group ON survey_share (survey_id, group_name)
+    WHERE group_name IS NOT NULL;
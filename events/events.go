@@ -0,0 +1,101 @@
+// Package events dispatches in-process notifications to subscribers by topic.
+package events
+
+import (
+	"strconv"
+	"sync"
+)
+
+// Event types
+const (
+	SubmissionCreated = "submission.created"
+	SurveyPublished   = "survey.published"
+	SurveyClosed      = "survey.closed"
+	SurveyArchived    = "survey.archived"
+
+	PresentationChanged  = "presentation.changed"
+	PresentationAnswered = "presentation.answered"
+	PresentationEnded    = "presentation.ended"
+)
+
+// Events a subscriber may fall behind by, before being dropped
+const bufferSize = 64
+
+type Event struct {
+	Type string
+	// Identifies the event within its type, if applicable
+	ID   int
+	Data any
+}
+
+// Publish-subscribe hub. Publishing never blocks: subscribers that cannot keep up are dropped,
+// their channel closed, and must subscribe again.
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[*Subscription]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: map[string]map[*Subscription]bool{}}
+}
+
+// Topic of the events about a survey
+func SurveyTopic(id int) string {
+	return "survey:" + strconv.Itoa(id)
+}
+
+// Receives the events published to a topic, until closed
+type Subscription struct {
+	hub    *Hub
+	topic  string
+	events chan Event
+}
+
+func (h *Hub) Subscribe(topic string) *Subscription {
+	s := &Subscription{hub: h, topic: topic, events: make(chan Event, bufferSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.topics[topic] == nil {
+		h.topics[topic] = map[*Subscription]bool{}
+	}
+	h.topics[topic][s] = true
+	return s
+}
+
+func (h *Hub) Publish(topic string, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.topics[topic] {
+		select {
+		case s.events <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Must be called with the lock held
+func (h *Hub) remove(s *Subscription) {
+	subs := h.topics[s.topic]
+	if !subs[s] {
+		return
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(h.topics, s.topic)
+	}
+	close(s.events)
+}
+
+// Events published to the topic; closed when the subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Ends the subscription. It is safe to call more than once
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
@@ -0,0 +1,48 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+// Writes submissions as CSV, one row per submission and one column per field
+type CSVWriter struct {
+	w      *csv.Writer
+	fields []model.SurveyField
+	row    []string
+}
+
+// Creates a CSVWriter for the given fields, and writes the header row
+func NewCSVWriter(w io.Writer, fields []model.SurveyField, header string) (*CSVWriter, error) {
+	c := &CSVWriter{
+		w:      csv.NewWriter(w),
+		fields: fields,
+		row:    make([]string, len(fixedColumns)+len(fields)),
+	}
+
+	copy(c.row, fixedColumns)
+	for i, f := range fields {
+		c.row[len(fixedColumns)+i] = Header(f, header)
+	}
+	return c, c.w.Write(c.row)
+}
+
+func (c *CSVWriter) Write(s model.Submission) error {
+	c.row[0] = strconv.Itoa(s.ID)
+	c.row[1] = s.Time.UTC().Format(time.RFC3339)
+	c.row[2] = s.IP
+	for i, f := range c.fields {
+		c.row[len(fixedColumns)+i] = Text(s.Fields[f.Name].Value)
+	}
+	return c.w.Write(c.row)
+}
+
+// Flushes any buffered rows to the underlying writer
+func (c *CSVWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
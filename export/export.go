@@ -0,0 +1,66 @@
+// Package export writes survey submissions in formats suited to spreadsheets and statistics tools.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+// Writes submissions one at a time in some file format.
+// Close completes the output, and must be called after the last submission
+type Writer interface {
+	Write(model.Submission) error
+	Close() error
+}
+
+// How column headers are named
+const (
+	HeaderName  = "name"
+	HeaderLabel = "label"
+)
+
+// Columns that precede the survey fields in every export
+var fixedColumns = []string{"id", "time", "ip"}
+
+// Separator between the values of a multi-value answer
+const multiSeparator = "; "
+
+// Header returns the column header for a field, according to the given style
+func Header(f model.SurveyField, style string) string {
+	if style == HeaderLabel && f.Label != "" {
+		return f.Label
+	}
+	return f.Name
+}
+
+// Text renders any answer value as a single flat string
+func Text(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = Text(e)
+		}
+		return strings.Join(parts, multiSeparator)
+	case map[string]any:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,148 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+// Writes submissions as a zip archive for R: data.csv holds the responses,
+// schema.json describes each column, and load.R reads the data back
+// restoring types and factor levels.
+// Close must be called to complete the archive
+type RWriter struct {
+	z      *zip.Writer
+	csv    *CSVWriter
+	survey model.Survey
+	fields []model.SurveyField
+}
+
+// Describes a data.csv column in schema.json
+type rColumn struct {
+	Name     string   `json:"name"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Required bool     `json:"required"`
+	Retired  bool     `json:"retired,omitempty"`
+	Levels   []string `json:"levels,omitempty"`
+	Labels   []string `json:"labels,omitempty"`
+}
+
+// Creates an RWriter for the given survey fields, and writes the header of data.csv
+func NewRWriter(w io.Writer, survey model.Survey, fields []model.SurveyField) (*RWriter, error) {
+	r := &RWriter{z: zip.NewWriter(w), survey: survey, fields: fields}
+
+	f, err := r.z.Create("data.csv")
+	if err != nil {
+		return nil, err
+	}
+	r.csv, err = NewCSVWriter(f, fields, HeaderName)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RWriter) Write(s model.Submission) error {
+	return r.csv.Write(s)
+}
+
+// Completes data.csv, writes the schema and loader script and finalizes the archive
+func (r *RWriter) Close() error {
+	err := r.csv.Close()
+	if err != nil {
+		return err
+	}
+
+	columns := []rColumn{
+		{Name: "id", Label: "Submission ID", Type: "integer", Required: true},
+		{Name: "time", Label: "Submission time (UTC)", Type: "datetime", Required: true},
+		{Name: "ip", Label: "Respondent IP", Type: "text", Required: true},
+	}
+	for _, f := range r.fields {
+		c := rColumn{Name: f.Name, Label: f.Label, Type: f.Type, Required: f.Required, Retired: f.Retired}
+		for _, o := range f.Options {
+			c.Levels = append(c.Levels, o.Value)
+			c.Labels = append(c.Labels, o.Label)
+		}
+		columns = append(columns, c)
+	}
+
+	f, err := r.z.Create("schema.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(map[string]any{
+		"survey":  map[string]any{"id": r.survey.ID, "title": r.survey.Title},
+		"columns": columns,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err = r.z.Create("load.R")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(f, rScript(r.survey, columns))
+	if err != nil {
+		return err
+	}
+
+	return r.z.Close()
+}
+
+// Generates an R script that needs no packages beyond base R
+func rScript(survey model.Survey, columns []rColumn) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# Loads the submissions to survey %d: %s\n", survey.ID, strings.ReplaceAll(survey.Title, "\n", " "))
+	b.WriteString("# Run from the directory holding data.csv, e.g. source(\"load.R\", chdir = TRUE)\n\n")
+
+	// columns are referred to by position, as fields may share their names with fixed columns
+	classes := make([]string, len(columns))
+	for i, c := range columns {
+		class := "character"
+		switch c.Type {
+		case "integer":
+			class = "integer"
+		case "number":
+			class = "numeric"
+		case "checkbox":
+			class = "logical"
+		}
+		classes[i] = rString(class)
+	}
+	b.WriteString("responses <- read.csv(\"data.csv\", encoding = \"UTF-8\", check.names = FALSE, na.strings = \"\",\n")
+	fmt.Fprintf(b, "  colClasses = c(%s))\n", strings.Join(classes, ", "))
+	b.WriteString("responses[[2]] <- as.POSIXct(responses[[2]], format = \"%Y-%m-%dT%H:%M:%SZ\", tz = \"UTC\")\n")
+
+	for i, c := range columns {
+		if len(c.Levels) > 0 {
+			fmt.Fprintf(b, "responses[[%d]] <- factor(responses[[%d]], levels = %s, labels = %s)\n",
+				i+1, i+1, rVector(c.Levels), rVector(c.Labels))
+		}
+	}
+	for i, c := range columns {
+		fmt.Fprintf(b, "attr(responses[[%d]], \"label\") <- %s\n", i+1, rString(c.Label))
+	}
+	return b.String()
+}
+
+func rString(s string) string {
+	return strconv.Quote(s)
+}
+
+func rVector(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = rString(v)
+	}
+	return "c(" + strings.Join(quoted, ", ") + ")"
+}
@@ -0,0 +1,155 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+func TestRString(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"plain", `"plain"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`back\slash`, `"back\\slash"`},
+		{"two\nlines", `"two\nlines"`},
+		{"città", `"città"`},
+	}
+	for _, tt := range tests {
+		if got := rString(tt.s); got != tt.want {
+			t.Errorf("rString(%q) = %s, want %s", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestRScript(t *testing.T) {
+	survey := model.Survey{ID: 7, Title: "Two\nlines"}
+	tests := []struct {
+		name    string
+		columns []rColumn
+		want    []string
+	}{
+		{
+			name:    "column classes by type",
+			columns: []rColumn{{Type: "integer"}, {Type: "datetime"}, {Type: "text"}, {Type: "number"}, {Type: "checkbox"}},
+			want: []string{
+				`colClasses = c("integer", "character", "character", "numeric", "logical"))`,
+				`responses[[2]] <- as.POSIXct(responses[[2]], format = "%Y-%m-%dT%H:%M:%SZ", tz = "UTC")`,
+			},
+		},
+		{
+			name: "factors from options",
+			columns: []rColumn{
+				{Type: "integer"}, {Type: "datetime"}, {Type: "text"},
+				{Type: "select", Levels: []string{"r", "g"}, Labels: []string{"Red", `"Green"`}},
+			},
+			want: []string{
+				`responses[[4]] <- factor(responses[[4]], levels = c("r", "g"), labels = c("Red", "\"Green\""))`,
+			},
+		},
+		{
+			name:    "labels",
+			columns: []rColumn{{Label: "Submission ID", Type: "integer"}, {Label: `The "time"`, Type: "datetime"}},
+			want: []string{
+				`attr(responses[[1]], "label") <- "Submission ID"`,
+				`attr(responses[[2]], "label") <- "The \"time\""`,
+			},
+		},
+		{
+			name:    "title on a single comment line",
+			columns: []rColumn{{Type: "integer"}},
+			want:    []string{"# Loads the submissions to survey 7: Two lines\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := rScript(survey, tt.columns)
+			for _, want := range tt.want {
+				if !strings.Contains(script, want) {
+					t.Errorf("script lacks %s\n%s", want, script)
+				}
+			}
+		})
+	}
+}
+
+func TestRWriter(t *testing.T) {
+	survey := model.Survey{ID: 3, Title: "Colors"}
+	fields := []model.SurveyField{
+		{Name: "color", Label: "Color", Type: "select", Required: true, Options: []model.FieldOption{{Value: "r", Label: "Red"}}},
+		{Name: "old", Label: "Old", Type: "text", Retired: true},
+	}
+
+	out := &bytes.Buffer{}
+	w, err := NewRWriter(out, survey, fields)
+	if err != nil {
+		t.Fatalf("NewRWriter: %v", err)
+	}
+	err = w.Write(model.Submission{
+		ID:     1,
+		Time:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*3600)),
+		IP:     "192.0.2.1",
+		Fields: map[string]model.SubmissionField{"color": {Value: "r"}},
+	})
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatalf("writing: %v", err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatalf("reading the archive: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("opening %s: %v", f.Name, err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(b)
+	}
+
+	wantData := "id,time,ip,color,old\n1,2024-05-01T10:00:00Z,192.0.2.1,r,\n"
+	if files["data.csv"] != wantData {
+		t.Errorf("data.csv = %q, want %q", files["data.csv"], wantData)
+	}
+
+	schema := struct {
+		Survey  map[string]any `json:"survey"`
+		Columns []rColumn      `json:"columns"`
+	}{}
+	if err := json.Unmarshal([]byte(files["schema.json"]), &schema); err != nil {
+		t.Fatalf("schema.json: %v", err)
+	}
+	if schema.Survey["title"] != "Colors" || schema.Survey["id"] != 3. {
+		t.Errorf("schema survey = %v", schema.Survey)
+	}
+	names := []string{}
+	for _, c := range schema.Columns {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, ",") != "id,time,ip,color,old" {
+		t.Errorf("schema columns = %v", names)
+	}
+	if c := schema.Columns[3]; !c.Required || len(c.Levels) != 1 || c.Labels[0] != "Red" {
+		t.Errorf("schema color column = %+v", c)
+	}
+	if !schema.Columns[4].Retired {
+		t.Errorf("schema old column is not retired")
+	}
+
+	if !strings.Contains(files["load.R"], `read.csv("data.csv"`) {
+		t.Errorf("load.R does not read data.csv:\n%s", files["load.R"])
+	}
+}
@@ -0,0 +1,374 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+const SAVContentType = "application/x-spss-sav"
+
+// Writes submissions as an uncompressed SPSS system file.
+// Checkbox, number and select fields become numeric variables, selects being coded
+// with value labels; any other field becomes a string variable of at most 255 bytes.
+// The number of cases is left unknown, so that rows can be streamed as they are written
+type SAVWriter struct {
+	w    *binWriter
+	vars []*savVar
+}
+
+// Value stored for missing numeric answers
+var sysmis = -math.MaxFloat64
+
+// SPSS counts time in seconds since the start of the Gregorian calendar
+var spssEpoch = time.Date(1582, 10, 14, 0, 0, 0, 0, time.UTC)
+
+type savVar struct {
+	name   string // long variable name
+	short  string // 8-byte name used in the dictionary
+	label  string
+	width  int // 0 for numeric variables, byte length for strings
+	format int32
+	codes  map[string]float64
+	labels []savValueLabel
+	value  func(model.Submission) any
+}
+
+type savValueLabel struct {
+	value float64
+	label string
+}
+
+// SPSS print formats, encoded as type<<16 | width<<8 | decimals
+func savFormat(typ, width, decimals int) int32 {
+	return int32(typ<<16 | width<<8 | decimals)
+}
+
+const (
+	savFormatA        = 1
+	savFormatF        = 5
+	savFormatDatetime = 22
+)
+
+// Number of 8-byte segments a variable takes in each case
+func (v *savVar) segments() int {
+	if v.width == 0 {
+		return 1
+	}
+	return (v.width + 7) / 8
+}
+
+// Creates a SAVWriter for the given survey, and writes the file dictionary
+func NewSAVWriter(w io.Writer, survey model.Survey, fields []model.SurveyField) (*SAVWriter, error) {
+	s := &SAVWriter{w: &binWriter{w: bufio.NewWriter(w)}}
+	names := savNames{}
+
+	s.vars = append(s.vars,
+		&savVar{
+			name: names.add("id"), width: 0, format: savFormat(savFormatF, 8, 0),
+			value: func(sub model.Submission) any { return float64(sub.ID) },
+		},
+		&savVar{
+			name: names.add("time"), width: 0, format: savFormat(savFormatDatetime, 20, 0),
+			value: func(sub model.Submission) any {
+				// too far from the epoch for time.Duration
+				return float64(sub.Time.Unix()-spssEpoch.Unix()) + float64(sub.Time.Nanosecond())/1e9
+			},
+		},
+		&savVar{
+			name: names.add("ip"), width: 64, format: savFormat(savFormatA, 64, 0),
+			value: func(sub model.Submission) any { return sub.IP },
+		},
+	)
+	for _, f := range fields {
+		s.vars = append(s.vars, newSAVVar(f, names.add(f.Name)))
+	}
+
+	shorts := savNames{}
+	for _, v := range s.vars {
+		v.short = shorts.addShort(v.name)
+	}
+
+	s.writeDictionary(survey)
+	return s, s.w.err
+}
+
+func newSAVVar(f model.SurveyField, name string) *savVar {
+	v := &savVar{name: name, label: truncate(f.Label, 255)}
+	answer := func(sub model.Submission) any { return sub.Fields[f.Name].Value }
+
+	switch f.Type {
+	case "number":
+		v.format = savFormat(savFormatF, 10, 2)
+		v.value = answer
+	case "checkbox":
+		v.format = savFormat(savFormatF, 1, 0)
+		v.labels = []savValueLabel{{0, "false"}, {1, "true"}}
+		v.value = func(sub model.Submission) any {
+			if b, ok := answer(sub).(bool); ok {
+				if b {
+					return 1.
+				}
+				return 0.
+			}
+			return nil
+		}
+	case "select":
+		v.format = savFormat(savFormatF, 8, 0)
+		v.codes = selectCodes(f.Options)
+		for _, o := range f.Options {
+			v.labels = append(v.labels, savValueLabel{v.codes[o.Value], truncate(o.Label, 120)})
+		}
+		v.value = func(sub model.Submission) any {
+			if code, ok := v.codes[Text(answer(sub))]; ok {
+				return code
+			}
+			return nil
+		}
+	default:
+		v.width = 255
+		v.format = savFormat(savFormatA, 255, 0)
+		v.value = func(sub model.Submission) any { return Text(answer(sub)) }
+	}
+	return v
+}
+
+// Codes select options by their value when all values are numbers,
+// or else by their position
+func selectCodes(options []model.FieldOption) map[string]float64 {
+	codes := map[string]float64{}
+	for _, o := range options {
+		n, err := strconv.ParseFloat(o.Value, 64)
+		if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+			codes = map[string]float64{}
+			for i, o := range options {
+				codes[o.Value] = float64(i + 1)
+			}
+			return codes
+		}
+		codes[o.Value] = n
+	}
+	return codes
+}
+
+func (s *SAVWriter) writeDictionary(survey model.Survey) {
+	w := s.w
+	segments := 0
+	for _, v := range s.vars {
+		segments += v.segments()
+	}
+
+	// file header
+	now := time.Now()
+	w.bytes("$FL2")
+	w.padded("@(#) SPSS DATA FILE quick-survey", 60)
+	w.int32(2) // layout code
+	w.int32(int32(segments))
+	w.int32(0)  // no compression
+	w.int32(0)  // no weight variable
+	w.int32(-1) // unknown number of cases
+	w.float64(100)
+	w.padded(now.Format("02 Jan 06"), 9)
+	w.padded(now.Format("15:04:05"), 8)
+	w.padded(truncate(survey.Title, 64), 64)
+	w.padded("", 3)
+
+	// variables
+	for _, v := range s.vars {
+		w.int32(2)
+		w.int32(int32(v.width))
+		if v.label != "" {
+			w.int32(1)
+		} else {
+			w.int32(0)
+		}
+		w.int32(0) // no missing values
+		w.int32(v.format)
+		w.int32(v.format)
+		w.padded(v.short, 8)
+		if v.label != "" {
+			w.int32(int32(len(v.label)))
+			w.padded(v.label, (len(v.label)+3)/4*4)
+		}
+		// long strings take one continuation record per extra segment
+		for i := 1; i < v.segments(); i++ {
+			w.int32(2)
+			w.int32(-1)
+			w.int32(0)
+			w.int32(0)
+			w.int32(0)
+			w.int32(0)
+			w.padded("", 8)
+		}
+	}
+
+	// value labels, each followed by the index of the variable they apply to
+	index := 1
+	for _, v := range s.vars {
+		if len(v.labels) > 0 {
+			w.int32(3)
+			w.int32(int32(len(v.labels)))
+			for _, l := range v.labels {
+				w.float64(l.value)
+				w.byte(byte(len(l.label)))
+				w.padded(l.label, (len(l.label)+1+7)/8*8-1)
+			}
+			w.int32(4)
+			w.int32(1)
+			w.int32(int32(index))
+		}
+		index += v.segments()
+	}
+
+	// machine integer info: version, machine code, IEEE 754, no compression, little-endian, UTF-8
+	w.extension(3, 4, 8)
+	for _, n := range []int32{1, 0, 0, -1, 1, 1, 2, 65001} {
+		w.int32(n)
+	}
+	// machine floating point info: missing value, highest and lowest
+	w.extension(4, 8, 3)
+	w.float64(sysmis)
+	w.float64(math.MaxFloat64)
+	w.float64(math.Nextafter(-math.MaxFloat64, 0))
+
+	// long variable names
+	pairs := make([]string, len(s.vars))
+	for i, v := range s.vars {
+		pairs[i] = v.short + "=" + v.name
+	}
+	longNames := strings.Join(pairs, "\t")
+	w.extension(13, 1, len(longNames))
+	w.bytes(longNames)
+
+	w.extension(20, 1, len("UTF-8"))
+	w.bytes("UTF-8")
+
+	// end of dictionary
+	w.int32(999)
+	w.int32(0)
+}
+
+func (s *SAVWriter) Write(sub model.Submission) error {
+	for _, v := range s.vars {
+		value := v.value(sub)
+		if v.width > 0 {
+			str, _ := value.(string)
+			s.w.padded(truncate(str, v.width), v.segments()*8)
+			continue
+		}
+		n, ok := value.(float64)
+		if !ok {
+			n = sysmis
+		}
+		s.w.float64(n)
+	}
+	return s.w.err
+}
+
+// Flushes any buffered cases to the underlying writer
+func (s *SAVWriter) Close() error {
+	if s.w.err != nil {
+		return s.w.err
+	}
+	return s.w.w.Flush()
+}
+
+// Assigns variable names that are valid and unique in SPSS, regardless of case
+type savNames map[string]bool
+
+var savReserved = map[string]bool{
+	"ALL": true, "AND": true, "BY": true, "EQ": true, "GE": true, "GT": true, "LE": true,
+	"LT": true, "NE": true, "NOT": true, "OR": true, "TO": true, "WITH": true,
+}
+
+func (names savNames) add(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.') {
+			return r
+		}
+		return '_'
+	}, name)
+	name = strings.TrimRight(name, "._")
+	if name == "" || !unicode.IsLetter(rune(name[0])) || savReserved[strings.ToUpper(name)] {
+		name = "v_" + name
+	}
+	return names.unique(truncate(name, 64), 64)
+}
+
+// Derives the 8-byte name from a valid long name
+func (names savNames) addShort(name string) string {
+	return names.unique(strings.ToUpper(truncate(name, 8)), 8)
+}
+
+// Appends a number to the name if it is taken, keeping it within max bytes
+func (names savNames) unique(name string, max int) string {
+	candidate := name
+	for n := 2; names[strings.ToUpper(candidate)]; n++ {
+		suffix := strconv.Itoa(n)
+		candidate = truncate(name, max-len(suffix)) + suffix
+	}
+	names[strings.ToUpper(candidate)] = true
+	return candidate
+}
+
+// Cuts s to at most n bytes, without breaking multi-byte characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// Writes little-endian binary data, remembering the first error
+type binWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (b *binWriter) bytes(s string) {
+	if b.err == nil {
+		_, b.err = b.w.WriteString(s)
+	}
+}
+
+func (b *binWriter) byte(c byte) {
+	if b.err == nil {
+		b.err = b.w.WriteByte(c)
+	}
+}
+
+// Writes s padded with spaces to n bytes
+func (b *binWriter) padded(s string, n int) {
+	b.bytes(s + strings.Repeat(" ", n-len(s)))
+}
+
+func (b *binWriter) int32(n int32) {
+	if b.err == nil {
+		b.err = binary.Write(b.w, binary.LittleEndian, n)
+	}
+}
+
+func (b *binWriter) float64(n float64) {
+	if b.err == nil {
+		b.err = binary.Write(b.w, binary.LittleEndian, n)
+	}
+}
+
+// Writes the header of an extension record made of count items of size bytes each
+func (b *binWriter) extension(subtype, size, count int) {
+	b.int32(7)
+	b.int32(int32(subtype))
+	b.int32(int32(size))
+	b.int32(int32(count))
+}
@@ -0,0 +1,264 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+func TestSAVNames(t *testing.T) {
+	long := strings.Repeat("x", 70)
+	tests := []struct {
+		name       string
+		fields     []string
+		wantLong   []string
+		wantShorts []string
+	}{
+		{
+			name:       "valid names are kept",
+			fields:     []string{"age", "first_name"},
+			wantLong:   []string{"age", "first_name"},
+			wantShorts: []string{"AGE", "FIRST_NA"},
+		},
+		{
+			name:       "invalid characters are replaced",
+			fields:     []string{"età_media", "e-mail", "città"},
+			wantLong:   []string{"et__media", "e_mail", "citt"},
+			wantShorts: []string{"ET__MEDI", "E_MAIL", "CITT"},
+		},
+		{
+			name:       "names must start with a letter",
+			fields:     []string{"1st", "_x", ""},
+			wantLong:   []string{"v_1st", "v__x", "v_"},
+			wantShorts: []string{"V_1ST", "V__X", "V_"},
+		},
+		{
+			name:       "reserved words",
+			fields:     []string{"and", "With", "to_do"},
+			wantLong:   []string{"v_and", "v_With", "to_do"},
+			wantShorts: []string{"V_AND", "V_WITH", "TO_DO"},
+		},
+		{
+			name:       "duplicates regardless of case",
+			fields:     []string{"Q", "q", "q2"},
+			wantLong:   []string{"Q", "q2", "q22"},
+			wantShorts: []string{"Q", "Q2", "Q22"},
+		},
+		{
+			name:       "long names are cut",
+			fields:     []string{long, long, "question_one", "question_two"},
+			wantLong:   []string{long[:64], long[:63] + "2", "question_one", "question_two"},
+			wantShorts: []string{"XXXXXXXX", "XXXXXXX2", "QUESTION", "QUESTIO2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, shorts := savNames{}, savNames{}
+			gotLong, gotShorts := []string{}, []string{}
+			for _, f := range tt.fields {
+				name := names.add(f)
+				gotLong = append(gotLong, name)
+				gotShorts = append(gotShorts, shorts.addShort(name))
+			}
+			if !reflect.DeepEqual(gotLong, tt.wantLong) {
+				t.Errorf("names = %q, want %q", gotLong, tt.wantLong)
+			}
+			if !reflect.DeepEqual(gotShorts, tt.wantShorts) {
+				t.Errorf("short names = %q, want %q", gotShorts, tt.wantShorts)
+			}
+		})
+	}
+}
+
+func TestSelectCodes(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   map[string]float64
+	}{
+		{"numeric values", []string{"1", "2.5", "-3"}, map[string]float64{"1": 1, "2.5": 2.5, "-3": -3}},
+		{"text values by position", []string{"yes", "no"}, map[string]float64{"yes": 1, "no": 2}},
+		{"any text value", []string{"1", "2", "maybe"}, map[string]float64{"1": 1, "2": 2, "maybe": 3}},
+		{"infinite value", []string{"1", "Inf"}, map[string]float64{"1": 1, "Inf": 2}},
+		{"no options", nil, map[string]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := []model.FieldOption{}
+			for _, v := range tt.values {
+				options = append(options, model.FieldOption{Value: v, Label: v})
+			}
+			if got := selectCodes(options); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectCodes(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"short", 10, "short"},
+		{"exact", 5, "exact"},
+		{"longer", 4, "long"},
+		// à takes two bytes, and is not split
+		{"città", 5, "citt"},
+		{"città", 6, "città"},
+		{"ààà", 1, ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+// Writes the submission with a SAVWriter and returns the bytes of its case, after the dictionary
+func savCase(t *testing.T, fields []model.SurveyField, sub model.Submission) []byte {
+	t.Helper()
+	survey := model.Survey{ID: 1, Title: "Survey"}
+
+	// the dictionary has the same length whatever the cases that follow
+	dict := &bytes.Buffer{}
+	s, err := NewSAVWriter(dict, survey, fields)
+	if err == nil {
+		err = s.Close()
+	}
+	if err != nil {
+		t.Fatalf("writing the dictionary: %v", err)
+	}
+
+	out := &bytes.Buffer{}
+	s, err = NewSAVWriter(out, survey, fields)
+	if err == nil {
+		err = s.Write(sub)
+	}
+	if err == nil {
+		err = s.Close()
+	}
+	if err != nil {
+		t.Fatalf("writing the case: %v", err)
+	}
+	return out.Bytes()[dict.Len():]
+}
+
+func savFloat(b []byte) float64 {
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+func TestSAVWriterCases(t *testing.T) {
+	options := []model.FieldOption{{Value: "a", Label: "A"}, {Value: "b", Label: "B"}}
+	tests := []struct {
+		name  string
+		field model.SurveyField
+		value any
+		// float64 for numeric variables, string for strings
+		want any
+	}{
+		{"number", model.SurveyField{Type: "number"}, 3.5, 3.5},
+		{"missing number", model.SurveyField{Type: "number"}, nil, sysmis},
+		{"checked checkbox", model.SurveyField{Type: "checkbox"}, true, 1.},
+		{"unchecked checkbox", model.SurveyField{Type: "checkbox"}, false, 0.},
+		{"missing checkbox", model.SurveyField{Type: "checkbox"}, nil, sysmis},
+		{"select coded by position", model.SurveyField{Type: "select", Options: options}, "b", 2.},
+		{"select coded by value", model.SurveyField{Type: "select", Options: []model.FieldOption{{Value: "10"}, {Value: "20"}}}, "20", 20.},
+		{"select value no longer an option", model.SurveyField{Type: "select", Options: options}, "c", sysmis},
+		{"text", model.SurveyField{Type: "text"}, "hello", "hello"},
+		{"missing text", model.SurveyField{Type: "textarea"}, nil, ""},
+		{"long text", model.SurveyField{Type: "textarea"}, strings.Repeat("é", 200), strings.Repeat("é", 127)},
+		{"multiple values", model.SurveyField{Type: "multiselect"}, []any{"a", "b"}, "a; b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.field.Name, tt.field.Label = "q", "Question"
+			sub := model.Submission{
+				ID:     42,
+				Time:   time.Date(1582, 10, 15, 0, 0, 1, 5e8, time.UTC),
+				IP:     "192.0.2.1",
+				Fields: map[string]model.SubmissionField{"q": {Name: "q", Value: tt.value}},
+			}
+			data := savCase(t, []model.SurveyField{tt.field}, sub)
+
+			if got := savFloat(data[0:8]); got != 42 {
+				t.Errorf("id = %g, want 42", got)
+			}
+			// a day and a second and a half after the SPSS epoch
+			if got := savFloat(data[8:16]); got != 86401.5 {
+				t.Errorf("time = %g, want 86401.5", got)
+			}
+			if got := string(data[16:80]); got != "192.0.2.1"+strings.Repeat(" ", 55) {
+				t.Errorf("ip = %q", got)
+			}
+
+			answer := data[80:]
+			switch want := tt.want.(type) {
+			case float64:
+				if len(answer) != 8 {
+					t.Fatalf("numeric answer takes %d bytes, want 8", len(answer))
+				}
+				if got := savFloat(answer); got != want {
+					t.Errorf("answer = %g, want %g", got, want)
+				}
+			case string:
+				if len(answer) != 256 {
+					t.Fatalf("string answer takes %d bytes, want 256", len(answer))
+				}
+				if got := strings.TrimRight(string(answer), " "); got != want {
+					t.Errorf("answer = %q, want %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSAVWriterDictionary(t *testing.T) {
+	fields := []model.SurveyField{
+		{Name: "color", Label: "Favourite color", Type: "select", Options: []model.FieldOption{{Value: "r", Label: "Red"}}},
+		{Name: "and", Label: "Agree", Type: "checkbox"},
+		{Name: "comment", Label: "Comment", Type: "text"},
+	}
+	out := &bytes.Buffer{}
+	s, err := NewSAVWriter(out, model.Survey{ID: 1, Title: "Colors"}, fields)
+	if err == nil {
+		err = s.Close()
+	}
+	if err != nil {
+		t.Fatalf("NewSAVWriter: %v", err)
+	}
+	b := out.Bytes()
+
+	if got := string(b[:4]); got != "$FL2" {
+		t.Errorf("magic = %q, want $FL2", got)
+	}
+	// id, time, 8 segments of ip, color, and, 32 segments of comment
+	if got := int32(binary.LittleEndian.Uint32(b[68:72])); got != 44 {
+		t.Errorf("case size = %d segments, want 44", got)
+	}
+	if got := int32(binary.LittleEndian.Uint32(b[80:84])); got != -1 {
+		t.Errorf("number of cases = %d, want -1 (unknown)", got)
+	}
+	for _, want := range []string{
+		"Colors",
+		"ID=id\tTIME=time\tIP=ip\tCOLOR=color\tV_AND=v_and\tCOMMENT=comment",
+		"Favourite color",
+		"\x03Red",
+		"\x05false",
+		"UTF-8",
+	} {
+		if !bytes.Contains(b, []byte(want)) {
+			t.Errorf("dictionary lacks %q", want)
+		}
+	}
+	if end := b[len(b)-8:]; !bytes.Equal(end, []byte{0xe7, 3, 0, 0, 0, 0, 0, 0}) {
+		t.Errorf("dictionary ends with % x, want the 999 termination record", end)
+	}
+}
@@ -0,0 +1,252 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+const XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Writes submissions as an Excel workbook: a sheet of responses with typed cells,
+// followed by a codebook sheet describing each field.
+// Rows are streamed into the archive as they are written; Close must be called to complete it
+type XLSXWriter struct {
+	z      *zip.Writer
+	sheet  *sheetWriter
+	fields []model.SurveyField
+}
+
+// Creates an XLSXWriter for the given fields, and writes the header row of the responses sheet
+func NewXLSXWriter(w io.Writer, fields []model.SurveyField, header string) (*XLSXWriter, error) {
+	x := &XLSXWriter{z: zip.NewWriter(w), fields: fields}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, p := range parts {
+		f, err := x.z.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.WriteString(f, p.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	x.sheet, err = newSheetWriter(x.z, "xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+
+	x.sheet.startRow()
+	for _, c := range fixedColumns {
+		x.sheet.stringCell(c)
+	}
+	for _, f := range fields {
+		x.sheet.stringCell(Header(f, header))
+	}
+	return x, x.sheet.endRow()
+}
+
+func (x *XLSXWriter) Write(s model.Submission) error {
+	x.sheet.startRow()
+	x.sheet.numberCell(float64(s.ID))
+	x.sheet.dateCell(s.Time)
+	x.sheet.stringCell(s.IP)
+	for _, f := range x.fields {
+		x.sheet.valueCell(s.Fields[f.Name].Value)
+	}
+	return x.sheet.endRow()
+}
+
+// Completes the responses sheet, writes the codebook and finalizes the archive
+func (x *XLSXWriter) Close() error {
+	err := x.sheet.close()
+	if err != nil {
+		return err
+	}
+
+	codebook, err := newSheetWriter(x.z, "xl/worksheets/sheet2.xml")
+	if err != nil {
+		return err
+	}
+	codebook.startRow()
+	for _, c := range []string{"name", "label", "type", "required", "options", "retired"} {
+		codebook.stringCell(c)
+	}
+	codebook.endRow()
+	for _, f := range x.fields {
+		codebook.startRow()
+		codebook.stringCell(f.Name)
+		codebook.stringCell(f.Label)
+		codebook.stringCell(f.Type)
+		codebook.boolCell(f.Required)
+		codebook.stringCell(optionsText(f.Options))
+		codebook.boolCell(f.Retired)
+		err = codebook.endRow()
+		if err != nil {
+			return err
+		}
+	}
+	err = codebook.close()
+	if err != nil {
+		return err
+	}
+
+	return x.z.Close()
+}
+
+// Renders select options as "value=label; ..."
+func optionsText(options []model.FieldOption) string {
+	parts := make([]string, len(options))
+	for i, o := range options {
+		parts[i] = o.Value + "=" + o.Label
+	}
+	return strings.Join(parts, multiSeparator)
+}
+
+// Writes the XML of a single worksheet, one row at a time
+type sheetWriter struct {
+	w   *bufio.Writer
+	row int
+	col int
+}
+
+func newSheetWriter(z *zip.Writer, name string) (*sheetWriter, error) {
+	f, err := z.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &sheetWriter{w: bufio.NewWriter(f)}
+	s.w.WriteString(xml.Header)
+	s.w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return s, nil
+}
+
+func (s *sheetWriter) startRow() {
+	s.row++
+	s.col = 0
+	s.w.WriteString(`<row r="` + strconv.Itoa(s.row) + `">`)
+}
+
+func (s *sheetWriter) endRow() error {
+	_, err := s.w.WriteString(`</row>`)
+	return err
+}
+
+func (s *sheetWriter) close() error {
+	s.w.WriteString(`</sheetData></worksheet>`)
+	return s.w.Flush()
+}
+
+// Opens the next cell with the given type and style attributes
+func (s *sheetWriter) cell(attrs string) {
+	s.col++
+	s.w.WriteString(`<c r="` + columnName(s.col) + strconv.Itoa(s.row) + `"` + attrs + `>`)
+}
+
+func (s *sheetWriter) valueCell(value any) {
+	switch v := value.(type) {
+	case nil:
+		s.col++
+	case bool:
+		s.boolCell(v)
+	case float64:
+		s.numberCell(v)
+	default:
+		s.stringCell(Text(v))
+	}
+}
+
+func (s *sheetWriter) stringCell(v string) {
+	s.cell(` t="inlineStr"`)
+	s.w.WriteString(`<is><t xml:space="preserve">`)
+	xml.EscapeText(s.w, []byte(v))
+	s.w.WriteString(`</t></is></c>`)
+}
+
+func (s *sheetWriter) numberCell(v float64) {
+	s.cell(``)
+	s.w.WriteString(`<v>` + strconv.FormatFloat(v, 'g', -1, 64) + `</v></c>`)
+}
+
+func (s *sheetWriter) boolCell(v bool) {
+	s.cell(` t="b"`)
+	if v {
+		s.w.WriteString(`<v>1</v></c>`)
+	} else {
+		s.w.WriteString(`<v>0</v></c>`)
+	}
+}
+
+// Excel stores dates as days since its epoch; style 1 formats them as date and time
+func (s *sheetWriter) dateCell(v time.Time) {
+	s.cell(` s="1"`)
+	days := v.UTC().Sub(excelEpoch).Hours() / 24
+	s.w.WriteString(`<v>` + strconv.FormatFloat(days, 'f', -1, 64) + `</v></c>`)
+}
+
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Converts a 1-based column index to its letter name: 1 => A, 27 => AA
+func columnName(n int) string {
+	name := ""
+	for n > 0 {
+		n--
+		name = string(rune('A'+n%26)) + name
+		n /= 26
+	}
+	return name
+}
+
+const xlsxContentTypes = xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`</Types>`
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets>` +
+	`<sheet name="Responses" sheetId="1" r:id="rId1"/>` +
+	`<sheet name="Codebook" sheetId="2" r:id="rId2"/>` +
+	`</sheets>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>` +
+	`<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+// Style 0 is the default, style 1 shows a date and time
+const xlsxStyles = xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+	`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`</styleSheet>`
@@ -1,6 +1,6 @@
 module github.com/mbolis/quick-survey
 
-go 1.18
+go 1.20
 
 require (
 	github.com/go-chi/chi/v5 v5.0.8
@@ -10,6 +10,7 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.16
 	github.com/sirupsen/logrus v1.9.2
 	golang.org/x/crypto v0.7.0
+	golang.org/x/term v0.6.0
 )
 
 require (
@@ -0,0 +1,105 @@
+package httpx
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type contextKey string
+
+const clientIPContext contextKey = "httpx.client_ip"
+
+// Resolves the address of the client that originated a request, trusting
+// the X-Forwarded-For and Forwarded headers only when set by a trusted proxy.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+func NewClientIPResolver(trustedProxies []netip.Prefix) ClientIPResolver {
+	return ClientIPResolver{trustedProxies}
+}
+
+func (res ClientIPResolver) Resolve(r *http.Request) string {
+	remote, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return r.RemoteAddr
+	}
+
+	// walk the proxy chain backwards, up to the first hop we don't trust
+	client := remote
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0 && res.isTrusted(client); i-- {
+		hop, ok := parseAddr(hops[i])
+		if !ok {
+			break
+		}
+		client = hop
+	}
+	return client.String()
+}
+
+func (res ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, p := range res.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the addresses listed in the Forwarded header or, lacking it,
+// in the X-Forwarded-For header, from the farthest to the nearest hop.
+func forwardedFor(header http.Header) (hops []string) {
+	if forwarded := header.Values("forwarded"); len(forwarded) > 0 {
+		for _, element := range strings.Split(strings.Join(forwarded, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+		return
+	}
+
+	for _, xff := range header.Values("x-forwarded-for") {
+		for _, hop := range strings.Split(xff, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return
+}
+
+// Parses an address with or without a port, e.g. 192.0.2.1, 192.0.2.1:80, 2001:db8::1 or [2001:db8::1]:80
+func parseAddr(s string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return addr, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+// Returns a copy of the request, carrying the resolved client IP.
+func WithClientIP(r *http.Request, ip string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPContext, ip))
+}
+
+// Returns the client IP of the request, as resolved by a ClientIPResolver
+// or, lacking it, as read from the connection.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContext).(string); ok {
+		return ip
+	}
+	if addr, ok := parseAddr(r.RemoteAddr); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
@@ -1,16 +1,36 @@
 package httpx
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/oauth"
+	"github.com/mbolis/quick-survey/auth"
 	"github.com/mbolis/quick-survey/config"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Hashes a password to be stored
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// Generates a random password
+func GeneratePassword() (string, error) {
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
 func NewBearerServer(db *sql.DB, cfg config.Config) *oauth.BearerServer {
 	return oauth.NewBearerServer(cfg.TokenSecret, cfg.TokenTTL, CredentialsVerifier(db), nil)
 }
@@ -26,13 +46,46 @@ func CredentialsVerifier(db *sql.DB) oauth.CredentialsVerifier {
 func (cs *credentialsVerifier) ValidateUser(username string, password string, scope string, r *http.Request) error {
 	var hash []byte
 	err := cs.db.
-		QueryRow("SELECT password_hash FROM user WHERE username=?", username).
+		QueryRow("SELECT password_hash FROM user WHERE username=? AND disabled_at IS NULL", username).
 		Scan(&hash)
 	if err != nil {
 		return err
 	}
 
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		return err
+	}
+
+	// users can only log in to the workspaces they are members of
+	_, _, err = cs.membership(username, scope)
+	if errors.Is(err, sql.ErrNoRows) && scope == "" {
+		return nil
+	}
+	return err
+}
+
+// Role of the user in the workspace selected by the scope, or else in the first they are a member of
+func (cs *credentialsVerifier) membership(username string, scope string) (workspaceId int, role string, err error) {
+	workspaceId, err = auth.ScopeWorkspace(scope)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = cs.db.
+		QueryRow(`
+			SELECT workspace_id, role
+			FROM workspace_member
+			WHERE username = ?
+				AND (? = 0 OR workspace_id = ?)
+			ORDER BY workspace_id
+			LIMIT 1`,
+			username,
+			workspaceId,
+			workspaceId,
+		).
+		Scan(&workspaceId, &role)
+	return workspaceId, role, err
 }
 func (cs *credentialsVerifier) StoreTokenID(tokenType oauth.TokenType, credential string, tokenID string, refreshTokenID string) error {
 	_, err := cs.db.Exec(
@@ -69,8 +122,30 @@ func (cs *credentialsVerifier) ValidateTokenID(tokenType oauth.TokenType, creden
 	}
 	return nil
 }
-func (*credentialsVerifier) AddClaims(tokenType oauth.TokenType, credential string, tokenID string, scope string, r *http.Request) (map[string]string, error) {
-	return map[string]string{"roles": "admin"}, nil
+
+// Claims the roles of the user, as stored when the token is issued or refreshed:
+// on the deployment, and in the workspace selected by the scope, which is kept on refresh
+func (cs *credentialsVerifier) AddClaims(tokenType oauth.TokenType, credential string, tokenID string, scope string, r *http.Request) (map[string]string, error) {
+	var userRole string
+	err := cs.db.
+		QueryRow("SELECT role FROM user WHERE username=? AND disabled_at IS NULL", credential).
+		Scan(&userRole)
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]string{auth.ClaimUserRole: userRole}
+
+	workspaceId, role, err := cs.membership(credential, scope)
+	if errors.Is(err, sql.ErrNoRows) && scope == "" {
+		// not a member of any workspace: only the deployment role applies
+		return claims, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	claims[auth.ClaimWorkspace] = strconv.Itoa(workspaceId)
+	claims[auth.ClaimRoles] = role
+	return claims, nil
 }
 func (*credentialsVerifier) AddProperties(tokenType oauth.TokenType, credential string, tokenID string, scope string, r *http.Request) (map[string]string, error) {
 	return map[string]string{}, nil
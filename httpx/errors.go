@@ -1,10 +1,12 @@
 package httpx
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/validation"
 )
 
 // Will log an error, and send an HTTP response with status 500 and default text
@@ -33,3 +35,14 @@ func LogStatusMsg(w http.ResponseWriter, status int, level log.Level, code strin
 	log.Log(level, code+":", errMsg)
 	http.Error(w, errMsg, status)
 }
+
+// Will log a debug message, and send an HTTP response with status 422
+// and the list of validation errors as JSON
+func LogInvalid(w http.ResponseWriter, code string, errs validation.Errors) {
+	log.Debugf("%s: %s", code, errs)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]any{
+		"errors": errs,
+	})
+}
@@ -1,16 +1,31 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
 	"github.com/mbolis/quick-survey/config"
 	"github.com/mbolis/quick-survey/database"
+	"github.com/mbolis/quick-survey/events"
 	"github.com/mbolis/quick-survey/httpx"
 	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/notify"
+	"github.com/mbolis/quick-survey/privacy"
 	"github.com/mbolis/quick-survey/routes"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
+	"github.com/mbolis/quick-survey/webhooks"
+	"golang.org/x/term"
 )
 
 func main() {
@@ -28,12 +43,57 @@ func main() {
 	}
 	defer db.Close()
 
+	users := store.NewUserStore(db)
+	workspaces := store.NewWorkspaceStore(db)
+	if len(cfg.Command) > 0 {
+		err = runCommand(users, workspaces, cfg.Command)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	err = ensureAdmin(users, workspaces)
+	if err != nil {
+		log.Fatal("main.ensure_admin:", err)
+	}
+
 	bearerServer := httpx.NewBearerServer(db, cfg)
 
+	webhookStore := store.NewWebhookStore(db)
+	dispatcher := webhooks.NewDispatcher(webhookStore)
+	go dispatcher.Run(context.Background())
+
+	anonymizer := privacy.NewAnonymizer(cfg.IPSecret)
+	surveyStore := store.NewSurveyStore(db, anonymizer)
+	submissionStore := store.NewSubmissionStore(db)
+	notificationStore := store.NewNotificationStore(db)
+	notifier := notify.NewNotifier(cfg, notificationStore, surveyStore, submissionStore)
+	if notifier.Enabled() {
+		go notifier.Run(context.Background())
+		go notifier.RunDigests(context.Background())
+	} else {
+		log.Info("Email notifications disabled: no -smtp-host")
+	}
+
 	app := app.App{
-		DB:           db,
-		BearerServer: bearerServer,
-		Config:       cfg,
+		Surveys:       surveyStore,
+		Submissions:   submissionStore,
+		Invites:       store.NewInviteStore(db),
+		Users:         users,
+		Workspaces:    workspaces,
+		Shares:        store.NewShareStore(db),
+		Groups:        store.NewGroupStore(db),
+		Presentations: store.NewPresentationStore(db),
+		Webhooks:      webhookStore,
+		Notifications: notificationStore,
+		Anonymizer:    anonymizer,
+		Events:        events.NewHub(),
+		Dispatcher:    dispatcher,
+		Notifier:      notifier,
+		BearerServer:  bearerServer,
+		Config:        cfg,
 	}
 
 	handler := routes.Wire(app)
@@ -56,3 +116,181 @@ func runServer(cfg config.Config, handler http.Handler) error {
 	log.Info("Listening on " + cfg.Url())
 	return srv.ListenAndServe()
 }
+
+// Name of the user generated on a fresh install
+const firstAdmin = "admin"
+
+// Generates an owner of the deployment and of the default workspace with a random password
+// when no user can log in, as on a fresh install. The password is printed once on the standard error,
+// and kept out of the logs, to be changed on first access
+func ensureAdmin(users store.UserStore, workspaces store.WorkspaceStore) error {
+	ctx := context.Background()
+	n, err := users.CountActive(ctx)
+	if err != nil || n > 0 {
+		return err
+	}
+
+	password, err := httpx.GeneratePassword()
+	if err != nil {
+		return err
+	}
+	hash, err := httpx.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = users.Create(ctx, firstAdmin, auth.RoleOwner, hash)
+	if errors.Is(err, store.ErrConflict) {
+		// left disabled: take it back
+		err = users.SetPassword(ctx, firstAdmin, hash)
+		if err == nil {
+			err = users.SetRole(ctx, firstAdmin, auth.RoleOwner)
+		}
+		if err == nil {
+			err = users.SetDisabled(ctx, firstAdmin, false)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	err = workspaces.AddMember(ctx, model.DefaultWorkspaceID, firstAdmin, auth.RoleOwner)
+	if errors.Is(err, store.ErrConflict) {
+		err = workspaces.SetMemberRole(ctx, model.DefaultWorkspaceID, firstAdmin, auth.RoleOwner)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Warnf("No active users: created user %q, with the password printed on the standard error", firstAdmin)
+	fmt.Fprintf(os.Stderr, "Password of user %q: %s\nChange it with `quick-survey user passwd %s`\n", firstAdmin, password, firstAdmin)
+	return nil
+}
+
+const usage = `usage:
+  quick-survey [flags]                                  run the server
+  quick-survey [flags] user add NAME [ROLE]             add a user to the local DB and the default workspace (viewer by default)
+  quick-survey [flags] user role NAME ROLE              change the role of a user
+  quick-survey [flags] user passwd|disable|enable NAME  manage a user on the local DB
+  quick-survey [flags] user list                        list the users on the local DB
+
+roles: owner, admin, editor, analyst, viewer`
+
+// Runs a subcommand on the local DB
+func runCommand(users store.UserStore, workspaces store.WorkspaceStore, args []string) error {
+	ctx := context.Background()
+	if args[0] != "user" || len(args) < 2 {
+		return errors.New("unknown command\n" + usage)
+	}
+
+	cmd, args := args[1], args[2:]
+	switch cmd {
+	case "list", "add", "role", "passwd", "disable", "enable":
+	default:
+		return errors.New("unknown command\n" + usage)
+	}
+
+	if cmd == "list" {
+		list, err := users.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, u := range list {
+			status := "active"
+			if u.Disabled {
+				status = "disabled"
+			}
+			fmt.Printf("%s\t%s\t%s\n", u.Username, u.Role, status)
+		}
+		return nil
+	}
+
+	if len(args) < 1 {
+		return errors.New("missing user name\n" + usage)
+	}
+	username, role := args[0], auth.RoleViewer
+	switch {
+	case cmd == "role" && len(args) != 2:
+		return errors.New("missing role\n" + usage)
+	case cmd == "add" && len(args) == 2, cmd == "role":
+		role = args[1]
+	case len(args) != 1:
+		return errors.New("too many arguments\n" + usage)
+	}
+	if errs := validation.Role(role); len(errs) > 0 {
+		return errs
+	}
+
+	var err error
+	switch cmd {
+	case "add", "passwd":
+		if errs := validation.Username(username); cmd == "add" && len(errs) > 0 {
+			return errs
+		}
+		var password, hash string
+		password, hash, err = readPassword()
+		if err != nil {
+			return err
+		}
+		if cmd == "add" {
+			err = users.Create(ctx, username, role, hash)
+			if err == nil {
+				// otherwise they could not log in to any workspace
+				err = workspaces.AddMember(ctx, model.DefaultWorkspaceID, username, role)
+			}
+		} else {
+			err = users.SetPassword(ctx, username, hash)
+		}
+		if err == nil && password != "" {
+			fmt.Printf("Generated password for %s: %s\n", username, password)
+		}
+	case "role":
+		err = users.SetRole(ctx, username, role)
+	case "disable":
+		err = users.SetDisabled(ctx, username, true)
+	case "enable":
+		err = users.SetDisabled(ctx, username, false)
+	}
+	if errors.Is(err, store.ErrConflict) {
+		return fmt.Errorf("user %s already exists", username)
+	}
+	if err != nil {
+		return fmt.Errorf("user %s: %w", username, err)
+	}
+	return nil
+}
+
+// Reads a password from the standard input, without echoing it on terminals, returning its hash.
+// If none is entered, one is generated and returned as well
+func readPassword() (generated string, hash string, err error) {
+	fmt.Fprint(os.Stderr, "Password (empty to generate one): ")
+	var line string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		var b []byte
+		b, err = term.ReadPassword(fd)
+		if err != nil {
+			return "", "", err
+		}
+		line = string(b)
+	} else {
+		line, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" && !errors.Is(err, io.EOF) {
+			return "", "", err
+		}
+	}
+	fmt.Fprintln(os.Stderr)
+
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		generated, err = httpx.GeneratePassword()
+		if err != nil {
+			return "", "", err
+		}
+		password = generated
+	} else if errs := validation.Password(password); len(errs) > 0 {
+		return "", "", errs
+	}
+
+	hash, err = httpx.HashPassword(password)
+	return generated, hash, err
+}
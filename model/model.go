@@ -1,35 +1,285 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Survey struct {
-	ID          int           `json:"id,omitempty"`
-	Version     int           `json:"version,omitempty"`
-	Title       string        `json:"title"`
-	Description string        `json:"description"`
-	Fields      []SurveyField `json:"fields"`
-	Submitted   bool          `json:"submitted,omitempty"`
+	ID           int           `json:"id,omitempty"`
+	Version      int           `json:"version,omitempty"`
+	Status       string        `json:"status,omitempty"`
+	OpenAt       *time.Time    `json:"open_at,omitempty"`
+	CloseAt      *time.Time    `json:"close_at,omitempty"`
+	DeletedAt    *time.Time    `json:"deleted_at,omitempty"`
+	DedupePolicy string        `json:"dedupe_policy,omitempty"`
+	PrivacyMode  string        `json:"privacy_mode,omitempty"`
+	Title        string        `json:"title"`
+	Description  string        `json:"description"`
+	Fields       []SurveyField `json:"fields"`
+	Submitted    bool          `json:"submitted,omitempty"`
+	// User who created the survey, or to whom it was transferred
+	Owner string `json:"owner,omitempty"`
+	// Access of the current user, when listed for them
+	Access      string `json:"access,omitempty"`
+	WorkspaceID int    `json:"-"`
+}
+
+// Survey lifecycle states
+const (
+	StatusDraft    = "draft"
+	StatusOpen     = "open"
+	StatusClosed   = "closed"
+	StatusArchived = "archived"
+)
+
+// Survey dedupe policies
+const (
+	DedupeNone   = "none"
+	DedupeIP     = "ip"
+	DedupeCookie = "cookie"
+	DedupeInvite = "invite"
+	DedupeUser   = "user"
+)
+
+// Survey privacy modes, i.e. how respondent IPs are stored
+const (
+	PrivacyFull      = "full"
+	PrivacyTruncated = "truncated"
+	PrivacyHashed    = "hashed"
+)
+
+// Builds the key identifying a respondent under the given dedupe policy
+func RespondentKey(policy string, id string) string {
+	return policy + ":" + id
+}
+
+// For each lifecycle state, the states a survey can move to it from
+var StatusTransitions = map[string][]string{
+	StatusOpen:     {StatusDraft, StatusClosed},
+	StatusClosed:   {StatusOpen},
+	StatusArchived: {StatusDraft, StatusClosed},
+}
+
+// Tells whether the survey is scheduled to open after the given time
+func (s Survey) NotYetOpen(now time.Time) bool {
+	return s.OpenAt != nil && now.Before(*s.OpenAt)
+}
+
+// Tells whether the survey was scheduled to close before the given time
+func (s Survey) PastClose(now time.Time) bool {
+	return s.CloseAt != nil && !now.Before(*s.CloseAt)
+}
+
+type SurveyVersion struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type SurveyField struct {
-	ID       int    `json:"id,omitempty"`
-	Type     string `json:"type"`
-	Name     string `json:"name"`
-	Label    string `json:"label"`
-	Required bool   `json:"required"`
-	Options  any    `json:"options"`
+	ID       int           `json:"id,omitempty"`
+	Type     string        `json:"type"`
+	Name     string        `json:"name"`
+	Label    string        `json:"label"`
+	Required bool          `json:"required"`
+	Options  []FieldOption `json:"options"`
+	Retired  bool          `json:"retired,omitempty"`
+}
+
+type FieldOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
 }
 
 type Submission struct {
-	ID     int                        `json:"id"`
-	Time   time.Time                  `json:"time"`
-	IP     string                     `json:"ip"`
-	Fields map[string]SubmissionField `json:"fields"`
+	ID            int                        `json:"id"`
+	SurveyVersion int                        `json:"survey_version,omitempty"`
+	Time          time.Time                  `json:"time"`
+	IP            string                     `json:"ip"`
+	Fields        map[string]SubmissionField `json:"fields"`
+	RespondentKey string                     `json:"-"`
 }
 
 type SubmissionField struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Label string `json:"label"`
-	Value any    `json:"value"`
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Label      string `json:"label"`
+	Value      any    `json:"value"`
+	ValueLabel string `json:"value_label,omitempty"`
+}
+
+type Invite struct {
+	Token     string    `json:"token"`
+	CreatedAt time.Time `json:"created_at"`
+	Used      bool      `json:"used"`
+}
+
+// Live presentation of a survey, showing one question at a time
+type Presentation struct {
+	SurveyID int `json:"survey_id"`
+	// Question currently shown
+	FieldID     int       `json:"field_id"`
+	ShowResults bool      `json:"show_results"`
+	StartedAt   time.Time `json:"started_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Answer to a question of a live presentation, kept apart from the survey submissions
+type PresentationAnswer struct {
+	ID       int       `json:"id"`
+	SurveyID int       `json:"survey_id"`
+	FieldID  int       `json:"field_id"`
+	Value    any       `json:"value"`
+	Time     time.Time `json:"time"`
+	IP       string    `json:"-"`
+	// Identifies the respondent, who can answer each question once; empty if anonymous
+	RespondentKey string `json:"-"`
+}
+
+// Endpoint notified of survey events
+type Webhook struct {
+	ID int `json:"id"`
+	// Survey whose events are delivered; all surveys of the workspace if nil
+	SurveyID *int   `json:"survey_id"`
+	URL      string `json:"url"`
+	// Key signing the payloads; only disclosed when the webhook is created
+	Secret      string    `json:"secret,omitempty"`
+	Events      []string  `json:"events"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	WorkspaceID int       `json:"-"`
+}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// Gave up after too many failed attempts
+	DeliveryDead = "dead"
+)
+
+// An event payload queued for delivery to a webhook
+type WebhookDelivery struct {
+	ID            int              `json:"id"`
+	WebhookID     int              `json:"webhook_id"`
+	Event         string           `json:"event"`
+	Payload       json.RawMessage  `json:"payload"`
+	Status        string           `json:"status"`
+	Attempts      int              `json:"attempts"`
+	NextAttemptAt time.Time        `json:"next_attempt_at"`
+	CreatedAt     time.Time        `json:"created_at"`
+	LastAttempt   *WebhookAttempt  `json:"last_attempt,omitempty"`
+	History       []WebhookAttempt `json:"history,omitempty"`
+	// Where and how to deliver, not exposed
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// Outcome of an attempt at delivering to a webhook
+type WebhookAttempt struct {
+	AttemptedAt time.Time `json:"attempted_at"`
+	// Response status, if a response was received
+	StatusCode *int   `json:"status_code"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Subscription modes
+const (
+	// An email per submission
+	SubscribeInstant = "instant"
+	// A daily summary of the submissions
+	SubscribeDigest = "digest"
+)
+
+// Email address notified of the submissions to a survey
+type Subscriber struct {
+	SurveyID  int       `json:"-"`
+	Email     string    `json:"email"`
+	Mode      string    `json:"mode"`
+	CreatedAt time.Time `json:"created_at"`
+	// Submissions up to this time were covered by a digest
+	LastDigestAt *time.Time `json:"last_digest_at,omitempty"`
+}
+
+// Email states
+const (
+	EmailPending = "pending"
+	EmailSent    = "sent"
+	// Gave up after too many failed attempts
+	EmailDead = "dead"
+)
+
+// A queued email, with alternative plain text and HTML bodies
+type Email struct {
+	ID       int
+	To       string
+	Subject  string
+	Text     string
+	HTML     string
+	Attempts int
+}
+
+// An account that can log in to the admin area
+type User struct {
+	Username  string     `json:"username"`
+	Role      string     `json:"role"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Disabled users cannot log in
+	Disabled   bool       `json:"disabled"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+}
+
+// Access to a survey, from the least to the most powerful
+const (
+	// See the survey and its results
+	AccessView = "view"
+	// Edit the survey as well
+	AccessEdit = "edit"
+	// Also delete, share and transfer the survey
+	AccessOwner = "owner"
+)
+
+var accessLevels = map[string]int{AccessView: 1, AccessEdit: 2, AccessOwner: 3}
+
+// Tells whether the given access includes the needed one
+func AccessIncludes(access string, need string) bool {
+	return accessLevels[access] > 0 && accessLevels[access] >= accessLevels[need]
+}
+
+// Access to a survey granted to either a user or a group
+type Share struct {
+	SurveyID  int       `json:"-"`
+	Username  string    `json:"username,omitempty"`
+	Group     string    `json:"group,omitempty"`
+	Access    string    `json:"access"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Named set of users, to share surveys with
+type Group struct {
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+	Members     []string  `json:"members"`
+	WorkspaceID int       `json:"-"`
+}
+
+// Workspace created by the migrations, holding the data from before workspaces
+const DefaultWorkspaceID = 1
+
+// Tenant of the deployment, owning surveys and members
+type Workspace struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role of the current user, when listed for them
+	Role string `json:"role,omitempty"`
+}
+
+// User of a workspace, with their role in it
+type Member struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	Disabled  bool      `json:"disabled"`
 }
@@ -0,0 +1,366 @@
+// Package notify emails survey subscribers about new submissions, one by one or in a daily digest,
+// from a persistent queue with retries.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/mbolis/quick-survey/config"
+	"github.com/mbolis/quick-survey/export"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/queue"
+	"github.com/mbolis/quick-survey/store"
+)
+
+const (
+	// Attempts before an email is given up as dead
+	MaxAttempts = 8
+	// Submissions listed in a digest; the others are only counted
+	maxDigestSubmissions = 50
+	timeFormat           = "2006-01-02 15:04 MST"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	textTemplates = template.Must(template.ParseFS(templates, "templates/*.txt"))
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/*.html"))
+)
+
+// Delays between attempts at sending an email
+var Backoff = queue.Backoff{Base: time.Minute, Max: 6 * time.Hour}
+
+// Queues notifications to survey subscribers, and sends them in the background
+type Notifier struct {
+	*queue.Worker
+	cfg           config.Config
+	notifications store.NotificationStore
+	surveys       store.SurveyStore
+	submissions   store.SubmissionStore
+}
+
+func NewNotifier(cfg config.Config, notifications store.NotificationStore, surveys store.SurveyStore, submissions store.SubmissionStore) *Notifier {
+	n := &Notifier{
+		cfg:           cfg,
+		notifications: notifications,
+		surveys:       surveys,
+		submissions:   submissions,
+	}
+	n.Worker = queue.NewWorker(n.sendDue)
+	return n
+}
+
+// Tells whether notifications are sent at all
+func (n *Notifier) Enabled() bool {
+	return n.cfg.SMTP.Enabled()
+}
+
+// A submitted field, as rendered in messages
+type renderedField struct {
+	Label string
+	Value string
+}
+
+type renderedSubmission struct {
+	ID     int
+	Time   string
+	Fields []renderedField
+}
+
+// Lists the answers in the order of the survey fields, with readable values
+func renderSubmission(fields []model.SurveyField, submission model.Submission) renderedSubmission {
+	answers := make(map[int]model.SubmissionField, len(submission.Fields))
+	for _, f := range submission.Fields {
+		answers[f.ID] = f
+	}
+
+	rendered := renderedSubmission{ID: submission.ID, Time: submission.Time.Local().Format(timeFormat)}
+	for _, f := range fields {
+		answer, ok := answers[f.ID]
+		if !ok {
+			continue
+		}
+
+		value := answer.ValueLabel
+		if value == "" {
+			if b, ok := answer.Value.(bool); ok {
+				value = map[bool]string{true: "yes", false: "no"}[b]
+			} else {
+				value = export.Text(answer.Value)
+			}
+		}
+		if value == "" {
+			value = "-"
+		}
+
+		label := answer.Label
+		if label == "" {
+			label = f.Label
+		}
+		rendered.Fields = append(rendered.Fields, renderedField{label, value})
+	}
+	return rendered
+}
+
+// Renders the plain text and HTML bodies of a message from the templates with the given base name
+func renderEmail(name string, data any) (model.Email, error) {
+	email := model.Email{}
+
+	var text bytes.Buffer
+	err := textTemplates.ExecuteTemplate(&text, name+".txt", data)
+	if err != nil {
+		return email, fmt.Errorf("render_text: %w", err)
+	}
+	var html bytes.Buffer
+	err = htmlTemplates.ExecuteTemplate(&html, name+".html", data)
+	if err != nil {
+		return email, fmt.Errorf("render_html: %w", err)
+	}
+
+	email.Text, email.HTML = text.String(), html.String()
+	return email, nil
+}
+
+// Link to the submissions page of a survey
+func (n *Notifier) submissionsLink(surveyId int) string {
+	return n.cfg.PublicURL + "/admin/submissions?id=" + strconv.Itoa(surveyId)
+}
+
+// Queues an email about a new submission for each instant subscriber to the survey.
+// It is meant to be called once the submission is committed: it returns at once,
+// emails are queued and sent in the background, and failures are only logged
+func (n *Notifier) SubmissionCreated(survey model.Survey, submission model.Submission) {
+	if !n.Enabled() {
+		return
+	}
+	go n.queueSubmission(survey, submission)
+}
+
+func (n *Notifier) queueSubmission(survey model.Survey, submission model.Submission) {
+	ctx, cancel := queue.EnqueueContext()
+	defer cancel()
+
+	subscribers, err := n.notifications.ListSubscribers(ctx, survey.ID)
+	if err != nil {
+		log.Errorf("notify.submission.get_subscribers: %s", err)
+		return
+	}
+
+	var email model.Email
+	emails := []model.Email{}
+	for _, sub := range subscribers {
+		if sub.Mode != model.SubscribeInstant {
+			continue
+		}
+
+		if len(emails) == 0 {
+			email, err = renderEmail("submission", map[string]any{
+				"Survey":     survey,
+				"Submission": renderSubmission(survey.Fields, submission),
+				"Link":       n.submissionsLink(survey.ID),
+			})
+			if err != nil {
+				log.Errorf("notify.submission.%s", err)
+				return
+			}
+			email.Subject = fmt.Sprintf("New response to %q", survey.Title)
+		}
+
+		email.To = sub.Email
+		emails = append(emails, email)
+	}
+	if len(emails) == 0 {
+		return
+	}
+
+	err = n.notifications.QueueEmails(ctx, emails)
+	if err != nil {
+		log.Errorf("notify.submission.queue: %s", err)
+		return
+	}
+	n.Notify()
+}
+
+// Attempts to send up to limit due emails, returning how many there were
+func (n *Notifier) sendDue(ctx context.Context, limit int) int {
+	due, err := n.notifications.DueEmails(ctx, time.Now(), limit)
+	if err != nil {
+		log.Errorf("notify.get_due: %s", err)
+		return 0
+	}
+
+	for _, email := range due {
+		n.sendEmail(ctx, email)
+	}
+	return len(due)
+}
+
+// Attempts to send an email and records the outcome, scheduling a retry on failure
+func (n *Notifier) sendEmail(ctx context.Context, email model.Email) {
+	if ctx.Err() != nil {
+		// shutting down: the email stays due
+		return
+	}
+	err := send(n.cfg.SMTP, email)
+	if err != nil && ctx.Err() != nil {
+		// failed while shutting down, possibly because of it: the email stays due
+		return
+	}
+
+	status, next, errMsg := model.EmailSent, time.Now(), ""
+	if err != nil {
+		errMsg = err.Error()
+		attempts := email.Attempts + 1
+		if attempts >= MaxAttempts {
+			status = model.EmailDead
+			log.Warnf("notify.send.dead: email %d to %s: %s", email.ID, email.To, err)
+		} else {
+			status, next = model.EmailPending, next.Add(Backoff.Delay(attempts))
+			log.Debugf("notify.send: email %d to %s: %s", email.ID, email.To, err)
+		}
+	}
+
+	err = n.notifications.RecordEmailAttempt(ctx, email.ID, status, next, errMsg)
+	if err != nil {
+		log.Errorf("notify.record_attempt: %s", err)
+	}
+}
+
+// Queues the daily digests every day at the configured time, until the context is done.
+// Digests missed while the server was down are queued on startup
+func (n *Notifier) RunDigests(ctx context.Context) {
+	for {
+		now := time.Now()
+		last := lastDigestTime(now, n.cfg.DigestTime)
+		n.queueDigests(ctx, last)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(nextDigestTime(last, n.cfg.DigestTime))):
+		}
+	}
+}
+
+// Latest digest time at or before now
+func lastDigestTime(now time.Time, timeOfDay time.Duration) time.Time {
+	t := digestTimeOn(now, 0, timeOfDay)
+	if t.After(now) {
+		t = digestTimeOn(now, -1, timeOfDay)
+	}
+	return t
+}
+
+// Digest time on the day after the given one
+func nextDigestTime(t time.Time, timeOfDay time.Duration) time.Time {
+	return digestTimeOn(t, 1, timeOfDay)
+}
+
+// Digest time on the day the given number of days away from t, in its location
+func digestTimeOn(t time.Time, days int, timeOfDay time.Duration) time.Time {
+	y, m, d := t.Date()
+	hour, minute := int(timeOfDay/time.Hour), int(timeOfDay%time.Hour/time.Minute)
+	return time.Date(y, m, d+days, hour, minute, 0, 0, t.Location())
+}
+
+// Queues a digest for each subscription not yet covered up to the given time
+func (n *Notifier) queueDigests(ctx context.Context, until time.Time) {
+	if !n.Enabled() {
+		return
+	}
+
+	due, err := n.notifications.DueDigests(ctx, until)
+	if err != nil {
+		log.Errorf("notify.digest.get_due: %s", err)
+		return
+	}
+
+	queued := false
+	for _, sub := range due {
+		since := sub.CreatedAt
+		if sub.LastDigestAt != nil {
+			since = *sub.LastDigestAt
+		}
+
+		email, ok, err := n.digest(ctx, sub.SurveyID, since, until)
+		if err != nil {
+			log.Errorf("notify.digest.%s", err)
+			continue
+		}
+		if ok {
+			email.To = sub.Email
+			err = n.notifications.QueueEmails(ctx, []model.Email{email})
+			if err != nil {
+				log.Errorf("notify.digest.queue: %s", err)
+				continue
+			}
+			queued = true
+		}
+
+		err = n.notifications.SetDigested(ctx, sub.SurveyID, sub.Email, until)
+		if err != nil {
+			log.Errorf("notify.digest.%s", err)
+		}
+	}
+	if queued {
+		n.Notify()
+	}
+}
+
+// Renders the digest of the submissions to a survey in the given period.
+// Returns false if there were none
+func (n *Notifier) digest(ctx context.Context, surveyId int, since, until time.Time) (model.Email, bool, error) {
+	survey, err := n.surveys.Get(ctx, surveyId)
+	if err != nil {
+		return model.Email{}, false, fmt.Errorf("get_survey: %w", err)
+	}
+	fields, err := n.surveys.AllFields(ctx, surveyId)
+	if err != nil {
+		return model.Email{}, false, fmt.Errorf("get_fields: %w", err)
+	}
+
+	count, err := n.submissions.CountBetween(ctx, surveyId, since, until)
+	if err != nil {
+		return model.Email{}, false, fmt.Errorf("count_submissions: %w", err)
+	}
+	if count == 0 {
+		return model.Email{}, false, nil
+	}
+
+	listed, err := n.submissions.ListBetween(ctx, surveyId, since, until, maxDigestSubmissions)
+	if err != nil {
+		return model.Email{}, false, fmt.Errorf("get_submissions: %w", err)
+	}
+	submissions := make([]renderedSubmission, 0, len(listed))
+	for _, s := range listed {
+		submissions = append(submissions, renderSubmission(fields, s))
+	}
+
+	email, err := renderEmail("digest", map[string]any{
+		"Survey":      survey,
+		"Count":       count,
+		"Since":       since.Local().Format(timeFormat),
+		"Until":       until.Local().Format(timeFormat),
+		"Submissions": submissions,
+		"More":        count - len(submissions),
+		"Link":        n.submissionsLink(surveyId),
+	})
+	if err != nil {
+		return email, false, err
+	}
+	responses := "responses"
+	if count == 1 {
+		responses = "response"
+	}
+	email.Subject = fmt.Sprintf("Daily digest: %d new %s to %q", count, responses, survey.Title)
+	return email, true, nil
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestTimes(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skipf("time zone Europe/Rome not available: %v", err)
+	}
+	at := func(loc *time.Location, s string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		timeOfDay time.Duration
+		wantLast  time.Time
+		wantNext  time.Time
+	}{
+		{
+			name:      "after today's digest",
+			now:       at(time.UTC, "2024-05-01 10:00"),
+			timeOfDay: 8 * time.Hour,
+			wantLast:  at(time.UTC, "2024-05-01 08:00"),
+			wantNext:  at(time.UTC, "2024-05-02 08:00"),
+		},
+		{
+			name:      "before today's digest",
+			now:       at(time.UTC, "2024-05-01 07:59"),
+			timeOfDay: 8 * time.Hour,
+			wantLast:  at(time.UTC, "2024-04-30 08:00"),
+			wantNext:  at(time.UTC, "2024-05-01 08:00"),
+		},
+		{
+			name:      "exactly at the digest",
+			now:       at(time.UTC, "2024-05-01 08:00"),
+			timeOfDay: 8 * time.Hour,
+			wantLast:  at(time.UTC, "2024-05-01 08:00"),
+			wantNext:  at(time.UTC, "2024-05-02 08:00"),
+		},
+		{
+			name:      "minutes past the hour",
+			now:       at(time.UTC, "2024-05-01 18:00"),
+			timeOfDay: 17*time.Hour + 30*time.Minute,
+			wantLast:  at(time.UTC, "2024-05-01 17:30"),
+			wantNext:  at(time.UTC, "2024-05-02 17:30"),
+		},
+		{
+			name:      "midnight across months",
+			now:       at(time.UTC, "2024-02-29 12:00"),
+			timeOfDay: 0,
+			wantLast:  at(time.UTC, "2024-02-29 00:00"),
+			wantNext:  at(time.UTC, "2024-03-01 00:00"),
+		},
+		{
+			name:      "local time",
+			now:       at(rome, "2024-05-01 07:30"),
+			timeOfDay: 8 * time.Hour,
+			wantLast:  at(rome, "2024-04-30 08:00"),
+			wantNext:  at(rome, "2024-05-01 08:00"),
+		},
+		{
+			name:      "clocks going forward",
+			now:       at(rome, "2024-03-30 09:00"),
+			timeOfDay: 8 * time.Hour,
+			wantLast:  at(rome, "2024-03-30 08:00"),
+			// 23 hours later
+			wantNext: at(rome, "2024-03-31 08:00"),
+		},
+		{
+			name:      "clocks going back",
+			now:       at(rome, "2024-10-26 09:00"),
+			timeOfDay: 8 * time.Hour,
+			wantLast:  at(rome, "2024-10-26 08:00"),
+			// 25 hours later
+			wantNext: at(rome, "2024-10-27 08:00"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			last := lastDigestTime(tt.now, tt.timeOfDay)
+			if !last.Equal(tt.wantLast) {
+				t.Errorf("lastDigestTime(%s) = %s, want %s", tt.now, last, tt.wantLast)
+			}
+			if last.After(tt.now) {
+				t.Errorf("lastDigestTime(%s) = %s, after now", tt.now, last)
+			}
+			if next := nextDigestTime(last, tt.timeOfDay); !next.Equal(tt.wantNext) {
+				t.Errorf("nextDigestTime(%s) = %s, want %s", last, next, tt.wantNext)
+			}
+		})
+	}
+}
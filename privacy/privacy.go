@@ -0,0 +1,110 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+// Anonymizes respondent IPs according to the privacy mode of a survey.
+type Anonymizer struct {
+	secret []byte
+
+	mu          sync.Mutex
+	salt        []byte
+	saltExpires time.Time
+}
+
+func NewAnonymizer(secret string) *Anonymizer {
+	return &Anonymizer{secret: []byte(secret)}
+}
+
+// Returns the form of the IP to be stored, according to the privacy mode:
+// the full address, the address truncated to its network (/24 or /48),
+// or a keyed hash salted with a daily rotating salt.
+func (a *Anonymizer) IP(mode string, ip string) (string, error) {
+	switch mode {
+	case model.PrivacyTruncated:
+		return truncate(ip), nil
+	case model.PrivacyHashed:
+		salt, err := a.currentSalt()
+		if err != nil {
+			return "", err
+		}
+		return a.hash(salt, []byte(ip)), nil
+	}
+	return ip, nil
+}
+
+// Redacts an IP read back from storage, in case it was stored before
+// the privacy mode was changed. It is a no-op on anonymized IPs.
+func (a *Anonymizer) Redact(mode string, ip string) string {
+	if _, err := netip.ParseAddr(ip); err != nil {
+		// not an address: already hashed
+		return ip
+	}
+
+	switch mode {
+	case model.PrivacyTruncated:
+		return truncate(ip)
+	case model.PrivacyHashed:
+		return "redacted"
+	}
+	return ip
+}
+
+// Returns a stable pseudonym for the IP, to detect repeated submissions to a survey
+// without storing the address. Pseudonyms cannot be linked across surveys.
+func (a *Anonymizer) Pseudonym(surveyId int, ip string) string {
+	return a.hash([]byte("survey:"+strconv.Itoa(surveyId)+":"), []byte(ip))
+}
+
+func (a *Anonymizer) hash(salt []byte, value []byte) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(salt)
+	mac.Write(value)
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Returns the salt for the current day, replacing it when the day is over
+// so that hashes from different days cannot be linked together.
+func (a *Anonymizer) currentSalt() ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now().UTC()
+	if a.salt == nil || !now.Before(a.saltExpires) {
+		salt := make([]byte, 32)
+		_, err := rand.Read(salt)
+		if err != nil {
+			return nil, err
+		}
+		a.salt = salt
+		a.saltExpires = now.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	}
+	return a.salt, nil
+}
+
+func truncate(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return "unknown"
+	}
+
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return "unknown"
+	}
+	return prefix.Addr().String()
+}
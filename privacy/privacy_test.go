@@ -0,0 +1,113 @@
+package privacy
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+func TestIP(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		ip   string
+		want string
+	}{
+		{"full IPv4", model.PrivacyFull, "192.0.2.123", "192.0.2.123"},
+		{"full IPv6", model.PrivacyFull, "2001:db8::1", "2001:db8::1"},
+		{"truncated IPv4", model.PrivacyTruncated, "192.0.2.123", "192.0.2.0"},
+		{"truncated IPv6", model.PrivacyTruncated, "2001:db8:aaaa:bbbb::1", "2001:db8:aaaa::"},
+		{"truncated invalid address", model.PrivacyTruncated, "not an ip", "unknown"},
+	}
+	a := NewAnonymizer("secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.IP(tt.mode, tt.ip)
+			if err != nil {
+				t.Fatalf("IP: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IP(%s, %s) = %s, want %s", tt.mode, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIPHashed(t *testing.T) {
+	a := NewAnonymizer("secret")
+	hash := func(a *Anonymizer, ip string) string {
+		h, err := a.IP(model.PrivacyHashed, ip)
+		if err != nil {
+			t.Fatalf("IP: %v", err)
+		}
+		return h
+	}
+
+	h := hash(a, "192.0.2.1")
+	if b, err := hex.DecodeString(h); err != nil || len(b) != 16 {
+		t.Errorf("hash %q is not 16 bytes in hex", h)
+	}
+	if again := hash(a, "192.0.2.1"); again != h {
+		t.Errorf("same address hashed to %s and %s on the same day", h, again)
+	}
+	if other := hash(a, "192.0.2.2"); other == h {
+		t.Errorf("different addresses hashed to the same %s", h)
+	}
+	// another anonymizer has its own salt
+	if other := hash(NewAnonymizer("secret"), "192.0.2.1"); other == h {
+		t.Errorf("hash %s did not depend on the salt", h)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		ip   string
+		want string
+	}{
+		{"full", model.PrivacyFull, "192.0.2.123", "192.0.2.123"},
+		{"truncated", model.PrivacyTruncated, "192.0.2.123", "192.0.2.0"},
+		{"truncated already", model.PrivacyTruncated, "192.0.2.0", "192.0.2.0"},
+		{"hashed", model.PrivacyHashed, "192.0.2.123", "redacted"},
+		{"hashed truncated", model.PrivacyHashed, "192.0.2.0", "redacted"},
+		{"hash", model.PrivacyHashed, "0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef"},
+		{"hash in full mode", model.PrivacyFull, "0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef"},
+	}
+	a := NewAnonymizer("secret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.Redact(tt.mode, tt.ip); got != tt.want {
+				t.Errorf("Redact(%s, %s) = %s, want %s", tt.mode, tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPseudonym(t *testing.T) {
+	a := NewAnonymizer("secret")
+	p := a.Pseudonym(1, "192.0.2.1")
+
+	tests := []struct {
+		name     string
+		a        *Anonymizer
+		surveyId int
+		ip       string
+		same     bool
+	}{
+		{"same survey and address", a, 1, "192.0.2.1", true},
+		{"same survey and address, other anonymizer", NewAnonymizer("secret"), 1, "192.0.2.1", true},
+		{"other address", a, 1, "192.0.2.2", false},
+		{"other survey", a, 2, "192.0.2.1", false},
+		{"other secret", NewAnonymizer("another secret"), 1, "192.0.2.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.a.Pseudonym(tt.surveyId, tt.ip)
+			if (got == p) != tt.same {
+				t.Errorf("Pseudonym(%d, %s) = %s, compared to %s: want same = %t", tt.surveyId, tt.ip, got, p, tt.same)
+			}
+		})
+	}
+}
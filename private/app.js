@@ -33,6 +33,37 @@ async function startup() {
             li.querySelector(".description").innerHTML = s.description || "";
             li.querySelector(".edit").href = "/admin/edit?id=" + s.id;
             li.querySelector(".submissions").href = "/admin/submissions?id=" + s.id;
+            li.querySelector(".present").href = "/admin/present?id=" + s.id;
+
+            li.querySelector(".status").textContent = s.status;
+            const transitions = {
+                publish: ["draft", "closed"],
+                close: ["open"],
+                archive: ["draft", "closed"],
+            };
+            for (const [action, from] of Object.entries(transitions)) {
+                if (!from.includes(s.status)) continue;
+
+                const button = li.querySelector("." + action);
+                button.style.display = "";
+                button.onclick = async () => {
+                    try {
+                        const resp = await fetch(`/api/admin/surveys/${s.id}/${action}`, {
+                            method: "POST",
+                            headers: {
+                                Authorization: "Bearer " + cookies.access_token,
+                            },
+                        });
+                        if (resp.status !== 204) {
+                            throw new Error(`could not ${action} survey: ` + await resp.text());
+                        }
+                        location.reload();
+                    } catch (err) {
+                        console.error(err);
+                        alert("There was an error!\n" + err.message);
+                    }
+                };
+            }
 
             ul.append(li);
         }
@@ -188,6 +188,9 @@ async function startup() {
         } else if (resp.status === 201) {
           const { id } = await resp.json();
           window.location = "/admin/edit?id=" + id;
+        } else if (resp.status === 422) {
+          const { errors } = await resp.json();
+          throw new Error("invalid survey:\n" + errors.map(e => `${e.path}: ${e.message}`).join("\n"));
         } else {
           throw new Error("could not save survey: " + await resp.text());
         }
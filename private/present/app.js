@@ -0,0 +1,107 @@
+"use strict"
+
+// Presenter controls: start the presentation, move between questions, show results
+
+const cookies = Object.fromEntries(document.cookie
+    .split(/\s*;\s*/)
+    .map(c => {
+        const ieq = c.indexOf("=");
+        return [c.slice(0, ieq), c.slice(ieq + 1)];
+    }));
+
+const surveyId = +new URLSearchParams(location.search).get("id");
+const api = `/api/admin/surveys/${surveyId}/presentation`;
+
+document.querySelector(".screen").href = "/present/?id=" + surveyId;
+
+let current = null;
+
+const commands = {
+    start: () => call("POST", api),
+    prev: () => call("POST", api + "/prev"),
+    next: () => call("POST", api + "/next"),
+    results: () => call("PUT", api, { show_results: !current.show_results }),
+    stop: () => call("DELETE", api),
+};
+for (const [id, command] of Object.entries(commands)) {
+    document.getElementById(id).onclick = command;
+}
+
+startup();
+async function startup() {
+    const resp = await fetch(api, {
+        headers: {
+            Authorization: "Bearer " + cookies.access_token,
+        },
+    });
+    render(resp.status === 200 ? await resp.json() : null);
+
+    // live results, authorized by the access_token cookie
+    const events = new EventSource(`/api/admin/surveys/${surveyId}/events`);
+    events.addEventListener("submission.created", refresh);
+}
+
+let refreshing = null;
+function refresh() {
+    // coalesce bursts of submissions
+    if (!current || refreshing) return;
+    refreshing = setTimeout(async () => {
+        refreshing = null;
+        const resp = await fetch(api, {
+            headers: {
+                Authorization: "Bearer " + cookies.access_token,
+            },
+        });
+        if (resp.status === 200) {
+            render(await resp.json());
+        }
+    }, 1000);
+}
+
+async function call(method, url, body) {
+    try {
+        const resp = await fetch(url, {
+            method,
+            headers: {
+                Authorization: "Bearer " + cookies.access_token,
+                "Content-Type": "application/json",
+            },
+            body: body && JSON.stringify(body),
+        });
+        if (resp.status === 204) {
+            render(null);
+            return;
+        }
+        if (resp.status !== 200 && resp.status !== 201) {
+            throw new Error(await resp.text());
+        }
+        render(await resp.json());
+    } catch (err) {
+        console.error(err);
+        alert("There was an error!\n" + err.message);
+    }
+}
+
+function render(p) {
+    current = p;
+    const show = (id, visible) => document.getElementById(id).style.display = visible ? "" : "none";
+    show("start", !p);
+    show("prev", p && p.index > 0);
+    show("next", p && p.index < p.count - 1);
+    show("results", p);
+    show("stop", p);
+
+    if (!p) {
+        document.querySelector(".progress").textContent = "Not started";
+        document.querySelector(".question").textContent = "";
+        document.querySelector(".results").innerHTML = "";
+        return;
+    }
+
+    document.querySelector(".title").textContent = p.title;
+    document.querySelector(".progress").textContent =
+        `Question ${p.index + 1} of ${p.count}` + (p.show_results ? " · results shown" : "");
+    document.getElementById("results").textContent = p.show_results ? "Hide results" : "Show results";
+    document.querySelector(".question").textContent = p.field.label;
+    renderResults(document.querySelector(".results"), p.results);
+}
@@ -4,12 +4,34 @@ const fieldTpl = document.querySelector(".field");
 fieldTpl.remove();
 fieldTpl.style.display = "";
 
+function cookie(name) {
+    const cookies = Object.fromEntries(document.cookie
+        .split(/\s*;\s*/)
+        .map(c => {
+            const ieq = c.indexOf("=");
+            return [c.slice(0, ieq), c.slice(ieq + 1)];
+        }));
+    return cookies[name];
+}
+
 async function render(el, surveyId) {
     el = document.querySelector(el);
     if (!el) throw new Error("root element not found");
 
+    // respondents may be invited by a personal link
+    const invite = new URLSearchParams(location.search).get("invite");
+    const query = invite ? "?invite=" + encodeURIComponent(invite) : "";
+
     try {
-        const resp = await fetch(`/api/surveys/${surveyId}`);
+        const resp = await fetch(`/api/surveys/${surveyId}${query}`);
+        if (resp.status === 401 || resp.status === 403 || resp.status === 410) {
+            // survey exists but can't be answered right now
+            const message = document.createElement("p");
+            message.textContent = (await resp.text()).trim();
+            el.querySelector(".survey-container").replaceChildren(message);
+            el.style.display = "";
+            return;
+        }
         if (resp.status !== 200) {
             throw new Error("survey not found");
         }
@@ -20,6 +42,11 @@ async function render(el, surveyId) {
         form.onsubmit = async function (e) {
             e.preventDefault();
 
+            for (const fieldEl of this.querySelectorAll(".field.invalid")) {
+                fieldEl.classList.remove("invalid");
+                fieldEl.querySelector(".field-error").textContent = "";
+            }
+
             const submission = { fields: {} };
             for (const f of survey.fields || []) {
                 const input = this.querySelector(`[name=${f.name}]`)
@@ -31,7 +58,7 @@ async function render(el, surveyId) {
                         value = input.value;
                         break;
                     case "number":
-                        value = +input.value;
+                        value = input.value === "" ? null : +input.value;
                         break;
                     case "checkbox":
                         value = input.checked;
@@ -40,16 +67,31 @@ async function render(el, surveyId) {
                 submission.fields[f.name] = { id: f.id, value };
             }
 
+            // logged in users identify themselves by their token, only accepted in the header
+            const headers = { "Content-Type": "application/json" };
+            const accessToken = cookie("access_token");
+            if (accessToken) {
+                headers.Authorization = "Bearer " + accessToken;
+            }
+
             try {
-                const resp = await fetch(`/api/surveys/${surveyId}/submissions`, {
+                const resp = await fetch(`/api/surveys/${surveyId}/submissions${query}`, {
                     method: "POST",
-                    headers: {
-                        "Content-Type": "application/json",
-                    },
+                    headers,
                     body: JSON.stringify(submission),
                 });
                 if (resp.status === 409) {
-                    throw new Error("Una risposta è già pervenuta da questo IP");
+                    throw new Error("You already submitted your entry to this survey");
+                }
+                if (resp.status === 422) {
+                    const { errors } = await resp.json();
+                    for (const e of errors) {
+                        const fieldEl = this.querySelector(`.field[data-name="${e.path.replace(/^fields\./, "")}"]`);
+                        if (!fieldEl) continue;
+                        fieldEl.classList.add("invalid");
+                        fieldEl.querySelector(".field-error").textContent = e.message;
+                    }
+                    throw new Error("Please check the highlighted fields");
                 }
                 if (resp.status !== 201) {
                     throw new Error("could not send submission: " + await resp.text());
@@ -82,6 +124,7 @@ async function render(el, surveyId) {
             const id = "field_" + f.name;
 
             const fieldEl = fieldTpl.cloneNode(true);
+            fieldEl.dataset.name = f.name;
             if (f.required) {
                 fieldEl.classList.add("required");
             }
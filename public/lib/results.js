@@ -0,0 +1,79 @@
+"use strict"
+
+// Renders the results of a presentation question into el
+function renderResults(el, results) {
+    el.innerHTML = "";
+    if (!results) return;
+
+    const count = document.createElement("p");
+    count.className = "results-count";
+    count.textContent = `${results.responses - results.empty} answers`;
+    el.append(count);
+
+    switch (results.type) {
+        case "select":
+            el.append(bars((results.options || []).map(o => [o.label || o.value, o.count, o.percent])));
+            break;
+        case "checkbox":
+            if (results.checkbox) {
+                const c = results.checkbox;
+                el.append(bars([["Yes", c.true, c.true_percent], ["No", c.false, c.false_percent]]));
+            }
+            break;
+        case "number":
+            if (results.number) {
+                const n = results.number;
+                const total = n.histogram.reduce((sum, b) => sum + b.count, 0);
+                el.append(bars(n.histogram.map(b => [`${b.from}–${b.to}`, b.count, 100 * b.count / total])));
+
+                const summary = document.createElement("p");
+                summary.className = "results-summary";
+                summary.textContent = `mean ${round(n.mean)} · median ${round(n.median)} · min ${n.min} · max ${n.max}`;
+                el.append(summary);
+            }
+            break;
+        default:
+            el.append(terms(results.terms || []));
+    }
+}
+
+function bars(rows) {
+    const list = document.createElement("ul");
+    list.className = "results-bars";
+    for (const [label, count, percent] of rows) {
+        const li = document.createElement("li");
+
+        const name = document.createElement("span");
+        name.className = "bar-label";
+        name.textContent = label;
+
+        const bar = document.createElement("span");
+        bar.className = "bar";
+        bar.style.width = percent + "%";
+
+        const value = document.createElement("span");
+        value.className = "bar-value";
+        value.textContent = `${count} (${round(percent)}%)`;
+
+        li.append(name, bar, value);
+        list.append(li);
+    }
+    return list;
+}
+
+function terms(terms) {
+    const cloud = document.createElement("p");
+    cloud.className = "results-terms";
+    const max = Math.max(1, ...terms.map(t => t.count));
+    for (const t of terms) {
+        const word = document.createElement("span");
+        word.textContent = t.term;
+        word.style.fontSize = (1 + 2 * t.count / max) + "em";
+        cloud.append(word, " ");
+    }
+    return cloud;
+}
+
+function round(n) {
+    return Math.round(n * 10) / 10;
+}
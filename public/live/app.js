@@ -0,0 +1,158 @@
+"use strict"
+
+// Respondent page of a presentation: shows the current question, and follows
+// the presenter as they move to the next one
+
+const surveyId = +new URLSearchParams(location.search).get("id");
+
+const form = document.querySelector(".form");
+const fieldEl = form.querySelector(".field");
+const message = document.querySelector(".message");
+
+let current = null;
+
+function cookie(name) {
+    const cookies = Object.fromEntries(document.cookie
+        .split(/\s*;\s*/)
+        .map(c => {
+            const ieq = c.indexOf("=");
+            return [c.slice(0, ieq), c.slice(ieq + 1)];
+        }));
+    return cookies[name];
+}
+
+follow();
+function follow() {
+    const events = new EventSource(`/api/surveys/${surveyId}/presentation/events`);
+    events.addEventListener("presentation", async e => {
+        const p = JSON.parse(e.data);
+        if (current && current.field_id === p.field_id) return;
+        await load();
+    });
+    events.addEventListener("ended", () => {
+        events.close();
+        current = null;
+        show("The presentation is over. Thank you!");
+    });
+    events.onerror = () => {
+        // not started yet, or connection lost: try again later
+        events.close();
+        setTimeout(follow, 5000);
+    };
+}
+
+async function load() {
+    try {
+        // the state is loaded apart from the stream, to know whether this respondent already answered
+        const resp = await fetch(`/api/surveys/${surveyId}/presentation`);
+        if (resp.status === 404) {
+            show("Waiting for the presentation to start...");
+            return;
+        }
+        if (resp.status !== 200) {
+            show((await resp.text()).trim());
+            return;
+        }
+
+        current = await resp.json();
+        document.querySelector(".title").textContent = current.title;
+        if (current.submitted) {
+            show("Thanks for your answer! Wait for the next question...");
+            return;
+        }
+        render(current.field);
+
+    } catch (err) {
+        console.error(err);
+        alert(err.message);
+    }
+}
+
+function show(text) {
+    message.textContent = text;
+    message.style.display = "";
+    form.style.display = "none";
+}
+
+function render(f) {
+    const id = "field_" + f.name;
+    fieldEl.querySelector("label").htmlFor = id;
+    fieldEl.querySelector("label").textContent = f.label;
+    fieldEl.classList.remove("invalid");
+    fieldEl.querySelector(".field-error").textContent = "";
+
+    let input;
+    switch (f.type) {
+        case "select":
+            input = document.createElement("select");
+            for (const o of f.options || []) {
+                const option = document.createElement("option");
+                option.textContent = o.label || "";
+                option.value = o.value;
+                input.append(option);
+            }
+            break;
+        case "textarea":
+            input = document.createElement("textarea");
+            break;
+        default:
+            input = document.createElement("input");
+            input.type = f.type === "number" || f.type === "checkbox" ? f.type : "text";
+    }
+    input.id = id;
+    input.name = f.name;
+    fieldEl.querySelector(".field-container").replaceChildren(input);
+
+    form.onsubmit = async function (e) {
+        e.preventDefault();
+
+        let value;
+        switch (f.type) {
+            case "number":
+                value = input.value === "" ? null : +input.value;
+                break;
+            case "checkbox":
+                value = input.checked;
+                break;
+            default:
+                value = input.value;
+        }
+
+        // logged in users identify themselves by their token, only accepted in the header
+        const headers = { "Content-Type": "application/json" };
+        const accessToken = cookie("access_token");
+        if (accessToken) {
+            headers.Authorization = "Bearer " + accessToken;
+        }
+
+        try {
+            const resp = await fetch(`/api/surveys/${surveyId}/presentation/answers`, {
+                method: "POST",
+                headers,
+                body: JSON.stringify({ fields: { [f.name]: { id: f.id, value } } }),
+            });
+            if (resp.status === 422) {
+                const { errors } = await resp.json();
+                fieldEl.classList.add("invalid");
+                fieldEl.querySelector(".field-error").textContent = errors.map(e => e.message).join(", ");
+                return;
+            }
+            if (resp.status === 409) {
+                // already answered, or the question was closed
+                show((await resp.text()).trim());
+                return;
+            }
+            if (resp.status !== 201) {
+                throw new Error("could not send answer: " + await resp.text());
+            }
+            show("Thanks for your answer! Wait for the next question...");
+
+        } catch (err) {
+            console.error(err);
+            alert(err.message);
+        }
+    };
+
+    message.style.display = "none";
+    form.style.display = "";
+}
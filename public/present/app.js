@@ -0,0 +1,44 @@
+"use strict"
+
+// Public presenter page, to be shown on a projector: follows the current question
+// of a presentation, and its results when the presenter shows them
+
+const surveyId = +new URLSearchParams(location.search).get("id");
+
+const joinUrl = `${location.origin}/live/?id=${surveyId}`;
+document.querySelector(".join").textContent = "Answer at " + joinUrl;
+
+let current = null;
+
+follow();
+function follow() {
+    const events = new EventSource(`/api/surveys/${surveyId}/presentation/events`);
+    events.addEventListener("presentation", e => {
+        current = JSON.parse(e.data);
+        render(current);
+    });
+    events.addEventListener("results", e => {
+        if (current && current.show_results) {
+            renderResults(document.querySelector(".results"), JSON.parse(e.data));
+        }
+    });
+    events.addEventListener("ended", () => {
+        events.close();
+        current = null;
+        document.querySelector(".progress").textContent = "";
+        document.querySelector(".question").textContent = "Thank you!";
+        document.querySelector(".results").innerHTML = "";
+    });
+    events.onerror = () => {
+        // not started yet, or connection lost: try again later
+        events.close();
+        setTimeout(follow, 5000);
+    };
+}
+
+function render(p) {
+    document.querySelector(".title").textContent = p.title;
+    document.querySelector(".progress").textContent = `Question ${p.index + 1} of ${p.count}`;
+    document.querySelector(".question").textContent = p.field.label;
+    renderResults(document.querySelector(".results"), p.show_results ? p.results : null);
+}
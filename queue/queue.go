@@ -0,0 +1,85 @@
+// Package queue runs the workers of persistent queues with retries,
+// such as those of webhook deliveries and emails.
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	pollInterval = 10 * time.Second
+	// Due items processed at a time
+	batchSize = 20
+	// Bound on the time spent queueing items
+	enqueueTimeout = 5 * time.Second
+)
+
+// Schedule of retries: the delay before the first one is doubled at each failure, up to a maximum
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+}
+
+// Delay before the next attempt, after the given number of failed ones
+func (b Backoff) Delay(attempts int) time.Duration {
+	delay := b.Base
+	for i := 1; i < attempts && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+// Context to queue items caused by a request with: the request may be over already,
+// so it does not derive from it
+func EnqueueContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), enqueueTimeout)
+}
+
+// Processes the items of a queue as they come due
+type Worker struct {
+	process func(ctx context.Context, limit int) int
+	wake    chan struct{}
+}
+
+// Creates a worker that processes due items with the given function,
+// which handles up to limit of them and returns how many there were
+func NewWorker(process func(ctx context.Context, limit int) int) *Worker {
+	return &Worker{
+		process: process,
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Wakes the worker up to look for due items
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Processes due items as they come, until the context is done
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		w.processDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.wake:
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (w *Worker) processDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		if w.process(ctx, batchSize) < batchSize {
+			return
+		}
+	}
+}
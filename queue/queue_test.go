@@ -0,0 +1,104 @@
+package queue
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Base: 30 * time.Second, Max: 6 * time.Hour}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{10, 256 * time.Minute},
+		// 512 minutes would be past the maximum
+		{11, 6 * time.Hour},
+		{1000, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := b.Delay(tt.attempts); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffBaseOverMax(t *testing.T) {
+	b := Backoff{Base: time.Hour, Max: time.Minute}
+	for _, attempts := range []int{1, 2, 10} {
+		if got := b.Delay(attempts); got != time.Minute {
+			t.Errorf("Delay(%d) = %s, want the maximum", attempts, got)
+		}
+	}
+}
+
+func TestWorkerProcessesFullBatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		pending int
+		// calls to process before the worker waits for more
+		wantCalls int
+	}{
+		{"nothing due", 0, 1},
+		{"partial batch", batchSize - 1, 1},
+		{"full batch", batchSize, 2},
+		{"several batches", 2*batchSize + 1, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pending, calls := tt.pending, 0
+			w := NewWorker(func(ctx context.Context, limit int) int {
+				calls++
+				n := limit
+				if pending < n {
+					n = pending
+				}
+				pending -= n
+				return n
+			})
+			w.processDue(context.Background())
+			if calls != tt.wantCalls {
+				t.Errorf("process called %d times, want %d", calls, tt.wantCalls)
+			}
+			if pending != 0 {
+				t.Errorf("%d items left", pending)
+			}
+		})
+	}
+}
+
+func TestWorkerNotify(t *testing.T) {
+	var calls atomic.Int32
+	processed := make(chan struct{}, 10)
+	w := NewWorker(func(ctx context.Context, limit int) int {
+		calls.Add(1)
+		processed <- struct{}{}
+		return 0
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+
+	<-processed
+	// notifying twice before the worker wakes up makes it look once
+	w.Notify()
+	w.Notify()
+	<-processed
+	cancel()
+	<-done
+
+	if n := calls.Load(); n < 2 || n > 3 {
+		t.Errorf("process called %d times, want 2 or 3", n)
+	}
+}
@@ -1,23 +1,26 @@
 package routes
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/events"
+	"github.com/mbolis/quick-survey/export"
 	"github.com/mbolis/quick-survey/httpx"
 	"github.com/mbolis/quick-survey/log"
 	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
 )
 
-var reNoIdent = regexp.MustCompile(`\W+`)
-
+// Creates a survey in the active workspace, owned by the current user
 func CreateSurvey(app app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		survey := model.Survey{}
@@ -27,73 +30,18 @@ func CreateSurvey(app app.App) http.HandlerFunc {
 			return
 		}
 
-		// TODO input validation
-
-		tx, err := app.BeginTx(r.Context(), nil)
-		if err != nil {
-			httpx.LogInternalError(w, "db.begin_tx", err)
+		if errs := validation.Survey(survey); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
 			return
 		}
-		defer tx.Rollback()
 
-		var surveyId int
-		err = tx.QueryRowContext(r.Context(), `
-		INSERT INTO survey (title, description) VALUES (?, ?)
-		RETURNING id`,
-			survey.Title,
-			survey.Description,
-		).Scan(&surveyId)
+		survey.Owner, survey.WorkspaceID = auth.Username(r), auth.ClaimedWorkspace(r)
+		surveyId, err := app.Surveys.Create(r.Context(), survey)
 		if err != nil {
 			httpx.LogInternalError(w, "db.insert_survey", err)
 			return
 		}
 
-		stmt, err := tx.PrepareContext(r.Context(), `
-		INSERT INTO survey_field (survey_id, type, name, label, required, options)
-		VALUES (?, ?, ?, ?, ?, ?)`)
-		if err != nil {
-			httpx.LogInternalError(w, "db.insert_survey.fields.prepare", err)
-			return
-		}
-		defer stmt.Close()
-
-		names := make([]string, len(survey.Fields))
-		for i, f := range survey.Fields {
-			name := strings.ToLower(f.Label)
-			name = reNoIdent.ReplaceAllLiteralString(name, " ")
-			name = strings.Join(strings.Fields(name), "_")
-
-			n := 0
-			for _, prev := range names[:i] {
-				if prev == name {
-					n++
-				}
-			}
-			if n > 0 {
-				name = fmt.Sprintf("%s__%d", name, n)
-			}
-
-			var optionsJson []byte
-			if f.Options != nil {
-				optionsJson, err = json.Marshal(f.Options)
-				if err != nil {
-					httpx.LogInternalError(w, "db.insert_survey.fields.parse_options", err)
-					return
-				}
-			}
-			_, err := stmt.ExecContext(r.Context(), surveyId, f.Type, name, f.Label, f.Required, string(optionsJson))
-			if err != nil {
-				httpx.LogInternalError(w, "db.insert_survey.fields.insert", err)
-				return
-			}
-		}
-
-		err = tx.Commit()
-		if err != nil {
-			httpx.LogInternalError(w, "db.insert_survey.commit", err)
-			return
-		}
-
 		w.WriteHeader(http.StatusCreated)
 		render.JSON(w, r, map[string]any{
 			"id": surveyId,
@@ -101,28 +49,21 @@ func CreateSurvey(app app.App) http.HandlerFunc {
 	}
 }
 
+// Lists the surveys of the active workspace: all of them to users whose roles allow it,
+// otherwise those owned by or shared with them
 func ListSurveys(app app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := app.QueryContext(r.Context(), `
-		SELECT s.id, s.version, s.title, s.description
-		FROM survey s`)
+		var surveys []model.Survey
+		var err error
+		if auth.Can(auth.ClaimedRoles(r), auth.SurveyAll) {
+			surveys, err = app.Surveys.List(r.Context(), auth.ClaimedWorkspace(r))
+		} else {
+			surveys, err = app.Surveys.ListFor(r.Context(), auth.ClaimedWorkspace(r), auth.Username(r))
+		}
 		if err != nil {
 			httpx.LogInternalError(w, "db.get_surveys", err)
 			return
 		}
-		defer rows.Close()
-
-		surveys := []model.Survey{}
-		for rows.Next() {
-			s := model.Survey{}
-			err = rows.Scan(&s.ID, &s.Version, &s.Title, &s.Description)
-			if err != nil {
-				httpx.LogInternalError(w, "db.get_surveys.scan", err)
-				return
-			}
-
-			surveys = append(surveys, s)
-		}
 
 		render.JSON(w, r, map[string]any{
 			"surveys": surveys,
@@ -138,52 +79,65 @@ func GetSurveyById(app app.App) http.HandlerFunc {
 			return
 		}
 
-		rows, err := app.QueryContext(r.Context(), `
-			SELECT
-				s.id, s.version, s.title, s.description,
-				f.type, f.name, f.label, f.required, f.options
-			FROM survey s
-			LEFT OUTER JOIN survey_field f ON (s.id = f.survey_id)
-			WHERE s.id = ?`,
-			surveyId,
-		)
+		survey, err := app.Surveys.Get(r.Context(), surveyId)
 		if err != nil {
-			httpx.LogInternalError(w, "db.get_survey", err)
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_survey", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.get_survey", err)
+			}
 			return
 		}
-		defer rows.Close()
 
-		if !rows.Next() {
-			httpx.LogNotFound(w, "get_survey", surveyId)
+		render.JSON(w, r, survey)
+	}
+}
+
+func ListSurveyVersions(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
 			return
 		}
 
-		survey := model.Survey{}
-		for {
-			f := model.SurveyField{}
-			var opts string
-			err = rows.Scan(
-				&survey.ID, &survey.Version, &survey.Title, &survey.Description,
-				&f.Type, &f.Name, &f.Label, &f.Required, &opts,
-			)
-			if err != nil {
-				httpx.LogInternalError(w, "db.get_survey.scan", err)
-				return
+		versions, err := app.Surveys.ListVersions(r.Context(), surveyId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_versions", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.get_versions", err)
 			}
+			return
+		}
 
-			if opts != "" {
-				err = json.Unmarshal([]byte(opts), &f.Options)
-				if err != nil {
-					httpx.LogInternalError(w, "db.get_survey.parse_options", err)
-					return
-				}
-			}
+		render.JSON(w, r, map[string]any{
+			"versions": versions,
+		})
+	}
+}
 
-			survey.Fields = append(survey.Fields, f)
+func GetSurveyVersion(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+		version, err := strconv.Atoi(chi.URLParam(r, "version"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.version")
+			return
+		}
 
-			if !rows.Next() {
-				break
+		survey, err := app.Surveys.GetVersion(r.Context(), surveyId, version)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_version", []int{surveyId, version})
+			} else {
+				httpx.LogInternalError(w, "db.get_version", err)
 			}
+			return
 		}
 
 		render.JSON(w, r, survey)
@@ -204,97 +158,106 @@ func UpdateSurvey(app app.App) http.HandlerFunc {
 			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
 			return
 		}
+		survey.ID = surveyId
 
-		tx, err := app.BeginTx(r.Context(), nil)
-		if err != nil {
-			httpx.LogInternalError(w, "db.begin_tx", err)
+		if errs := validation.Survey(survey); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
 			return
 		}
-		defer tx.Rollback()
 
-		// delete all fields
-		_, err = tx.ExecContext(r.Context(), `
-			DELETE FROM survey_field
-			WHERE survey_id = ?`,
-			surveyId,
-		)
+		err = app.Surveys.Update(r.Context(), survey)
 		if err != nil {
-			httpx.LogInternalError(w, "db.update_survey.delete_fields", err)
+			if errors.Is(err, store.ErrConflict) {
+				httpx.LogStatus(w, http.StatusConflict, log.DebugLevel, "db.update_survey.verify.conflict")
+			} else {
+				httpx.LogInternalError(w, "db.update_survey", err)
+			}
 			return
 		}
 
-		// recreate all fields
-		stmt, err := tx.PrepareContext(r.Context(), `
-			INSERT INTO survey_field (survey_id, type, name, label, required, options)
-			VALUES (?, ?, ?, ?, ?, ?)`)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func DeleteSurvey(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			httpx.LogInternalError(w, "db.update_survey.fields.prepare", err)
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
 			return
 		}
-		defer stmt.Close()
-
-		names := make([]string, len(survey.Fields))
-		for i, f := range survey.Fields {
-			name := strings.ToLower(f.Label)
-			name = reNoIdent.ReplaceAllLiteralString(name, " ")
-			name = strings.Join(strings.Fields(name), "_")
 
-			n := 0
-			for _, prev := range names[:i] {
-				if prev == name { // FIXME could be already found! Need to use regexp
-					n++
-				}
-			}
-			if n > 0 {
-				name = fmt.Sprintf("%s__%d", name, n)
+		err = app.Surveys.Delete(r.Context(), surveyId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "delete_survey", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.delete_survey", err)
 			}
+			return
+		}
 
-			var optionsJson []byte
-			if f.Options != nil {
-				optionsJson, err = json.Marshal(f.Options)
-				if err != nil {
-					httpx.LogInternalError(w, "db.update_survey.fields.parse_options", err)
-					return
-				}
-			}
-			_, err := stmt.ExecContext(r.Context(), surveyId, f.Type, name, f.Label, f.Required, string(optionsJson))
-			if err != nil {
-				httpx.LogInternalError(w, "db.update_survey.fields.update", err)
-				return
-			}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ListDeletedSurveys(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var surveys []model.Survey
+		var err error
+		if auth.Can(auth.ClaimedRoles(r), auth.SurveyAll) {
+			surveys, err = app.Surveys.ListDeleted(r.Context(), auth.ClaimedWorkspace(r))
+		} else {
+			surveys, err = app.Surveys.ListDeletedFor(r.Context(), auth.ClaimedWorkspace(r), auth.Username(r))
+		}
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_deleted_surveys", err)
+			return
 		}
 
-		res, err := tx.ExecContext(r.Context(), `
-			UPDATE survey
-			SET
-				title = ?,
-				description = ?,
-				version = version+1
-			WHERE	id = ?
-				AND version = ?`,
-			survey.Title,
-			survey.Description,
-			surveyId,
-			survey.Version,
-		)
+		render.JSON(w, r, map[string]any{
+			"surveys": surveys,
+		})
+	}
+}
+
+func RestoreSurvey(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			httpx.LogInternalError(w, "db.update_survey", err)
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
 			return
 		}
-		// optimistic lock
-		n, err := res.RowsAffected()
+
+		err = app.Surveys.Restore(r.Context(), surveyId)
 		if err != nil {
-			httpx.LogInternalError(w, "db.update_survey.verify", err)
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "restore_survey", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.restore_survey", err)
+			}
 			return
 		}
-		if n < 1 {
-			httpx.LogStatus(w, http.StatusConflict, log.DebugLevel, "db.update_survey.verify.conflict")
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func PurgeSurvey(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
 			return
 		}
 
-		err = tx.Commit()
+		err = app.Surveys.Purge(r.Context(), surveyId)
 		if err != nil {
-			httpx.LogInternalError(w, "db.update_survey.commit", err)
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "purge_survey", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.purge_survey", err)
+			}
 			return
 		}
 
@@ -302,7 +265,15 @@ func UpdateSurvey(app app.App) http.HandlerFunc {
 	}
 }
 
-func DeleteSurvey(app app.App) http.HandlerFunc {
+// Events published when a survey enters each status
+var statusEvents = map[string]string{
+	model.StatusOpen:     events.SurveyPublished,
+	model.StatusClosed:   events.SurveyClosed,
+	model.StatusArchived: events.SurveyArchived,
+}
+
+// Moves a survey to the given lifecycle state.
+func SetSurveyStatus(app app.App, status string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
@@ -310,46 +281,81 @@ func DeleteSurvey(app app.App) http.HandlerFunc {
 			return
 		}
 
-		tx, err := app.BeginTx(r.Context(), nil)
+		err = app.Surveys.SetStatus(r.Context(), surveyId, status)
 		if err != nil {
-			httpx.LogInternalError(w, "db.begin_tx", err)
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				httpx.LogNotFound(w, "set_status", surveyId)
+			case errors.Is(err, store.ErrConflict):
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "db.set_status.conflict", "survey cannot be moved to %s", status)
+			default:
+				httpx.LogInternalError(w, "db.set_status", err)
+			}
 			return
 		}
-		defer tx.Rollback()
 
-		_, err = tx.ExecContext(r.Context(), `
-			DELETE FROM survey_field
-			WHERE survey_id = ?`,
-			surveyId,
-		)
+		publish(app, surveyId, events.Event{
+			Type: statusEvents[status],
+			ID:   surveyId,
+			Data: map[string]any{"id": surveyId, "status": status},
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+const maxInvites = 1000
+
+func CreateSurveyInvites(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
-			httpx.LogInternalError(w, "db.delete_survey.fields", err)
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
 			return
 		}
 
-		res, err := tx.ExecContext(r.Context(), `
-			DELETE FROM survey WHERE survey_id = ?`,
-			surveyId,
-		)
-		if err != nil {
-			httpx.LogInternalError(w, "db.delete_survey", err)
+		body := struct {
+			Count int `json:"count"`
+		}{1}
+		err = render.DecodeJSON(r.Body, &body)
+		if err != nil && !errors.Is(err, io.EOF) {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
 			return
 		}
-		n, err := res.RowsAffected()
-		if err != nil {
-			httpx.LogInternalError(w, "db.delete_survey.verify", err)
+		if body.Count < 1 || body.Count > maxInvites {
+			httpx.LogInvalid(w, "request.validate", validation.Errors{
+				{Path: "count", Message: fmt.Sprintf("must be between 1 and %d", maxInvites)},
+			})
 			return
 		}
-		if n < 1 {
-			httpx.LogNotFound(w, "delete_survey", surveyId)
+
+		tokens := make([]string, body.Count)
+		for i := range tokens {
+			tokens[i], err = randomToken()
+			if err != nil {
+				httpx.LogInternalError(w, "invites.generate", err)
+				return
+			}
+		}
+
+		err = app.Invites.Insert(r.Context(), surveyId, tokens)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "insert_invites", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.insert_invites", err)
+			}
 			return
 		}
 
-		w.WriteHeader(http.StatusNoContent)
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, map[string]any{
+			"invites": tokens,
+		})
 	}
 }
 
-func GetSurveySubmissions(app app.App) http.HandlerFunc {
+func ListSurveyInvites(app app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
@@ -357,75 +363,58 @@ func GetSurveySubmissions(app app.App) http.HandlerFunc {
 			return
 		}
 
-		rows, err := app.QueryContext(r.Context(), `
-			SELECT
-				sf.id, sf.time, sf.ip,
-				sf.name, sf.label, sf.value
-			FROM survey x
-			LEFT OUTER JOIN (
-				SELECT
-					s.survey_id,
-					s.id, s.time, s.ip,
-					f.name, f.label, v.value
-				FROM submission s
-				INNER JOIN submission_field v ON (s.id = v.submission_id)
-				INNER JOIN survey_field f ON (f.id = v.field_id)
-			) sf ON (x.id = sf.survey_id)
-			WHERE x.id = ?`,
-			surveyId,
-		)
+		invites, err := app.Invites.ListBySurvey(r.Context(), surveyId)
 		if err != nil {
-			httpx.LogInternalError(w, "db.get_submissions", err)
+			httpx.LogInternalError(w, "db.get_invites", err)
 			return
 		}
-		defer rows.Close()
 
-		if !rows.Next() {
-			httpx.LogNotFound(w, "get_submissions", surveyId)
+		render.JSON(w, r, map[string]any{
+			"invites": invites,
+		})
+	}
+}
+
+func GetSurveySubmissions(app app.App) http.HandlerFunc {
+	exportCSV := ExportSurveySubmissionsCSV(app)
+	exportXLSX := ExportSurveySubmissionsXLSX(app)
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case accepts(r, "text/csv"):
+			exportCSV(w, r)
+			return
+		case accepts(r, export.XLSXContentType):
+			exportXLSX(w, r)
 			return
 		}
 
-		submissions := []model.Submission{}
-		var dummy *string
-		rows.Scan(&dummy, &dummy, &dummy, &dummy, &dummy, &dummy)
-		if dummy == nil {
-			render.JSON(w, r, map[string]any{
-				"submissions": submissions,
-			})
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
 			return
 		}
 
-		for {
-			s := model.Submission{}
-			f := model.SubmissionField{}
-			var value string
-
-			err = rows.Scan(&s.ID, &s.Time, &s.IP, &f.Name, &f.Label, &value)
-			if err != nil {
-				httpx.LogInternalError(w, "db.get_submissions.scan", err)
-				return
-			}
-			if s.ID == 0 {
-				break
-			}
-
-			err = json.Unmarshal([]byte(value), &f.Value)
-			if err != nil {
-				httpx.LogInternalError(w, "db.get_submissions.parse_value", err)
-				return
-			}
-
-			lastIdx := len(submissions) - 1
-			if lastIdx > -1 && submissions[lastIdx].ID == s.ID {
-				submissions[lastIdx].Fields[f.Name] = f
+		survey, err := app.Surveys.Get(r.Context(), surveyId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_submissions", surveyId)
 			} else {
-				s.Fields = map[string]model.SubmissionField{f.Name: f}
-				submissions = append(submissions, s)
+				httpx.LogInternalError(w, "db.get_survey", err)
 			}
+			return
+		}
 
-			if !rows.Next() {
-				break
+		submissions, err := app.Submissions.ListBySurvey(r.Context(), surveyId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_submissions", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.get_submissions", err)
 			}
+			return
+		}
+		for i := range submissions {
+			submissions[i].IP = app.Anonymizer.Redact(survey.PrivacyMode, submissions[i].IP)
 		}
 
 		render.JSON(w, r, map[string]any{
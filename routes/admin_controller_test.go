@@ -0,0 +1,230 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/model"
+)
+
+func colorSurvey() model.Survey {
+	return model.Survey{
+		ID:           1,
+		Version:      1,
+		Title:        "Colors",
+		Owner:        "alice",
+		WorkspaceID:  1,
+		DedupePolicy: model.DedupeIP,
+		PrivacyMode:  model.PrivacyFull,
+		Fields: []model.SurveyField{
+			{ID: 1, Type: "text", Name: "color", Label: "Favourite color", Required: true},
+		},
+	}
+}
+
+func TestCreateSurvey(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		want   int
+		wantID int
+	}{
+		{"created", `{"title": "Colors", "fields": [{"type": "text", "name": "color", "label": "Color"}]}`, http.StatusCreated, 2},
+		{"invalid body", `{"title": `, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surveys := newMemSurveys(colorSurvey())
+			a := app.App{Surveys: surveys}
+
+			r := asUser(request(http.MethodPost, "/surveys", tt.body), "bob", 1, auth.RoleEditor)
+			w := serve(CreateSurvey(a), "/surveys", r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.wantID == 0 {
+				return
+			}
+
+			res := struct {
+				ID int `json:"id"`
+			}{}
+			json.Unmarshal(w.Body.Bytes(), &res)
+			if res.ID != tt.wantID {
+				t.Errorf("id = %d, want %d", res.ID, tt.wantID)
+			}
+			if created := surveys.surveys[tt.wantID]; created.Title != "Colors" || len(created.Fields) != 1 || created.Owner != "bob" || created.WorkspaceID != 1 {
+				t.Errorf("stored survey = %+v", created)
+			}
+		})
+	}
+}
+
+func TestListSurveys(t *testing.T) {
+	second := colorSurvey()
+	second.ID, second.Title, second.Owner = 2, "Shapes", "bob"
+	elsewhere := colorSurvey()
+	elsewhere.ID, elsewhere.Title, elsewhere.WorkspaceID = 3, "Sizes", 2
+	tests := []struct {
+		name       string
+		username   string
+		workspace  int
+		roles      string
+		wantTitles []string
+	}{
+		{"admin sees all", "carol", 1, auth.RoleAdmin, []string{"Colors", "Shapes"}},
+		{"editor sees their own", "bob", 1, auth.RoleEditor, []string{"Shapes"}},
+		{"editor without surveys", "carol", 1, auth.RoleEditor, []string{}},
+		{"other workspace", "alice", 2, auth.RoleEditor, []string{"Sizes"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := app.App{Surveys: newMemSurveys(colorSurvey(), second, elsewhere)}
+
+			r := asUser(request(http.MethodGet, "/surveys", ""), tt.username, tt.workspace, tt.roles)
+			w := serve(ListSurveys(a), "/surveys", r)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			res := struct {
+				Surveys []model.Survey `json:"surveys"`
+			}{}
+			json.Unmarshal(w.Body.Bytes(), &res)
+			titles := []string{}
+			for _, survey := range res.Surveys {
+				titles = append(titles, survey.Title)
+			}
+			if !reflect.DeepEqual(titles, tt.wantTitles) {
+				t.Errorf("titles = %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+}
+
+func TestGetSurveyById(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"found", "/surveys/1", http.StatusOK},
+		{"missing", "/surveys/9", http.StatusNotFound},
+		{"invalid id", "/surveys/abc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := app.App{Surveys: newMemSurveys(colorSurvey())}
+
+			w := serve(GetSurveyById(a), "/surveys/{id}", request(http.MethodGet, tt.path, ""))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			survey := model.Survey{}
+			json.Unmarshal(w.Body.Bytes(), &survey)
+			if survey.Title != "Colors" || len(survey.Fields) != 1 || survey.Fields[0].Name != "color" {
+				t.Errorf("survey = %+v", survey)
+			}
+		})
+	}
+}
+
+func TestUpdateSurvey(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"updated", "/surveys/1", `{"version": 1, "title": "Colours", "fields": [{"id": 1, "type": "text", "name": "color", "label": "Colour"}]}`, http.StatusNoContent},
+		{"stale version", "/surveys/1", `{"version": 2, "title": "Colours", "fields": [{"id": 1, "type": "text", "name": "color", "label": "Colour"}]}`, http.StatusConflict},
+		{"invalid body", "/surveys/1", `{`, http.StatusBadRequest},
+		{"invalid id", "/surveys/abc", `{}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surveys := newMemSurveys(colorSurvey())
+			a := app.App{Surveys: surveys}
+
+			w := serve(UpdateSurvey(a), "/surveys/{id}", request(http.MethodPut, tt.path, tt.body))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusNoContent && surveys.surveys[1].Title != "Colours" {
+				t.Errorf("stored survey = %+v", surveys.surveys[1])
+			}
+		})
+	}
+}
+
+func TestDeleteSurvey(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"deleted", "/surveys/1", http.StatusNoContent},
+		{"missing", "/surveys/9", http.StatusNotFound},
+		{"invalid id", "/surveys/abc", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surveys := newMemSurveys(colorSurvey())
+			a := app.App{Surveys: surveys}
+
+			w := serve(DeleteSurvey(a), "/surveys/{id}", request(http.MethodDelete, tt.path, ""))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if _, ok := surveys.surveys[1]; ok == (tt.want == http.StatusNoContent) {
+				t.Errorf("survey 1 kept = %v", ok)
+			}
+		})
+	}
+}
+
+func TestGetSurveySubmissions(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		want      int
+		wantCount int
+	}{
+		{"listed", "/surveys/1/submissions", http.StatusOK, 2},
+		{"missing survey", "/surveys/9/submissions", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surveys := newMemSurveys(colorSurvey())
+			submissions := newMemSubmissions(surveys)
+			for _, ip := range []string{"192.0.2.1", "192.0.2.2"} {
+				submissions.Insert(context.Background(), 1, model.Submission{IP: ip, SurveyVersion: 1})
+			}
+			a := app.App{Surveys: surveys, Submissions: submissions}
+
+			w := serve(GetSurveySubmissions(a), "/surveys/{id}/submissions", request(http.MethodGet, tt.path, ""))
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			res := struct {
+				Submissions []model.Submission `json:"submissions"`
+			}{}
+			json.Unmarshal(w.Body.Bytes(), &res)
+			if len(res.Submissions) != tt.wantCount {
+				t.Errorf("got %d submissions, want %d", len(res.Submissions), tt.wantCount)
+			}
+		})
+	}
+}
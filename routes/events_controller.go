@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/events"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/stats"
+)
+
+const (
+	// Keeps proxies from closing idle streams
+	heartbeatInterval = 15 * time.Second
+	// Least time between two updates of the statistics
+	statsInterval = time.Second
+	// Deadline for each write to the stream, in place of the server WriteTimeout
+	eventWriteTimeout = 30 * time.Second
+)
+
+// Notifies live subscribers and webhooks of an event about a survey.
+// Webhook deliveries are queued, not sent, so this is cheap to call once changes are committed
+func publish(app app.App, surveyId int, e events.Event) {
+	app.Events.Publish(events.SurveyTopic(surveyId), e)
+	app.Dispatcher.Enqueue(surveyId, e)
+}
+
+// Streams the events about a survey as Server-Sent Events: new submissions and status changes.
+// With ?stats=true, updated statistics follow new submissions as "stats" events,
+// at most once per second
+func StreamSurveyEvents(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, fields, ok := getSurveyAllFields(app, w, r)
+		if !ok {
+			return
+		}
+		withStats, _ := strconv.ParseBool(r.URL.Query().Get("stats"))
+
+		// subscribe first, not to miss events while setting up
+		sub := app.Events.Subscribe(events.SurveyTopic(survey.ID))
+		defer sub.Close()
+
+		stream := newEventStream(w)
+		w.Header().Set("content-type", "text/event-stream")
+		w.Header().Set("cache-control", "no-cache")
+		w.Header().Set("x-accel-buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		sendStats := func() error {
+			summary, err := summarize(r.Context(), app, survey.ID, fields, stats.DefaultBins)
+			if err != nil {
+				return fmt.Errorf("db.get_stats: %w", err)
+			}
+			return stream.send("stats", 0, summary)
+		}
+
+		err := stream.comment("connected")
+		if err == nil && withStats {
+			err = sendStats()
+		}
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		statsTicker := time.NewTicker(statsInterval)
+		defer statsTicker.Stop()
+		statsStale := false
+
+		for err == nil {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-sub.Events():
+				if !ok {
+					// dropped for falling behind: the client will reconnect
+					log.Debugf("stream_events: subscriber dropped (%d)", survey.ID)
+					return
+				}
+				// submission IDs let clients tell where they left off
+				id := 0
+				if e.Type == events.SubmissionCreated {
+					id = e.ID
+				}
+				err = stream.send(e.Type, id, e.Data)
+				statsStale = statsStale || withStats && e.Type == events.SubmissionCreated
+			case <-statsTicker.C:
+				if statsStale {
+					err = sendStats()
+					statsStale = false
+				}
+			case <-heartbeat.C:
+				err = stream.comment("ping")
+			}
+		}
+		log.Debugf("stream_events: %s", err)
+	}
+}
+
+// Writes Server-Sent Events, each with its own write deadline
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newEventStream(w http.ResponseWriter) *eventStream {
+	return &eventStream{w, http.NewResponseController(w)}
+}
+
+func (s *eventStream) send(event string, id int, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	msg := "event: " + event + "\n"
+	if id > 0 {
+		msg += "id: " + strconv.Itoa(id) + "\n"
+	}
+	return s.write(msg + "data: " + string(payload) + "\n\n")
+}
+
+func (s *eventStream) comment(text string) error {
+	return s.write(": " + text + "\n\n")
+}
+
+func (s *eventStream) write(msg string) error {
+	err := s.rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write([]byte(msg))
+	if err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/export"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+)
+
+// Streams the submissions to a survey as CSV.
+// Column headers are field names, or labels with ?header=label
+func ExportSurveySubmissionsCSV(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, fields, ok := getSurveyAllFields(app, w, r)
+		if !ok {
+			return
+		}
+		header, ok := getExportHeader(w, r)
+		if !ok {
+			return
+		}
+
+		setAttachment(w, "text/csv; charset=utf-8", survey, "csv")
+		out, err := export.NewCSVWriter(w, fields, header)
+		streamExport(app, r, "export_csv", survey, out, err)
+	}
+}
+
+// Streams the submissions to a survey as an Excel workbook, with a codebook sheet.
+// Column headers are field names, or labels with ?header=label
+func ExportSurveySubmissionsXLSX(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, fields, ok := getSurveyAllFields(app, w, r)
+		if !ok {
+			return
+		}
+		header, ok := getExportHeader(w, r)
+		if !ok {
+			return
+		}
+
+		setAttachment(w, export.XLSXContentType, survey, "xlsx")
+		out, err := export.NewXLSXWriter(w, fields, header)
+		streamExport(app, r, "export_xlsx", survey, out, err)
+	}
+}
+
+// Streams the submissions to a survey as an SPSS system file
+func ExportSurveySubmissionsSAV(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, fields, ok := getSurveyAllFields(app, w, r)
+		if !ok {
+			return
+		}
+
+		setAttachment(w, export.SAVContentType, survey, "sav")
+		out, err := export.NewSAVWriter(w, survey, fields)
+		streamExport(app, r, "export_sav", survey, out, err)
+	}
+}
+
+// Streams the submissions to a survey as a zip archive with a CSV file,
+// its schema and an R script to load them with the right types and factor levels
+func ExportSurveySubmissionsR(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, fields, ok := getSurveyAllFields(app, w, r)
+		if !ok {
+			return
+		}
+
+		setAttachment(w, "application/zip", survey, "r.zip")
+		out, err := export.NewRWriter(w, survey, fields)
+		streamExport(app, r, "export_r", survey, out, err)
+	}
+}
+
+// Writes every submission to the survey through out, with IPs redacted as the survey requires.
+// The error is the one returned when creating out
+func streamExport(app app.App, r *http.Request, code string, survey model.Survey, out export.Writer, err error) {
+	if err != nil {
+		log.Errorf("%s.header: %s", code, err)
+		return
+	}
+
+	err = app.Submissions.Each(r.Context(), survey.ID, func(s model.Submission) error {
+		s.IP = app.Anonymizer.Redact(survey.PrivacyMode, s.IP)
+		return out.Write(s)
+	})
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		// the response is already underway: the best we can do is truncate it
+		log.Errorf("%s: %s", code, err)
+	}
+}
+
+// Reads the header style from the query, defaulting to field names.
+// Will send an error response and return false if invalid
+func getExportHeader(w http.ResponseWriter, r *http.Request) (string, bool) {
+	header := r.URL.Query().Get("header")
+	switch header {
+	case "":
+		return export.HeaderName, true
+	case export.HeaderName, export.HeaderLabel:
+		return header, true
+	}
+	httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.get_query_param.header", "header must be %q or %q", export.HeaderName, export.HeaderLabel)
+	return "", false
+}
+
+// Loads a survey with all of its fields, including retired ones.
+// Will send an error response and return false on failure
+func getSurveyAllFields(app app.App, w http.ResponseWriter, r *http.Request) (model.Survey, []model.SurveyField, bool) {
+	surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+		return model.Survey{}, nil, false
+	}
+
+	survey, err := app.Surveys.Get(r.Context(), surveyId)
+	if err == nil {
+		survey.Fields, err = app.Surveys.AllFields(r.Context(), surveyId)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpx.LogNotFound(w, "get_survey_fields", surveyId)
+		} else {
+			httpx.LogInternalError(w, "db.get_survey", err)
+		}
+		return survey, nil, false
+	}
+	return survey, survey.Fields, true
+}
+
+// Sets the headers to download the response as a file named after the survey
+func setAttachment(w http.ResponseWriter, contentType string, survey model.Survey, ext string) {
+	w.Header().Set("content-type", contentType)
+	w.Header().Set("content-disposition", fmt.Sprintf(`attachment; filename="survey-%d.%s"`, survey.ID, ext))
+}
+
+// Tells whether the client asked for the given content type
+func accepts(r *http.Request, contentType string) bool {
+	return strings.Contains(r.Header.Get("accept"), contentType)
+}
@@ -0,0 +1,140 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
+)
+
+// Creates an empty group of members of the active workspace, to share surveys with.
+// Group names are unique within the workspace
+func CreateGroup(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Name string `json:"name"`
+		}{}
+		err := render.DecodeJSON(r.Body, &body)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+
+		if errs := validation.GroupName(body.Name); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
+			return
+		}
+
+		err = app.Groups.Create(r.Context(), auth.ClaimedWorkspace(r), body.Name)
+		if err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "db.insert_group.conflict", "group %q already exists", body.Name)
+			} else {
+				httpx.LogInternalError(w, "db.insert_group", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, map[string]any{"name": body.Name})
+	}
+}
+
+func ListGroups(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groups, err := app.Groups.List(r.Context(), auth.ClaimedWorkspace(r))
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_groups", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"groups": groups,
+		})
+	}
+}
+
+func GetGroup(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "group")
+
+		group, err := app.Groups.Get(r.Context(), auth.ClaimedWorkspace(r), name)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_group", name)
+			} else {
+				httpx.LogInternalError(w, "db.get_group", err)
+			}
+			return
+		}
+
+		render.JSON(w, r, group)
+	}
+}
+
+// Deletes a group, revoking the access to surveys granted to it
+func DeleteGroup(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "group")
+
+		err := app.Groups.Delete(r.Context(), auth.ClaimedWorkspace(r), name)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "delete_group", name)
+			} else {
+				httpx.LogInternalError(w, "db.delete_group", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Adds a member of the active workspace to a group
+func AddGroupMember(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, username := chi.URLParam(r, "group"), chi.URLParam(r, "username")
+
+		if !checkMember(app, w, r, username) {
+			return
+		}
+
+		err := app.Groups.AddMember(r.Context(), auth.ClaimedWorkspace(r), name, username)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "add_member", []string{name, username})
+			} else {
+				httpx.LogInternalError(w, "db.add_member", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RemoveGroupMember(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name, username := chi.URLParam(r, "group"), chi.URLParam(r, "username")
+
+		err := app.Groups.RemoveMember(r.Context(), auth.ClaimedWorkspace(r), name, username)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "remove_member", []string{name, username})
+			} else {
+				httpx.LogInternalError(w, "db.remove_member", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
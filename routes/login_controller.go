@@ -9,10 +9,13 @@ import (
 	"strings"
 
 	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
 	"github.com/mbolis/quick-survey/httpx"
 	"github.com/mbolis/quick-survey/log"
 )
 
+// Logs in to the workspace given by the ?workspace query parameter,
+// or else to the first the user is a member of
 func Login(app app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user, pass, ok := r.BasicAuth()
@@ -26,6 +29,14 @@ func Login(app app.App) http.HandlerFunc {
 			"username":   {user},
 			"password":   {pass},
 		}
+		if workspace := r.URL.Query().Get("workspace"); workspace != "" {
+			workspaceId, err := strconv.Atoi(workspace)
+			if err != nil {
+				httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "login.workspace")
+				return
+			}
+			body.Set("scope", auth.WorkspaceScope(workspaceId))
+		}
 		r.Body = io.NopCloser(strings.NewReader(body.Encode()))
 		r.Header.Set("content-type", "application/x-www-form-urlencoded")
 		r.Header.Set("content-length", strconv.Itoa(len(body.Encode())))
@@ -1,56 +1,227 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/oauth"
 	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
 	"github.com/mbolis/quick-survey/httpx"
 	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
 )
 
-func Default(next http.Handler) http.Handler {
-	return chi.Chain(middleware.RequestLogger(logFormatter), middleware.Recoverer).Handler(next)
+func Default(app app.App) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return chi.Chain(ClientIP(app), middleware.RequestLogger(logFormatter), middleware.Recoverer).Handler(next)
+	}
 }
 
 var logFormatter = &middleware.DefaultLogFormatter{
 	Logger: log.Logger(),
 }
 
-// Admin middleware to check for the 'admin' role in an OAuth token.
-func Admin(app app.App) func(next http.Handler) http.Handler {
+// ClientIP middleware to resolve the client address, taking trusted reverse proxies into account.
+// The remote address of the request is replaced, so that it gets logged.
+func ClientIP(app app.App) func(next http.Handler) http.Handler {
+	resolver := httpx.NewClientIPResolver(app.TrustedProxies)
+
 	return func(next http.Handler) http.Handler {
-		return chi.Chain(oauth.Authorize(app.TokenSecret, nil), admin).Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolver.Resolve(r)
+			r = httpx.WithClientIP(r, ip)
+			r.RemoteAddr = ip
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
-func admin(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		claims := r.Context().Value(oauth.ClaimsContext).(map[string]string)
-
-		isAdmin := false
-		if rolesClaim, ok := claims["roles"]; ok {
-			roles := strings.Split(rolesClaim, ",")
-			for _, role := range roles {
-				if role == "admin" {
-					isAdmin = true
-					break
+// Authenticate middleware to check for a valid OAuth token.
+func Authenticate(app app.App) func(next http.Handler) http.Handler {
+	return oauth.Authorize(app.TokenSecret, nil)
+}
+
+// Authorize middleware to check for a valid OAuth token, whose roles grant the given permission.
+func Authorize(app app.App, p auth.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return chi.Chain(Authenticate(app), Require(p)).Handler(next)
+	}
+}
+
+// Require middleware to check that the roles in the active workspace, claimed by an authenticated token,
+// grant the given permission.
+func Require(p auth.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.Can(auth.ClaimedRoles(r), p) {
+				httpx.LogStatus(w, http.StatusForbidden, log.DebugLevel, "authorize."+string(p))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUser middleware to check that the deployment role, claimed by an authenticated token,
+// grants the given permission.
+func RequireUser(p auth.Permission) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !auth.Can(auth.ClaimedUserRole(r), p) {
+				httpx.LogStatus(w, http.StatusForbidden, log.DebugLevel, "authorize_user."+string(p))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// SurveyAccess middleware to check that the survey in the URL belongs to the active workspace,
+// and that the authenticated user has at least the given access to it, unless their roles grant access to every survey.
+// Surveys the user has no access to are reported as not found
+func SurveyAccess(app app.App, need string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+			if err != nil {
+				httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+				return
+			}
+
+			access, err := app.Shares.Access(r.Context(), auth.ClaimedWorkspace(r), surveyId, auth.Username(r))
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					httpx.LogNotFound(w, "survey_access", surveyId)
+				} else {
+					httpx.LogInternalError(w, "db.get_access", err)
 				}
+				return
 			}
-		}
 
-		if !isAdmin {
-			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
-			return
-		}
+			if !auth.Can(auth.ClaimedRoles(r), auth.SurveyAll) {
+				if access == "" {
+					httpx.LogNotFound(w, "survey_access", surveyId)
+					return
+				}
+				if !model.AccessIncludes(access, need) {
+					httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "survey_access."+need, "you need %s access to this survey", need)
+					return
+				}
+			}
 
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// WebhookAccess middleware to check that the webhook in the URL belongs to the active workspace
+func WebhookAccess(app app.App) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			webhookId, err := strconv.Atoi(chi.URLParam(r, "id"))
+			if err != nil {
+				httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+				return
+			}
+
+			webhook, err := app.Webhooks.Get(r.Context(), webhookId)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				httpx.LogInternalError(w, "db.get_webhook", err)
+				return
+			}
+			if err != nil || webhook.WorkspaceID != auth.ClaimedWorkspace(r) {
+				httpx.LogNotFound(w, "webhook_access", webhookId)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GroupAccess middleware to check that the group in the URL belongs to the active workspace
+func GroupAccess(app app.App) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name := chi.URLParam(r, "group")
+
+			_, err := app.Groups.Get(r.Context(), auth.ClaimedWorkspace(r), name)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					httpx.LogNotFound(w, "group_access", name)
+				} else {
+					httpx.LogInternalError(w, "db.get_group", err)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// OptionalAuth middleware to identify the user from an OAuth token, if any, in the request header
+// or, for GET requests only, in the access_token cookie. Requests without a valid token are let through anonymously.
+func OptionalAuth(app app.App) func(next http.Handler) http.Handler {
+	provider := oauth.NewTokenProvider(oauth.NewSHA256RC4TokenSecurityProvider([]byte(app.TokenSecret)))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var accessToken string
+			if match := reBearer.FindStringSubmatch(r.Header.Get("authorization")); match != nil {
+				accessToken = match[1]
+			} else if r.Method == http.MethodGet {
+				// the cookie goes along with cross-site requests too: those that change anything
+				// must carry the token in the header, so that other pages cannot make them on behalf of the user
+				if cookie, err := r.Cookie("access_token"); err == nil {
+					accessToken = cookie.Value
+				}
+			}
+			if accessToken == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, err := provider.DecryptToken(accessToken)
+			if err != nil || time.Now().UTC().After(token.CreationDate.Add(token.ExpiresIn)) {
+				log.Debug("optional_auth.invalid_token")
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			ctx = context.WithValue(ctx, oauth.CredentialContext, token.Credential)
+			ctx = context.WithValue(ctx, oauth.ClaimsContext, token.Claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+var reBearer = regexp.MustCompile(`(?i)^bearer\s+(.*)`)
+
+// BearerFromCookie middleware to authorize GET requests without an Authorization header
+// by the access_token cookie, for clients that cannot set headers such as EventSource and links.
+// Other methods are left alone, so that cookies cannot be abused by cross-site requests.
+func BearerFromCookie(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.Header.Get("authorization") == "" {
+			if cookie, err := r.Cookie("access_token"); err == nil {
+				r.Header.Set("authorization", "Bearer "+cookie.Value)
+			}
+		}
 		next.ServeHTTP(w, r)
 	})
 }
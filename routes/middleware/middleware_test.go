@@ -0,0 +1,272 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/oauth"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/config"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+)
+
+// Token of the user making a request
+type claims struct {
+	username  string
+	workspace int
+	roles     string
+	userRole  string
+}
+
+// Serves a request to path through a router that applies the middleware to pattern,
+// and returns the response status
+func serve(t *testing.T, c claims, pattern, path string, mw func(http.Handler) http.Handler) int {
+	t.Helper()
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), oauth.CredentialContext, c.username)
+			ctx = context.WithValue(ctx, oauth.ClaimsContext, map[string]string{
+				auth.ClaimRoles:     c.roles,
+				auth.ClaimWorkspace: strconv.Itoa(c.workspace),
+				auth.ClaimUserRole:  c.userRole,
+			})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	r.With(mw).Get(pattern, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+func TestRequire(t *testing.T) {
+	tests := []struct {
+		roles string
+		p     auth.Permission
+		want  int
+	}{
+		{auth.RoleViewer, auth.SurveyRead, http.StatusOK},
+		{auth.RoleViewer, auth.SurveyWrite, http.StatusForbidden},
+		{auth.RoleAnalyst, auth.SubmissionsRead, http.StatusOK},
+		{auth.RoleEditor, auth.SurveyWrite, http.StatusOK},
+		{auth.RoleEditor, auth.MembersManage, http.StatusForbidden},
+		{auth.RoleAdmin, auth.WebhooksManage, http.StatusOK},
+		{"", auth.SurveyRead, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.roles+" "+string(tt.p), func(t *testing.T) {
+			c := claims{username: "alice", workspace: 1, roles: tt.roles}
+			if got := serve(t, c, "/", "/", Require(tt.p)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	tests := []struct {
+		name            string
+		roles, userRole string
+		want            int
+	}{
+		{"deployment admin", auth.RoleViewer, auth.RoleAdmin, http.StatusOK},
+		{"deployment editor", auth.RoleViewer, auth.RoleEditor, http.StatusForbidden},
+		// the role in the workspace does not count
+		{"workspace owner only", auth.RoleOwner, auth.RoleViewer, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := claims{username: "alice", workspace: 1, roles: tt.roles, userRole: tt.userRole}
+			if got := serve(t, c, "/", "/", RequireUser(auth.UsersManage)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	a := app.App{Config: config.Config{TokenSecret: "secret"}}
+	provider := oauth.NewTokenProvider(oauth.NewSHA256RC4TokenSecurityProvider([]byte(a.TokenSecret)))
+	token, err := provider.CryptToken(&oauth.Token{
+		CreationDate: time.Now().UTC(),
+		ExpiresIn:    time.Hour,
+		Credential:   "alice",
+		Claims:       map[string]string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		cookie string
+		want   string
+	}{
+		{"anonymous", http.MethodGet, "", "", ""},
+		{"header", http.MethodPost, "Bearer " + token, "", "alice"},
+		{"cookie on GET", http.MethodGet, "", token, "alice"},
+		{"cookie on POST", http.MethodPost, "", token, ""},
+		{"invalid token", http.MethodGet, "Bearer garbage", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := OptionalAuth(a)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = r.Context().Value(oauth.CredentialContext).(string)
+			}))
+
+			r := httptest.NewRequest(tt.method, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "access_token", Value: tt.cookie})
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("credential = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+var errStore = errors.New("store failure")
+
+// Survey 1 is in workspace 1, owned by alice and shared with bob for viewing; survey 2 is in workspace 2.
+// Survey 3 fails to load
+type fakeShares struct {
+	store.ShareStore
+}
+
+func (fakeShares) Access(ctx context.Context, workspaceId int, surveyId int, username string) (string, error) {
+	surveys := map[int]int{1: 1, 2: 2}
+	access := map[string]string{"alice": model.AccessOwner, "bob": model.AccessView}
+	if surveyId == 3 {
+		return "", errStore
+	}
+	if surveys[surveyId] != workspaceId {
+		return "", store.ErrNotFound
+	}
+	return access[username], nil
+}
+
+func TestSurveyAccess(t *testing.T) {
+	a := app.App{Shares: fakeShares{}}
+	tests := []struct {
+		name string
+		claims
+		path string
+		need string
+		want int
+	}{
+		{"owner", claims{"alice", 1, auth.RoleEditor, ""}, "/surveys/1", model.AccessOwner, http.StatusOK},
+		{"shared for viewing", claims{"bob", 1, auth.RoleEditor, ""}, "/surveys/1", model.AccessView, http.StatusOK},
+		{"shared for viewing, editing", claims{"bob", 1, auth.RoleEditor, ""}, "/surveys/1", model.AccessEdit, http.StatusForbidden},
+		{"not shared", claims{"carol", 1, auth.RoleEditor, ""}, "/surveys/1", model.AccessView, http.StatusNotFound},
+		{"admin, not shared", claims{"carol", 1, auth.RoleAdmin, ""}, "/surveys/1", model.AccessOwner, http.StatusOK},
+		{"owner in another workspace", claims{"alice", 2, auth.RoleEditor, ""}, "/surveys/1", model.AccessView, http.StatusNotFound},
+		{"admin in another workspace", claims{"carol", 2, auth.RoleAdmin, ""}, "/surveys/1", model.AccessView, http.StatusNotFound},
+		{"missing survey", claims{"alice", 1, auth.RoleAdmin, ""}, "/surveys/9", model.AccessView, http.StatusNotFound},
+		{"invalid id", claims{"alice", 1, auth.RoleAdmin, ""}, "/surveys/abc", model.AccessView, http.StatusBadRequest},
+		{"store failure", claims{"alice", 1, auth.RoleAdmin, ""}, "/surveys/3", model.AccessView, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(t, tt.claims, "/surveys/{id}", tt.path, SurveyAccess(a, tt.need)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// Webhook 1 is in workspace 1, webhook 2 in workspace 2; webhook 3 fails to load
+type fakeWebhooks struct {
+	store.WebhookStore
+}
+
+func (fakeWebhooks) Get(ctx context.Context, id int) (model.Webhook, error) {
+	switch id {
+	case 1, 2:
+		return model.Webhook{ID: id, WorkspaceID: id}, nil
+	case 3:
+		return model.Webhook{}, errStore
+	}
+	return model.Webhook{}, store.ErrNotFound
+}
+
+func TestWebhookAccess(t *testing.T) {
+	a := app.App{Webhooks: fakeWebhooks{}}
+	tests := []struct {
+		name      string
+		workspace int
+		path      string
+		want      int
+	}{
+		{"same workspace", 1, "/webhooks/1", http.StatusOK},
+		{"other workspace", 1, "/webhooks/2", http.StatusNotFound},
+		{"missing webhook", 1, "/webhooks/9", http.StatusNotFound},
+		{"invalid id", 1, "/webhooks/abc", http.StatusBadRequest},
+		{"store failure", 1, "/webhooks/3", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := claims{"alice", tt.workspace, auth.RoleAdmin, ""}
+			if got := serve(t, c, "/webhooks/{id}", tt.path, WebhookAccess(a)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// Both workspaces have a group named "staff"; only workspace 1 has "sales", and "broken" fails to load
+type fakeGroups struct {
+	store.GroupStore
+}
+
+func (fakeGroups) Get(ctx context.Context, workspaceId int, name string) (model.Group, error) {
+	switch {
+	case name == "broken":
+		return model.Group{}, errStore
+	case name == "staff", name == "sales" && workspaceId == 1:
+		return model.Group{Name: name, WorkspaceID: workspaceId}, nil
+	}
+	return model.Group{}, store.ErrNotFound
+}
+
+func TestGroupAccess(t *testing.T) {
+	a := app.App{Groups: fakeGroups{}}
+	tests := []struct {
+		name      string
+		workspace int
+		path      string
+		want      int
+	}{
+		{"own group", 1, "/groups/sales", http.StatusOK},
+		{"group of another workspace", 2, "/groups/sales", http.StatusNotFound},
+		{"same name in each workspace", 2, "/groups/staff", http.StatusOK},
+		{"missing group", 1, "/groups/nobody", http.StatusNotFound},
+		{"store failure", 1, "/groups/broken", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := claims{"alice", tt.workspace, auth.RoleAdmin, ""}
+			if got := serve(t, c, "/groups/{group}", tt.path, GroupAccess(a)); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
+)
+
+// Lists the addresses notified of the submissions to a survey
+func ListSurveySubscribers(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		_, err = app.Surveys.Get(r.Context(), surveyId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_survey", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.get_survey", err)
+			}
+			return
+		}
+
+		subscribers, err := app.Notifications.ListSubscribers(r.Context(), surveyId)
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_subscribers", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"subscribers": subscribers,
+			"enabled":     app.Notifier.Enabled(),
+		})
+	}
+}
+
+// Subscribes an address to the submissions to a survey, one email each ("instant", the default)
+// or in a daily "digest". Subscribing again changes the mode
+func AddSurveySubscriber(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		sub := model.Subscriber{Mode: model.SubscribeInstant}
+		err = render.DecodeJSON(r.Body, &sub)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+		sub.Email = strings.TrimSpace(sub.Email)
+
+		if errs := validation.Subscriber(sub); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
+			return
+		}
+
+		err = app.Notifications.Subscribe(r.Context(), surveyId, sub.Email, sub.Mode)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "subscribe", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.subscribe", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RemoveSurveySubscriber(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+		email := chi.URLParam(r, "email")
+
+		err = app.Notifications.Unsubscribe(r.Context(), surveyId, email)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "unsubscribe", email)
+			} else {
+				httpx.LogInternalError(w, "db.unsubscribe", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,464 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/events"
+	"github.com/mbolis/quick-survey/export"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/stats"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
+)
+
+// Presentation state as shown to presenters and respondents
+type presentationView struct {
+	model.Presentation
+	Title string `json:"title"`
+	// Position of the current question, and number of questions
+	Index int               `json:"index"`
+	Count int               `json:"count"`
+	Field model.SurveyField `json:"field"`
+	// Answers to the current question, only when shown
+	Results *presentationResults `json:"results,omitempty"`
+	// Whether the respondent answered the current question already
+	Submitted bool `json:"submitted,omitempty"`
+}
+
+type presentationResults struct {
+	*stats.Field
+	// Most frequent terms, for text questions
+	Terms []stats.Term `json:"terms,omitempty"`
+}
+
+const maxPresentationTerms = 50
+
+// Loads the presentation of a survey, with the results of the current question if shown or forced.
+// A presentation whose current question was removed from the survey is not found
+func loadPresentation(ctx context.Context, app app.App, survey model.Survey, withResults bool) (presentationView, error) {
+	p, err := app.Presentations.Get(ctx, survey.ID)
+	if err != nil {
+		return presentationView{}, err
+	}
+
+	view := presentationView{Presentation: p, Title: survey.Title, Index: -1, Count: len(survey.Fields)}
+	for i, f := range survey.Fields {
+		if f.ID == p.FieldID {
+			view.Index, view.Field = i, f
+		}
+	}
+	if view.Index < 0 {
+		return view, store.ErrNotFound
+	}
+
+	if withResults || p.ShowResults {
+		view.Results, err = questionResults(ctx, app, view.Field)
+	}
+	return view, err
+}
+
+func questionResults(ctx context.Context, app app.App, field model.SurveyField) (*presentationResults, error) {
+	summary := stats.NewSummary([]model.SurveyField{field}, stats.DefaultBins)
+	var words *stats.WordCounter
+	if field.Type == "text" || field.Type == "textarea" {
+		words, _ = stats.NewWordCounter(stats.WordOptions{Languages: []string{"it", "en"}, Limit: maxPresentationTerms})
+	}
+
+	answers, err := app.Presentations.ListAnswers(ctx, field.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range answers {
+		summary.Add(model.Submission{Fields: map[string]model.SubmissionField{
+			field.Name: {ID: field.ID, Name: field.Name, Value: a.Value},
+		}})
+		if words != nil && !stats.IsEmpty(a.Value) {
+			words.Add(export.Text(a.Value))
+		}
+	}
+
+	results := &presentationResults{Field: summary.Finish().Fields[0]}
+	if words != nil {
+		results.Terms = words.Terms()
+	}
+	return results, nil
+}
+
+// Loads the survey in the URL, or writes an error response and returns false
+func getPresentedSurvey(app app.App, w http.ResponseWriter, r *http.Request) (model.Survey, bool) {
+	surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+		return model.Survey{}, false
+	}
+
+	survey, err := app.Surveys.Get(r.Context(), surveyId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpx.LogNotFound(w, "get_survey", surveyId)
+		} else {
+			httpx.LogInternalError(w, "db.get_survey", err)
+		}
+		return survey, false
+	}
+	return survey, true
+}
+
+func logPresentationError(w http.ResponseWriter, surveyId int, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		httpx.LogNotFound(w, "get_presentation", surveyId)
+	} else {
+		httpx.LogInternalError(w, "db.get_presentation", err)
+	}
+}
+
+// Saves the presentation and notifies presenters and respondents
+func savePresentation(ctx context.Context, app app.App, p model.Presentation) error {
+	err := app.Presentations.Save(ctx, p)
+	if err != nil {
+		return err
+	}
+	app.Events.Publish(events.SurveyTopic(p.SurveyID), events.Event{Type: events.PresentationChanged, Data: p})
+	return nil
+}
+
+// Starts presenting an open survey from its first question
+func StartPresentation(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, ok := getPresentedSurvey(app, w, r)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		if survey.Status != model.StatusOpen || survey.NotYetOpen(now) || survey.PastClose(now) {
+			httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "presentation.survey_not_open", "survey must be open to be presented")
+			return
+		}
+		if len(survey.Fields) == 0 {
+			httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "presentation.no_fields", "survey has no questions")
+			return
+		}
+
+		err := savePresentation(r.Context(), app, model.Presentation{SurveyID: survey.ID, FieldID: survey.Fields[0].ID})
+		if err != nil {
+			httpx.LogInternalError(w, "db.save_presentation", err)
+			return
+		}
+
+		view, err := loadPresentation(r.Context(), app, survey, true)
+		if err != nil {
+			logPresentationError(w, survey.ID, err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, view)
+	}
+}
+
+// Shows the presentation state to the presenter,
+// always with the results of the current question if their roles allow reading them
+func GetPresentation(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, ok := getPresentedSurvey(app, w, r)
+		if !ok {
+			return
+		}
+
+		withResults := auth.Can(auth.ClaimedRoles(r), auth.SubmissionsRead)
+		view, err := loadPresentation(r.Context(), app, survey, withResults)
+		if err != nil {
+			logPresentationError(w, survey.ID, err)
+			return
+		}
+		render.JSON(w, r, view)
+	}
+}
+
+// Moves the presentation to the question at the given index, and shows or hides its results.
+// Body: {"index": 2, "show_results": true}, both optional
+func UpdatePresentation(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, ok := getPresentedSurvey(app, w, r)
+		if !ok {
+			return
+		}
+		view, err := loadPresentation(r.Context(), app, survey, false)
+		if err != nil {
+			logPresentationError(w, survey.ID, err)
+			return
+		}
+
+		body := struct {
+			Index       *int  `json:"index"`
+			ShowResults *bool `json:"show_results"`
+		}{}
+		err = render.DecodeJSON(r.Body, &body)
+		if err != nil && !errors.Is(err, io.EOF) {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+
+		p := view.Presentation
+		if body.Index != nil && *body.Index != view.Index {
+			if *body.Index < 0 || *body.Index >= len(survey.Fields) {
+				httpx.LogInvalid(w, "request.validate", validation.Errors{{Path: "index", Message: "no such question"}})
+				return
+			}
+			p.FieldID = survey.Fields[*body.Index].ID
+			p.ShowResults = false
+		}
+		if body.ShowResults != nil {
+			p.ShowResults = *body.ShowResults
+		}
+
+		movePresentation(app, w, r, survey, p)
+	}
+}
+
+// Moves the presentation by step questions, hiding the results
+func StepPresentation(app app.App, step int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, ok := getPresentedSurvey(app, w, r)
+		if !ok {
+			return
+		}
+		view, err := loadPresentation(r.Context(), app, survey, false)
+		if err != nil {
+			logPresentationError(w, survey.ID, err)
+			return
+		}
+
+		index := view.Index + step
+		if index < 0 || index >= len(survey.Fields) {
+			httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "presentation.out_of_questions", "no more questions")
+			return
+		}
+
+		p := view.Presentation
+		p.FieldID = survey.Fields[index].ID
+		p.ShowResults = false
+		movePresentation(app, w, r, survey, p)
+	}
+}
+
+func movePresentation(app app.App, w http.ResponseWriter, r *http.Request, survey model.Survey, p model.Presentation) {
+	err := savePresentation(r.Context(), app, p)
+	if err != nil {
+		httpx.LogInternalError(w, "db.save_presentation", err)
+		return
+	}
+
+	view, err := loadPresentation(r.Context(), app, survey, true)
+	if err != nil {
+		logPresentationError(w, survey.ID, err)
+		return
+	}
+	render.JSON(w, r, view)
+}
+
+// Ends the presentation, closing the streams of presenters and respondents.
+// The answers stay stored, apart from the survey submissions
+func StopPresentation(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		err = app.Presentations.Delete(r.Context(), surveyId)
+		if err != nil {
+			logPresentationError(w, surveyId, err)
+			return
+		}
+		app.Events.Publish(events.SurveyTopic(surveyId), events.Event{
+			Type: events.PresentationEnded,
+			Data: map[string]any{"survey_id": surveyId},
+		})
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Shows the current question of a presentation to respondents and to the public presenter page
+func PublicGetPresentation(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, ok := getPresentedSurvey(app, w, r)
+		if !ok || !checkAvailable(w, survey) {
+			return
+		}
+
+		view, err := loadPresentation(r.Context(), app, survey, false)
+		if err != nil {
+			logPresentationError(w, survey.ID, err)
+			return
+		}
+
+		respondentKey, ok := identifyRespondent(w, r, app, survey)
+		if !ok {
+			return
+		}
+		if respondentKey != "" {
+			view.Submitted, err = app.Presentations.Answered(r.Context(), view.FieldID, respondentKey)
+			if err != nil {
+				httpx.LogInternalError(w, "db.get_respondent", err)
+				return
+			}
+		}
+
+		render.JSON(w, r, view)
+	}
+}
+
+// Records an answer to the current question of a presentation, in the same format as a submission.
+// Answers are not survey submissions: they only reach the presentation streams, once per respondent and question
+func PublicAnswerPresentation(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		submission := model.Submission{}
+		err := render.DecodeJSON(r.Body, &submission)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+
+		survey, ok := getPresentedSurvey(app, w, r)
+		if !ok || !checkAvailable(w, survey) {
+			return
+		}
+		view, err := loadPresentation(r.Context(), app, survey, false)
+		if err != nil {
+			logPresentationError(w, survey.ID, err)
+			return
+		}
+
+		for _, answer := range submission.Fields {
+			if answer.ID != view.FieldID {
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "presentation.question_closed", "question no longer open")
+				return
+			}
+		}
+		if errs := validation.Answer(view.Field, &submission); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
+			return
+		}
+
+		answer := model.PresentationAnswer{SurveyID: survey.ID, FieldID: view.FieldID, Time: time.Now()}
+		for _, f := range submission.Fields {
+			answer.Value = f.Value
+		}
+		answer.RespondentKey, ok = identifyRespondent(w, r, app, survey)
+		if !ok {
+			return
+		}
+		answer.IP, err = app.Anonymizer.IP(survey.PrivacyMode, httpx.ClientIP(r))
+		if err != nil {
+			httpx.LogInternalError(w, "privacy.anonymize_ip", err)
+			return
+		}
+
+		answer.ID, err = app.Presentations.InsertAnswer(r.Context(), answer)
+		if err != nil {
+			if errors.Is(err, store.ErrDuplicate) {
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "respondent.already_answered", "you already answered this question")
+			} else {
+				httpx.LogInternalError(w, "db.insert_answer", err)
+			}
+			return
+		}
+		app.Events.Publish(events.SurveyTopic(survey.ID), events.Event{Type: events.PresentationAnswered, ID: answer.ID, Data: answer})
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, map[string]any{
+			"id": answer.ID,
+		})
+	}
+}
+
+// Streams the presentation to the public presenter page and to respondents, as Server-Sent Events:
+// "presentation" events carry the state whenever it changes, "results" events follow new answers
+// to the current question while its results are shown, and "ended" closes the stream
+func PublicStreamPresentation(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, ok := getPresentedSurvey(app, w, r)
+		if !ok || !checkAvailable(w, survey) {
+			return
+		}
+
+		sub := app.Events.Subscribe(events.SurveyTopic(survey.ID))
+		defer sub.Close()
+
+		view, err := loadPresentation(r.Context(), app, survey, false)
+		if err != nil {
+			logPresentationError(w, survey.ID, err)
+			return
+		}
+
+		stream := newEventStream(w)
+		w.Header().Set("content-type", "text/event-stream")
+		w.Header().Set("cache-control", "no-cache")
+		w.Header().Set("x-accel-buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		err = stream.send("presentation", 0, view)
+
+		heartbeat := time.NewTicker(heartbeatInterval)
+		defer heartbeat.Stop()
+		resultsTicker := time.NewTicker(statsInterval)
+		defer resultsTicker.Stop()
+		resultsStale := false
+
+		for err == nil {
+			select {
+			case <-r.Context().Done():
+				return
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				switch e.Type {
+				case events.PresentationChanged:
+					// the survey may have been edited in the meantime
+					survey, err = app.Surveys.Get(r.Context(), survey.ID)
+					if err == nil {
+						view, err = loadPresentation(r.Context(), app, survey, false)
+					}
+					if err == nil {
+						err = stream.send("presentation", 0, view)
+						resultsStale = false
+					}
+				case events.PresentationEnded:
+					err = stream.send("ended", 0, e.Data)
+					if err == nil {
+						return
+					}
+				case events.PresentationAnswered:
+					resultsStale = view.ShowResults
+				}
+			case <-resultsTicker.C:
+				if resultsStale {
+					var results *presentationResults
+					results, err = questionResults(r.Context(), app, view.Field)
+					if err == nil {
+						err = stream.send("results", 0, results)
+					}
+					resultsStale = false
+				}
+			case <-heartbeat.C:
+				err = stream.comment("ping")
+			}
+		}
+		log.Debugf("stream_presentation: %s", err)
+	}
+}
@@ -1,20 +1,20 @@
 package routes
 
 import (
-	"database/sql"
-	"encoding/json"
 	"errors"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/events"
 	"github.com/mbolis/quick-survey/httpx"
 	"github.com/mbolis/quick-survey/log"
 	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
 )
 
 func PublicGetSurveyById(app app.App) http.HandlerFunc {
@@ -25,101 +25,68 @@ func PublicGetSurveyById(app app.App) http.HandlerFunc {
 			return
 		}
 
-		rows, err := app.QueryContext(r.Context(), `
-			SELECT
-				s.title, s.description,
-				sub.ip,
-				f.id, f.type, f.name, f.label, f.required, f.options
-			FROM survey s
-			LEFT OUTER JOIN submission sub ON (s.id = sub.survey_id)
-			LEFT OUTER JOIN survey_field f ON (s.id = f.survey_id)
-			WHERE s.id = ?`,
-			surveyId,
-		)
+		survey, err := app.Surveys.Get(r.Context(), surveyId)
 		if err != nil {
-			httpx.LogInternalError(w, "db.get_survey", err)
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_survey", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.get_survey", err)
+			}
 			return
 		}
-		defer rows.Close()
 
-		if !rows.Next() {
-			httpx.LogNotFound(w, "get_survey", surveyId)
+		if !checkAvailable(w, survey) {
 			return
 		}
 
-		// TODO find a cleaner way?
-		survey := model.Survey{}
-		var ip string
-		var dummy string
-		err = rows.Scan(
-			&survey.Title, &survey.Description,
-			&ip,
-			&dummy, &dummy, &dummy, &dummy, &dummy, &dummy,
-		)
-		if err != nil {
-			httpx.LogInternalError(w, "db.get_survey.ip", err)
-			return
-		}
-		if ip == strings.Split(r.RemoteAddr, ":")[0] {
-			survey.Submitted = true
-			render.JSON(w, r, survey)
+		respondentKey, ok := identifyRespondent(w, r, app, survey)
+		if !ok {
 			return
 		}
-
-		for {
-			f := model.SurveyField{}
-			var opts string
-			err = rows.Scan(
-				&survey.Title, &survey.Description,
-				&dummy,
-				&f.ID, &f.Type, &f.Name, &f.Label, &f.Required, &opts,
-			)
+		if respondentKey != "" {
+			submitted, err := app.Submissions.Exists(r.Context(), surveyId, respondentKey)
 			if err != nil {
-				httpx.LogInternalError(w, "db.get_survey.scan", err)
+				httpx.LogInternalError(w, "db.get_respondent", err)
 				return
 			}
-
-			if opts != "" {
-				err = json.Unmarshal([]byte(opts), &f.Options)
-				if err != nil {
-					httpx.LogInternalError(w, "db.get_survey.parse_options", err)
-					return
-				}
-			}
-
-			survey.Fields = append(survey.Fields, f)
-
-			if !rows.Next() {
-				break
+			if submitted {
+				render.JSON(w, r, model.Survey{
+					Title:       survey.Title,
+					Description: survey.Description,
+					Submitted:   true,
+				})
+				return
 			}
 		}
 
-		render.JSON(w, r, survey)
+		render.JSON(w, r, model.Survey{
+			Title:       survey.Title,
+			Description: survey.Description,
+			Fields:      survey.Fields,
+		})
 	}
 }
 
-type IpCheck struct {
-	op     bool
-	ip     string
-	result chan<- bool
+// Writes an error response and returns false if the survey cannot be answered right now.
+func checkAvailable(w http.ResponseWriter, survey model.Survey) bool {
+	now := time.Now()
+	switch {
+	case survey.Status == model.StatusDraft:
+		// drafts are not public yet
+		httpx.LogNotFound(w, "get_survey.draft", survey.ID)
+	case survey.Status == model.StatusArchived:
+		httpx.LogStatusMsg(w, http.StatusGone, log.DebugLevel, "survey.archived", "survey no longer available")
+	case survey.Status == model.StatusClosed || survey.PastClose(now):
+		httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "survey.closed", "survey closed")
+	case survey.NotYetOpen(now):
+		httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "survey.not_open", "survey not yet open")
+	default:
+		return true
+	}
+	return false
 }
 
 func PublicSubmitSurvey(app app.App) http.HandlerFunc {
-	validateIpStart := make(chan IpCheck)
-	go func() {
-		submissionIPs := make(map[string]bool)
-
-		for {
-			req := <-validateIpStart
-			if req.op {
-				req.result <- submissionIPs[req.ip]
-				submissionIPs[req.ip] = true
-			} else {
-				delete(submissionIPs, req.ip)
-			}
-		}
-	}()
-
 	return func(w http.ResponseWriter, r *http.Request) {
 		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
 		if err != nil {
@@ -134,138 +101,53 @@ func PublicSubmitSurvey(app app.App) http.HandlerFunc {
 			return
 		}
 
-		// TODO input validation, i.e. required fields
-
-		tx, err := app.BeginTx(r.Context(), nil)
+		survey, err := app.Surveys.Get(r.Context(), surveyId)
 		if err != nil {
-			httpx.LogInternalError(w, "db.begin_tx", err)
-			return
-		}
-		defer tx.Rollback()
-
-		rows, err := tx.QueryContext(r.Context(), `
-			SELECT
-				s.title, s.description,
-				f.type, f.label, f.required, f.options
-			FROM survey s
-			LEFT OUTER JOIN survey_field f ON (s.id = f.survey_id)
-			WHERE s.id = ?`,
-			surveyId,
-		)
-		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
+			if errors.Is(err, store.ErrNotFound) {
 				httpx.LogNotFound(w, "get_survey", surveyId)
 			} else {
 				httpx.LogInternalError(w, "db.get_survey", err)
 			}
 			return
 		}
-		defer rows.Close()
-
-		if !rows.Next() {
-			httpx.LogNotFound(w, "get_survey", surveyId)
-		}
-
-		survey := model.Survey{}
-		for {
-			f := model.SurveyField{}
-			var opts string
-			err = rows.Scan(
-				&survey.Title, &survey.Description,
-				&f.Type, &f.Label, &f.Required, &opts,
-			)
-			if err != nil {
-				httpx.LogInternalError(w, "db.get_survey.scan", err)
-				return
-			}
-
-			if opts != "" {
-				err = json.Unmarshal([]byte(opts), &f.Options)
-				if err != nil {
-					httpx.LogInternalError(w, "db.get_survey.parse_options", err)
-					return
-				}
-			}
-
-			survey.Fields = append(survey.Fields, f)
-
-			if !rows.Next() {
-				break
-			}
-		}
 
-		// TODO move to own module
-		ip := strings.Split(r.RemoteAddr, ":")[0]
-		// check ip is not submitting now
-		validateIpDone := make(chan bool)
-		validateIpStart <- IpCheck{true, ip, validateIpDone}
-		if <-validateIpDone {
-			httpx.LogStatus(w, http.StatusConflict, log.DebugLevel, "ip.already_submitted")
-			return
-		}
-		defer func() { validateIpStart <- IpCheck{false, ip, nil} }()
-		// check ip did not already submit
-		var alreadySubmitted bool
-		err = app.QueryRowContext(r.Context(), `
-			SELECT 1 FROM submission
-			WHERE survey_id = ?
-				AND ip = ?`,
-			surveyId,
-			ip,
-		).Scan(&alreadySubmitted)
-		if err != nil && !errors.Is(err, sql.ErrNoRows) {
-			httpx.LogInternalError(w, "db.get_ip.scan", err)
+		if !checkAvailable(w, survey) {
 			return
 		}
-		if alreadySubmitted {
-			httpx.LogStatus(w, http.StatusConflict, log.DebugLevel, "ip.already_submitted")
+
+		if errs := validation.Submission(survey, &submission); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
 			return
 		}
 
-		var submissionId int
-		err = tx.QueryRowContext(r.Context(), `
-			INSERT INTO submission (survey_id, time, ip) VALUES (?, ?, ?)
-			RETURNING id`,
-			surveyId,
-			time.Now(),
-			ip,
-		).Scan(&submissionId)
-		if err != nil {
-			httpx.LogInternalError(w, "db.insert_submission", err)
+		respondentKey, ok := identifyRespondent(w, r, app, survey)
+		if !ok {
 			return
 		}
 
-		stmt, err := tx.PrepareContext(r.Context(), `
-			INSERT INTO submission_field (submission_id, field_id, value)
-			VALUES (?, ?, ?)`)
+		submission.IP, err = app.Anonymizer.IP(survey.PrivacyMode, httpx.ClientIP(r))
 		if err != nil {
-			httpx.LogInternalError(w, "db.insert_submission.fields.prepare", err)
+			httpx.LogInternalError(w, "privacy.anonymize_ip", err)
 			return
 		}
-		defer stmt.Close()
-
-		for _, f := range submission.Fields {
-			var valueJson []byte
-			if f.Value != nil {
-				valueJson, err = json.Marshal(f.Value)
-				if err != nil {
-					httpx.LogInternalError(w, "db.insert_submission.fields.parse_value", err)
-					return
-				}
-			}
-			_, err := stmt.ExecContext(r.Context(), submissionId, f.ID, string(valueJson))
-			if err != nil {
-				httpx.LogInternalError(w, "db.insert_submission.fields.insert", err)
-				return
-			}
-		}
-
-		err = tx.Commit()
+		submission.SurveyVersion = survey.Version
+		submission.RespondentKey = respondentKey
+		submission.Time = time.Now()
+		submissionId, err := app.Submissions.Insert(r.Context(), surveyId, submission)
 		if err != nil {
-			httpx.LogInternalError(w, "db.insert_submission.commit", err)
+			if errors.Is(err, store.ErrConflict) {
+				httpx.LogStatus(w, http.StatusConflict, log.DebugLevel, "db.insert_submission.survey_changed")
+			} else if errors.Is(err, store.ErrDuplicate) {
+				httpx.LogStatus(w, http.StatusConflict, log.DebugLevel, "respondent.already_submitted")
+			} else {
+				httpx.LogInternalError(w, "db.insert_submission", err)
+			}
 			return
 		}
 
+		submission.ID = submissionId
+		publishSubmission(app, survey, submission)
+
 		// write response
 		w.WriteHeader(http.StatusCreated)
 		render.JSON(w, r, map[string]any{
@@ -273,3 +155,28 @@ func PublicSubmitSurvey(app app.App) http.HandlerFunc {
 		})
 	}
 }
+
+// Notifies subscribers, webhooks and email subscribers of a new submission, with labels filled in and the IP redacted
+func publishSubmission(app app.App, survey model.Survey, submission model.Submission) {
+	submission.IP = app.Anonymizer.Redact(survey.PrivacyMode, submission.IP)
+	fields := make(map[string]model.SubmissionField, len(submission.Fields))
+	for _, f := range survey.Fields {
+		if answer, ok := submission.Fields[f.Name]; ok {
+			answer.Name, answer.Label = f.Name, f.Label
+			for _, o := range f.Options {
+				if o.Value == answer.Value {
+					answer.ValueLabel = o.Label
+				}
+			}
+			fields[f.Name] = answer
+		}
+	}
+	submission.Fields = fields
+
+	publish(app, survey.ID, events.Event{
+		Type: events.SubmissionCreated,
+		ID:   submission.ID,
+		Data: submission,
+	})
+	app.Notifier.SubmissionCreated(survey, submission)
+}
@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/config"
+	"github.com/mbolis/quick-survey/events"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/notify"
+	"github.com/mbolis/quick-survey/privacy"
+	"github.com/mbolis/quick-survey/webhooks"
+)
+
+func TestPublicGetSurveyById(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		ip            string
+		want          int
+		wantSubmitted bool
+	}{
+		{"new respondent", "/surveys/1", "192.0.2.9", http.StatusOK, false},
+		{"already submitted", "/surveys/1", "192.0.2.1", http.StatusOK, true},
+		{"missing", "/surveys/9", "192.0.2.9", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surveys := newMemSurveys(colorSurvey())
+			submissions := newMemSubmissions(surveys)
+			submissions.Insert(context.Background(), 1, model.Submission{
+				IP:            "192.0.2.1",
+				SurveyVersion: 1,
+				RespondentKey: model.RespondentKey(model.DedupeIP, "192.0.2.1"),
+			})
+			a := app.App{Surveys: surveys, Submissions: submissions, Anonymizer: privacy.NewAnonymizer("secret")}
+
+			r := request(http.MethodGet, tt.path, "")
+			r.RemoteAddr = tt.ip + ":1234"
+			w := serve(PublicGetSurveyById(a), "/surveys/{id}", r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			survey := model.Survey{}
+			json.Unmarshal(w.Body.Bytes(), &survey)
+			if survey.Title != "Colors" || survey.Submitted != tt.wantSubmitted {
+				t.Errorf("survey = %+v", survey)
+			}
+			// the fields are only shown to those who can still submit
+			if hasFields := len(survey.Fields) > 0; hasFields == tt.wantSubmitted {
+				t.Errorf("fields = %+v", survey.Fields)
+			}
+		})
+	}
+}
+
+func TestPublicSubmitSurvey(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		ip   string
+		body string
+		want int
+	}{
+		{"submitted", "/surveys/1/submissions", "192.0.2.9", `{"fields": {"color": {"id": 1, "value": "red"}}}`, http.StatusCreated},
+		{"already submitted", "/surveys/1/submissions", "192.0.2.1", `{"fields": {"color": {"id": 1, "value": "red"}}}`, http.StatusConflict},
+		{"missing survey", "/surveys/9/submissions", "192.0.2.9", `{"fields": {}}`, http.StatusNotFound},
+		{"invalid body", "/surveys/1/submissions", "192.0.2.9", `{"fields": `, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			surveys := newMemSurveys(colorSurvey())
+			submissions := newMemSubmissions(surveys)
+			submissions.Insert(context.Background(), 1, model.Submission{
+				IP:            "192.0.2.1",
+				SurveyVersion: 1,
+				RespondentKey: model.RespondentKey(model.DedupeIP, "192.0.2.1"),
+			})
+			hooks := &memWebhooks{}
+			a := app.App{
+				Surveys:     surveys,
+				Submissions: submissions,
+				Anonymizer:  privacy.NewAnonymizer("secret"),
+				Events:      events.NewHub(),
+				Dispatcher:  webhooks.NewDispatcher(hooks),
+				// without SMTP settings, no emails are sent
+				Notifier: notify.NewNotifier(config.Config{}, nil, surveys, submissions),
+			}
+			sub := a.Events.Subscribe(events.SurveyTopic(1))
+			defer sub.Close()
+
+			r := request(http.MethodPost, tt.path, tt.body)
+			r.RemoteAddr = tt.ip + ":1234"
+			w := serve(PublicSubmitSurvey(a), "/surveys/{id}/submissions", r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusCreated {
+				if n := len(submissions.submissions[1]); n != 1 {
+					t.Errorf("stored %d submissions, want 1", n)
+				}
+				return
+			}
+
+			stored := submissions.submissions[1]
+			if len(stored) != 2 {
+				t.Fatalf("stored %d submissions, want 2", len(stored))
+			}
+			if s := stored[1]; s.IP != tt.ip || s.SurveyVersion != 1 || s.RespondentKey != "ip:"+tt.ip || s.Fields["color"].Value != "red" {
+				t.Errorf("stored submission = %+v", s)
+			}
+			select {
+			case e := <-sub.Events():
+				if e.Type != events.SubmissionCreated || e.ID != stored[1].ID {
+					t.Errorf("event = %+v", e)
+				}
+			default:
+				t.Errorf("no event published")
+			}
+			if !reflect.DeepEqual(hooks.enqueued, []string{events.SubmissionCreated}) {
+				t.Errorf("queued webhook events = %v", hooks.enqueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/oauth"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+)
+
+const respondentCookie = "respondent"
+
+// Identifies the respondent according to the survey dedupe policy, returning an empty key
+// if duplicates are allowed. Writes an error response and returns false if the respondent
+// cannot be identified.
+func identifyRespondent(w http.ResponseWriter, r *http.Request, app app.App, survey model.Survey) (key string, ok bool) {
+	switch survey.DedupePolicy {
+	case model.DedupeNone:
+		return "", true
+
+	case model.DedupeIP:
+		ip := httpx.ClientIP(r)
+		if survey.PrivacyMode != model.PrivacyFull {
+			// don't let the address leak through the key
+			ip = app.Anonymizer.Pseudonym(survey.ID, ip)
+		}
+		return model.RespondentKey(model.DedupeIP, ip), true
+
+	case model.DedupeCookie:
+		cookie, err := r.Cookie(respondentCookie)
+		if err == nil && cookie.Value != "" {
+			return model.RespondentKey(model.DedupeCookie, cookie.Value), true
+		}
+
+		token, err := randomToken()
+		if err != nil {
+			httpx.LogInternalError(w, "respondent.cookie.generate", err)
+			return "", false
+		}
+		http.SetCookie(w, &http.Cookie{
+			Path:     "/",
+			Name:     respondentCookie,
+			Value:    token,
+			MaxAge:   60 * 60 * 24 * 365,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return model.RespondentKey(model.DedupeCookie, token), true
+
+	case model.DedupeInvite:
+		token := r.URL.Query().Get("invite")
+		if token == "" {
+			httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "respondent.invite", "an invite is required")
+			return "", false
+		}
+		exists, err := app.Invites.Exists(r.Context(), survey.ID, token)
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_invite", err)
+			return "", false
+		}
+		if !exists {
+			httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "respondent.invite", "invalid invite")
+			return "", false
+		}
+		return model.RespondentKey(model.DedupeInvite, token), true
+
+	case model.DedupeUser:
+		credential, _ := r.Context().Value(oauth.CredentialContext).(string)
+		if credential == "" {
+			httpx.LogStatusMsg(w, http.StatusUnauthorized, log.DebugLevel, "respondent.user", "login required")
+			return "", false
+		}
+		return model.RespondentKey(model.DedupeUser, credential), true
+	}
+
+	httpx.LogInternalError(w, "respondent.policy", fmt.Errorf("unknown dedupe policy %q", survey.DedupePolicy))
+	return "", false
+}
+
+// Generates a random URL-safe token
+func randomToken() (string, error) {
+	b := make([]byte, 18)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -5,18 +5,20 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/model"
 	"github.com/mbolis/quick-survey/routes/middleware"
 )
 
 func Wire(app app.App) http.Handler {
 
 	root := chi.NewRouter()
-	root.Use(middleware.Default)
+	root.Use(middleware.Default(app))
 
 	root.Mount("/api", apiRouter(app))
 
 	root.
-		With(middleware.CookieAuth(app), middleware.Admin(app)).
+		With(middleware.CookieAuth(app), middleware.Authorize(app, auth.SurveyRead)).
 		Mount("/admin", servePrivateFiles("/admin"))
 	root.Mount("/", servePublicFiles())
 
@@ -26,20 +28,136 @@ func Wire(app app.App) http.Handler {
 func apiRouter(app app.App) http.Handler {
 	api := chi.NewRouter()
 
-	api.Get(`/surveys/{id:^\d+$}`, PublicGetSurveyById(app))
-	api.Post(`/surveys/{id:^\d+$}/submissions`, PublicSubmitSurvey(app))
+	api.Group(func(r chi.Router) {
+		// respondents may be identified by their login
+		r.Use(middleware.OptionalAuth(app))
+
+		r.Get(`/surveys/{id:^\d+$}`, PublicGetSurveyById(app))
+		r.Post(`/surveys/{id:^\d+$}/submissions`, PublicSubmitSurvey(app))
+
+		// live presentation
+		r.Get(`/surveys/{id:^\d+$}/presentation`, PublicGetPresentation(app))
+		r.Get(`/surveys/{id:^\d+$}/presentation/events`, PublicStreamPresentation(app))
+		r.Post(`/surveys/{id:^\d+$}/presentation/answers`, PublicAnswerPresentation(app))
+	})
 
 	api.Route("/admin", func(r chi.Router) {
-		r.Use(middleware.Admin(app))
+		r.Use(middleware.BearerFromCookie, middleware.Authenticate(app))
+
+		// permissions granted by the roles of the user in the active workspace
+		read := middleware.Require(auth.SurveyRead)
+		write := middleware.Require(auth.SurveyWrite)
+		results := middleware.Require(auth.SubmissionsRead)
+		members := middleware.Require(auth.MembersManage)
+		hooks := middleware.Require(auth.WebhooksManage)
+		// permissions granted by the role of the user on the whole deployment
+		users := middleware.RequireUser(auth.UsersManage)
+		workspaces := middleware.RequireUser(auth.WorkspacesManage)
+
+		// access to the survey in the URL, as owned by or shared with the user
+		view := middleware.SurveyAccess(app, model.AccessView)
+		edit := middleware.SurveyAccess(app, model.AccessEdit)
+		own := middleware.SurveyAccess(app, model.AccessOwner)
 
 		// CRUD survey
-		r.Post("/surveys", CreateSurvey(app))
-		r.Get("/surveys", ListSurveys(app))
-		r.Get(`/surveys/{id:^\d+$}`, GetSurveyById(app))
-		r.Put(`/surveys/{id:^\d+$}`, UpdateSurvey(app))
-		r.Delete(`/surveys/{id:^\d+$}`, DeleteSurvey(app))
-
-		r.Get(`/surveys/{id:^\d+$}/submissions`, GetSurveySubmissions(app))
+		r.With(write).Post("/surveys", CreateSurvey(app))
+		r.With(read).Get("/surveys", ListSurveys(app))
+		r.With(read, view).Get(`/surveys/{id:^\d+$}`, GetSurveyById(app))
+		r.With(write, edit).Put(`/surveys/{id:^\d+$}`, UpdateSurvey(app))
+		r.With(write, own).Delete(`/surveys/{id:^\d+$}`, DeleteSurvey(app))
+
+		// trash
+		r.With(read).Get("/trash", ListDeletedSurveys(app))
+		r.With(write, own).Post(`/trash/{id:^\d+$}/restore`, RestoreSurvey(app))
+		r.With(write, own).Delete(`/trash/{id:^\d+$}`, PurgeSurvey(app))
+
+		// survey lifecycle
+		r.With(write, edit).Post(`/surveys/{id:^\d+$}/publish`, SetSurveyStatus(app, model.StatusOpen))
+		r.With(write, edit).Post(`/surveys/{id:^\d+$}/close`, SetSurveyStatus(app, model.StatusClosed))
+		r.With(write, edit).Post(`/surveys/{id:^\d+$}/archive`, SetSurveyStatus(app, model.StatusArchived))
+
+		r.With(write, edit).Post(`/surveys/{id:^\d+$}/invites`, CreateSurveyInvites(app))
+		r.With(write, edit).Get(`/surveys/{id:^\d+$}/invites`, ListSurveyInvites(app))
+
+		r.With(read, view).Get(`/surveys/{id:^\d+$}/versions`, ListSurveyVersions(app))
+		r.With(read, view).Get(`/surveys/{id:^\d+$}/versions/{version:^\d+$}`, GetSurveyVersion(app))
+
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/submissions`, GetSurveySubmissions(app))
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/submissions.csv`, ExportSurveySubmissionsCSV(app))
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/submissions.xlsx`, ExportSurveySubmissionsXLSX(app))
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/submissions.sav`, ExportSurveySubmissionsSAV(app))
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/submissions.r.zip`, ExportSurveySubmissionsR(app))
+
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/stats`, GetSurveyStats(app))
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/words`, GetSurveyWordFrequencies(app))
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/crosstab`, GetSurveyCrossTab(app))
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/timeseries`, GetSurveyTimeSeries(app))
+		r.With(results, view).Get(`/surveys/{id:^\d+$}/events`, StreamSurveyEvents(app))
+
+		// ownership and sharing
+		r.With(read, view).Get(`/surveys/{id:^\d+$}/shares`, ListSurveyShares(app))
+		r.With(write, own).Post(`/surveys/{id:^\d+$}/shares`, ShareSurvey(app))
+		r.With(write, own).Delete(`/surveys/{id:^\d+$}/shares/users/{username}`, UnshareSurvey(app))
+		r.With(write, own).Delete(`/surveys/{id:^\d+$}/shares/groups/{group}`, UnshareSurvey(app))
+		r.With(write, own).Put(`/surveys/{id:^\d+$}/owner`, TransferSurvey(app))
+
+		// email notifications
+		r.With(write, edit).Get(`/surveys/{id:^\d+$}/subscribers`, ListSurveySubscribers(app))
+		r.With(write, edit).Post(`/surveys/{id:^\d+$}/subscribers`, AddSurveySubscriber(app))
+		r.With(write, edit).Delete(`/surveys/{id:^\d+$}/subscribers/{email}`, RemoveSurveySubscriber(app))
+
+		// live presentation
+		r.With(write, edit).Post(`/surveys/{id:^\d+$}/presentation`, StartPresentation(app))
+		r.With(read, view).Get(`/surveys/{id:^\d+$}/presentation`, GetPresentation(app))
+		r.With(write, edit).Put(`/surveys/{id:^\d+$}/presentation`, UpdatePresentation(app))
+		r.With(write, edit).Post(`/surveys/{id:^\d+$}/presentation/next`, StepPresentation(app, +1))
+		r.With(write, edit).Post(`/surveys/{id:^\d+$}/presentation/prev`, StepPresentation(app, -1))
+		r.With(write, edit).Delete(`/surveys/{id:^\d+$}/presentation`, StopPresentation(app))
+
+		// users
+		r.With(users).Post("/users", CreateUser(app))
+		r.With(users).Get("/users", ListUsers(app))
+		r.With(users).Get("/users/{username}", GetUser(app))
+		r.With(users).Put("/users/{username}", UpdateUser(app))
+		r.With(users).Delete("/users/{username}", DeleteUser(app))
+		r.With(users).Post("/users/{username}/disable", SetUserDisabled(app, true))
+		r.With(users).Post("/users/{username}/enable", SetUserDisabled(app, false))
+		r.With(users).Post("/users/{username}/password", ResetUserPassword(app))
+
+		// workspaces
+		r.Get("/workspaces", ListWorkspaces(app))
+		r.With(workspaces).Post("/workspaces", CreateWorkspace(app))
+		r.With(workspaces).Get(`/workspaces/{workspace:^\d+$}/members`, ListMembers(app))
+		r.With(workspaces).Post(`/workspaces/{workspace:^\d+$}/members`, InviteMember(app))
+		r.With(workspaces).Put(`/workspaces/{workspace:^\d+$}/members/{username}`, UpdateMember(app))
+		r.With(workspaces).Delete(`/workspaces/{workspace:^\d+$}/members/{username}`, RemoveMember(app))
+
+		// members of the active workspace
+		r.With(read).Get("/members", ListMembers(app))
+		r.With(members).Post("/members", InviteMember(app))
+		r.With(members).Put("/members/{username}", UpdateMember(app))
+		r.With(members).Delete("/members/{username}", RemoveMember(app))
+		r.With(members).Post("/members/{username}/transfer", TransferMemberSurveys(app))
+
+		// groups of members, to share surveys with
+		group := middleware.GroupAccess(app)
+		r.With(members).Post("/groups", CreateGroup(app))
+		r.With(read).Get("/groups", ListGroups(app))
+		r.With(read, group).Get("/groups/{group}", GetGroup(app))
+		r.With(members, group).Delete("/groups/{group}", DeleteGroup(app))
+		r.With(members, group).Put("/groups/{group}/members/{username}", AddGroupMember(app))
+		r.With(members, group).Delete("/groups/{group}/members/{username}", RemoveGroupMember(app))
+
+		// webhooks
+		hook := middleware.WebhookAccess(app)
+		r.With(hooks).Post("/webhooks", CreateWebhook(app))
+		r.With(hooks).Get("/webhooks", ListWebhooks(app))
+		r.With(hooks, hook).Get(`/webhooks/{id:^\d+$}`, GetWebhook(app))
+		r.With(hooks, hook).Put(`/webhooks/{id:^\d+$}`, UpdateWebhook(app))
+		r.With(hooks, hook).Delete(`/webhooks/{id:^\d+$}`, DeleteWebhook(app))
+		r.With(hooks, hook).Get(`/webhooks/{id:^\d+$}/deliveries`, ListWebhookDeliveries(app))
+		r.With(hooks, hook).Get(`/webhooks/{id:^\d+$}/deliveries/{delivery:^\d+$}`, GetWebhookDelivery(app))
+		r.With(hooks, hook).Post(`/webhooks/{id:^\d+$}/deliveries/{delivery:^\d+$}/redeliver`, RedeliverWebhookDelivery(app))
 	})
 
 	api.Post("/login", Login(app))
@@ -0,0 +1,171 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
+)
+
+// Lists the owner of a survey and the users and groups it is shared with
+func ListSurveyShares(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		survey, err := app.Surveys.Get(r.Context(), surveyId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_survey", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.get_survey", err)
+			}
+			return
+		}
+
+		shares, err := app.Shares.List(r.Context(), surveyId)
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_shares", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"owner":  survey.Owner,
+			"shares": shares,
+		})
+	}
+}
+
+// Grants "view" or "edit" access to a survey to a user or a group.
+// Sharing again with the same user or group changes their access
+func ShareSurvey(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		share := model.Share{}
+		err = render.DecodeJSON(r.Body, &share)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+		share.SurveyID = surveyId
+
+		if errs := validation.Share(share); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
+			return
+		}
+		if share.Username != "" && !checkMember(app, w, r, share.Username) {
+			return
+		}
+		if share.Group != "" {
+			_, err = app.Groups.Get(r.Context(), auth.ClaimedWorkspace(r), share.Group)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					httpx.LogStatusMsg(w, http.StatusUnprocessableEntity, log.DebugLevel, "share.unknown_group", "no such group: %q", share.Group)
+				} else {
+					httpx.LogInternalError(w, "db.get_group", err)
+				}
+				return
+			}
+		}
+
+		err = app.Shares.Grant(r.Context(), share)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogStatusMsg(w, http.StatusUnprocessableEntity, log.DebugLevel, "db.grant_access.not_found", "no such user or group: %s%s", share.Username, share.Group)
+			} else {
+				httpx.LogInternalError(w, "db.grant_access", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Revokes the access to a survey granted to the user or the group in the URL
+func UnshareSurvey(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+		username, group := chi.URLParam(r, "username"), chi.URLParam(r, "group")
+
+		err = app.Shares.Revoke(r.Context(), surveyId, username, group)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "revoke_access", []any{surveyId, username + group})
+			} else {
+				httpx.LogInternalError(w, "db.revoke_access", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Transfers the ownership of a survey to another member of the active workspace.
+// The previous owner keeps no access, unless shared with them
+func TransferSurvey(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		body := struct {
+			Username string `json:"username"`
+		}{}
+		err = render.DecodeJSON(r.Body, &body)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+		if !checkNewOwner(app, w, r, body.Username) {
+			return
+		}
+
+		err = app.Shares.SetOwner(r.Context(), surveyId, body.Username)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "set_owner", surveyId)
+			} else {
+				httpx.LogInternalError(w, "db.set_owner", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Only active members of the workspace can own surveys.
+// Will send an error response and return false otherwise
+func checkNewOwner(app app.App, w http.ResponseWriter, r *http.Request, username string) bool {
+	member, ok := getMember(app, w, r, username)
+	if ok && member.Disabled {
+		httpx.LogStatusMsg(w, http.StatusUnprocessableEntity, log.DebugLevel, "transfer.disabled_user", "user %q is disabled", username)
+		return false
+	}
+	return ok
+}
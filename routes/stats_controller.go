@@ -0,0 +1,282 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/export"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/stats"
+	"github.com/mbolis/quick-survey/store"
+)
+
+const maxBins = 100
+
+// Summarizes the submissions to a survey field by field.
+// Number histograms have 10 bins, or as many as ?bins=
+func GetSurveyStats(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, fields, ok := getSurveyAllFields(app, w, r)
+		if !ok {
+			return
+		}
+
+		bins, ok := getIntParam(w, r, "bins", stats.DefaultBins, 1, maxBins)
+		if !ok {
+			return
+		}
+
+		summary, err := summarize(r.Context(), app, survey.ID, fields, bins)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_stats", survey.ID)
+			} else {
+				httpx.LogInternalError(w, "db.get_submissions", err)
+			}
+			return
+		}
+
+		render.JSON(w, r, summary)
+	}
+}
+
+func summarize(ctx context.Context, app app.App, surveyId int, fields []model.SurveyField, bins int) (*stats.Summary, error) {
+	summary := stats.NewSummary(fields, bins)
+	err := app.Submissions.Each(ctx, surveyId, func(s model.Submission) error {
+		summary.Add(s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary.Finish(), nil
+}
+
+const (
+	maxNGram     = 3
+	maxTerms     = 1000
+	defaultTerms = 100
+)
+
+// Counts the terms in the answers to a text field, ready for a word cloud.
+// Query parameters:
+//   - field: name of the text or textarea field (required)
+//   - lang: comma-separated languages whose stopwords are ignored (default "it,en", "none" to keep all)
+//   - stem: language of the stemmer to apply (default none)
+//   - ngram: words per term, 1 to 3 (default 1)
+//   - min: least number of occurrences of a term (default 1)
+//   - limit: maximum number of terms, most frequent first (default 100)
+func GetSurveyWordFrequencies(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, fields, ok := getSurveyAllFields(app, w, r)
+		if !ok {
+			return
+		}
+
+		field, ok := getFieldParam(w, r, "field", fields)
+		if !ok {
+			return
+		}
+		if field.Type != "text" && field.Type != "textarea" {
+			httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.get_query_param.field", "field %q is not a text field", field.Name)
+			return
+		}
+
+		query := r.URL.Query()
+
+		opts := stats.WordOptions{Languages: []string{"it", "en"}, Stem: query.Get("stem")}
+		if lang := query.Get("lang"); lang == "none" {
+			opts.Languages = nil
+		} else if lang != "" {
+			opts.Languages = strings.Split(lang, ",")
+		}
+		if opts.NGram, ok = getIntParam(w, r, "ngram", 1, 1, maxNGram); !ok {
+			return
+		}
+		if opts.MinCount, ok = getIntParam(w, r, "min", 1, 1, math.MaxInt); !ok {
+			return
+		}
+		if opts.Limit, ok = getIntParam(w, r, "limit", defaultTerms, 1, maxTerms); !ok {
+			return
+		}
+
+		counter, err := stats.NewWordCounter(opts)
+		if err != nil {
+			httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.word_options", "%s", err)
+			return
+		}
+
+		err = app.Submissions.Each(r.Context(), survey.ID, func(s model.Submission) error {
+			if answer := s.Fields[field.Name].Value; !stats.IsEmpty(answer) {
+				counter.Add(export.Text(answer))
+			}
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_words", survey.ID)
+			} else {
+				httpx.LogInternalError(w, "db.get_submissions", err)
+			}
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"field":   field.Name,
+			"answers": counter.Answers(),
+			"terms":   counter.Terms(),
+		})
+	}
+}
+
+// Cross-tabulates the answers to two fields given as ?row= and ?column=,
+// which must be select, checkbox or number fields.
+// Numbers are split into 5 bins, or as many as ?bins=
+func GetSurveyCrossTab(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		survey, fields, ok := getSurveyAllFields(app, w, r)
+		if !ok {
+			return
+		}
+
+		row, ok := getFieldParam(w, r, "row", fields)
+		if !ok {
+			return
+		}
+		column, ok := getFieldParam(w, r, "column", fields)
+		if !ok {
+			return
+		}
+		bins, ok := getIntParam(w, r, "bins", defaultCrossTabBins, 1, maxBins)
+		if !ok {
+			return
+		}
+
+		table, err := stats.NewCrossTab(row, column, bins)
+		if err != nil {
+			httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.crosstab_fields", "%s", err)
+			return
+		}
+
+		err = app.Submissions.Each(r.Context(), survey.ID, func(s model.Submission) error {
+			table.Add(s)
+			return nil
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_crosstab", survey.ID)
+			} else {
+				httpx.LogInternalError(w, "db.get_submissions", err)
+			}
+			return
+		}
+
+		render.JSON(w, r, table.Finish())
+	}
+}
+
+const defaultCrossTabBins = 5
+
+// Counts the submissions to a survey over time.
+// Query parameters:
+//   - interval: minute, hour, day or week (default day)
+//   - tz: IANA time zone the buckets are aligned to (default UTC)
+//   - cumulative: if true, each bucket also counts the submissions before it
+func GetSurveyTimeSeries(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		surveyId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		query := r.URL.Query()
+		interval := query.Get("interval")
+		if interval == "" {
+			interval = stats.IntervalDay
+		}
+		loc, err := time.LoadLocation(query.Get("tz"))
+		if err != nil {
+			httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.get_query_param.tz", "unknown time zone %q", query.Get("tz"))
+			return
+		}
+		cumulative := false
+		if c := query.Get("cumulative"); c != "" {
+			cumulative, err = strconv.ParseBool(c)
+			if err != nil {
+				httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.get_query_param.cumulative", "cumulative must be true or false")
+				return
+			}
+		}
+
+		times, err := app.Submissions.ListTimes(r.Context(), surveyId)
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_submission_times", err)
+			return
+		}
+		if len(times) == 0 {
+			// tell an empty survey from a missing one
+			_, err = app.Surveys.Get(r.Context(), surveyId)
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_timeseries", surveyId)
+				return
+			}
+			if err != nil {
+				httpx.LogInternalError(w, "db.get_survey", err)
+				return
+			}
+		}
+
+		buckets, err := stats.TimeSeries(times, interval, loc, cumulative)
+		if err != nil {
+			httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.timeseries", "%s", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"interval":   interval,
+			"tz":         loc.String(),
+			"cumulative": cumulative,
+			"total":      len(times),
+			"buckets":    buckets,
+		})
+	}
+}
+
+// Reads the name of a survey field from the query.
+// Will send an error response and return false if there's no such field
+func getFieldParam(w http.ResponseWriter, r *http.Request, param string, fields []model.SurveyField) (model.SurveyField, bool) {
+	name := r.URL.Query().Get(param)
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.get_query_param."+param, "unknown field %q", name)
+	return model.SurveyField{}, false
+}
+
+// Reads an optional integer query parameter within [min, max].
+// Will send an error response and return false if invalid
+func getIntParam(w http.ResponseWriter, r *http.Request, name string, def, min, max int) (int, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min || n > max {
+		httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.get_query_param."+name, "%s must be an integer between %d and %d", name, min, max)
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,171 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/oauth"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+)
+
+// In-memory SurveyStore
+type memSurveys struct {
+	store.SurveyStore
+	surveys map[int]model.Survey
+	lastID  int
+}
+
+func newMemSurveys(surveys ...model.Survey) *memSurveys {
+	s := &memSurveys{surveys: map[int]model.Survey{}}
+	for _, survey := range surveys {
+		s.surveys[survey.ID] = survey
+		if survey.ID > s.lastID {
+			s.lastID = survey.ID
+		}
+	}
+	return s
+}
+
+func (s *memSurveys) Create(ctx context.Context, survey model.Survey) (int, error) {
+	s.lastID++
+	survey.ID, survey.Version = s.lastID, 1
+	s.surveys[survey.ID] = survey
+	return survey.ID, nil
+}
+
+func (s *memSurveys) Get(ctx context.Context, id int) (model.Survey, error) {
+	survey, ok := s.surveys[id]
+	if !ok {
+		return model.Survey{}, store.ErrNotFound
+	}
+	return survey, nil
+}
+
+func (s *memSurveys) List(ctx context.Context, workspaceId int) ([]model.Survey, error) {
+	surveys := []model.Survey{}
+	for _, survey := range s.surveys {
+		if survey.WorkspaceID == workspaceId {
+			surveys = append(surveys, survey)
+		}
+	}
+	sort.Slice(surveys, func(i, j int) bool { return surveys[i].ID < surveys[j].ID })
+	return surveys, nil
+}
+
+func (s *memSurveys) ListFor(ctx context.Context, workspaceId int, username string) ([]model.Survey, error) {
+	all, _ := s.List(ctx, workspaceId)
+	surveys := []model.Survey{}
+	for _, survey := range all {
+		if survey.Owner == username {
+			survey.Access = model.AccessOwner
+			surveys = append(surveys, survey)
+		}
+	}
+	return surveys, nil
+}
+
+func (s *memSurveys) Update(ctx context.Context, survey model.Survey) error {
+	current, ok := s.surveys[survey.ID]
+	if !ok || current.Version != survey.Version {
+		return store.ErrConflict
+	}
+	survey.Version++
+	s.surveys[survey.ID] = survey
+	return nil
+}
+
+func (s *memSurveys) Delete(ctx context.Context, id int) error {
+	if _, ok := s.surveys[id]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.surveys, id)
+	return nil
+}
+
+// In-memory SubmissionStore, for the surveys of a memSurveys
+type memSubmissions struct {
+	store.SubmissionStore
+	surveys     *memSurveys
+	submissions map[int][]model.Submission
+	lastID      int
+}
+
+func newMemSubmissions(surveys *memSurveys) *memSubmissions {
+	return &memSubmissions{surveys: surveys, submissions: map[int][]model.Submission{}}
+}
+
+func (s *memSubmissions) Insert(ctx context.Context, surveyId int, submission model.Submission) (int, error) {
+	if survey, ok := s.surveys.surveys[surveyId]; !ok || survey.Version != submission.SurveyVersion {
+		return 0, store.ErrConflict
+	}
+	if submission.RespondentKey != "" {
+		if exists, _ := s.Exists(ctx, surveyId, submission.RespondentKey); exists {
+			return 0, store.ErrDuplicate
+		}
+	}
+	s.lastID++
+	submission.ID = s.lastID
+	s.submissions[surveyId] = append(s.submissions[surveyId], submission)
+	return submission.ID, nil
+}
+
+func (s *memSubmissions) ListBySurvey(ctx context.Context, surveyId int) ([]model.Submission, error) {
+	if _, ok := s.surveys.surveys[surveyId]; !ok {
+		return nil, store.ErrNotFound
+	}
+	return append([]model.Submission{}, s.submissions[surveyId]...), nil
+}
+
+func (s *memSubmissions) Exists(ctx context.Context, surveyId int, respondentKey string) (bool, error) {
+	for _, submission := range s.submissions[surveyId] {
+		if submission.RespondentKey == respondentKey {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// WebhookStore recording the events queued for delivery
+type memWebhooks struct {
+	store.WebhookStore
+	enqueued []string
+}
+
+func (s *memWebhooks) Enqueue(ctx context.Context, surveyId int, event string, payload []byte) (int, error) {
+	s.enqueued = append(s.enqueued, event)
+	return 0, nil
+}
+
+// Serves the request through a router that routes pattern to the handler, and returns the response
+func serve(h http.HandlerFunc, pattern string, r *http.Request) *httptest.ResponseRecorder {
+	router := chi.NewRouter()
+	router.Method(r.Method, pattern, h)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func request(method string, path string, body string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+// Makes the request on behalf of a user, as if they authenticated with a token
+// for the given workspace, claiming the given roles in it
+func asUser(r *http.Request, username string, workspaceId int, roles string) *http.Request {
+	ctx := context.WithValue(r.Context(), oauth.CredentialContext, username)
+	ctx = context.WithValue(ctx, oauth.ClaimsContext, map[string]string{
+		auth.ClaimRoles:     roles,
+		auth.ClaimWorkspace: strconv.Itoa(workspaceId),
+	})
+	return r.WithContext(ctx)
+}
@@ -0,0 +1,328 @@
+package routes
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
+)
+
+// Creates a user, as a viewer unless another role is given.
+// The password is generated unless given, and then disclosed only in this response
+func CreateUser(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Username string `json:"username"`
+			Role     string `json:"role"`
+			Password string `json:"password"`
+		}{}
+		err := render.DecodeJSON(r.Body, &body)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+
+		if body.Role == "" {
+			body.Role = auth.RoleViewer
+		}
+		errs := validation.Username(body.Username)
+		errs = append(errs, validation.Role(body.Role)...)
+		if body.Password != "" {
+			errs = append(errs, validation.Password(body.Password)...)
+		}
+		if len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
+			return
+		}
+
+		if !canGrantRole(w, r, body.Role) {
+			return
+		}
+
+		password, hash, ok := newPassword(w, body.Password)
+		if !ok {
+			return
+		}
+
+		err = app.Users.Create(r.Context(), body.Username, body.Role, hash)
+		if err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "db.insert_user.conflict", "user %q already exists", body.Username)
+			} else {
+				httpx.LogInternalError(w, "db.insert_user", err)
+			}
+			return
+		}
+
+		resp := map[string]any{"username": body.Username, "role": body.Role}
+		if body.Password == "" {
+			resp["password"] = password
+		}
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, resp)
+	}
+}
+
+// Hashes the given password, or a generated one if empty.
+// Will send an error response and return false on failure
+func newPassword(w http.ResponseWriter, password string) (string, string, bool) {
+	var err error
+	if password == "" {
+		password, err = httpx.GeneratePassword()
+		if err != nil {
+			httpx.LogInternalError(w, "user.generate_password", err)
+			return "", "", false
+		}
+	}
+
+	hash, err := httpx.HashPassword(password)
+	if err != nil {
+		httpx.LogInternalError(w, "user.hash_password", err)
+		return "", "", false
+	}
+	return password, hash, true
+}
+
+func ListUsers(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := app.Users.List(r.Context())
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_users", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"users": users,
+		})
+	}
+}
+
+func GetUser(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+
+		user, err := app.Users.Get(r.Context(), username)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_user", username)
+			} else {
+				httpx.LogInternalError(w, "db.get_user", err)
+			}
+			return
+		}
+
+		render.JSON(w, r, user)
+	}
+}
+
+// Updates the given properties of a user
+func UpdateUser(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+
+		body := struct {
+			Role     *string `json:"role"`
+			Disabled *bool   `json:"disabled"`
+		}{}
+		err := render.DecodeJSON(r.Body, &body)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+		if body.Role != nil {
+			if errs := validation.Role(*body.Role); len(errs) > 0 {
+				httpx.LogInvalid(w, "request.validate", errs)
+				return
+			}
+		}
+
+		if !canManageUser(app, w, r, username) {
+			return
+		}
+		if body.Role != nil && !setUserRole(app, w, r, username, *body.Role) {
+			return
+		}
+		if body.Disabled != nil && !setUserDisabled(app, w, r, username, *body.Disabled) {
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Disables or enables a user. Disabled users cannot log in again,
+// and lose access when their current access token expires
+func SetUserDisabled(app app.App, disabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+		if canManageUser(app, w, r, username) && setUserDisabled(app, w, r, username, disabled) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// Will send an error response and return false on failure
+func setUserRole(app app.App, w http.ResponseWriter, r *http.Request, username string, role string) bool {
+	if isCurrentUser(r, username) {
+		httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "user.set_own_role", "you cannot change your own role")
+		return false
+	}
+	if !canGrantRole(w, r, role) {
+		return false
+	}
+
+	err := app.Users.SetRole(r.Context(), username, role)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpx.LogNotFound(w, "set_user_role", username)
+		} else {
+			httpx.LogInternalError(w, "db.set_user_role", err)
+		}
+		return false
+	}
+	return true
+}
+
+// Will send an error response and return false on failure
+func setUserDisabled(app app.App, w http.ResponseWriter, r *http.Request, username string, disabled bool) bool {
+	if disabled && isCurrentUser(r, username) {
+		httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "user.disable_self", "you cannot disable yourself")
+		return false
+	}
+
+	err := app.Users.SetDisabled(r.Context(), username, disabled)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpx.LogNotFound(w, "set_user_disabled", username)
+		} else {
+			httpx.LogInternalError(w, "db.set_user_disabled", err)
+		}
+		return false
+	}
+	return true
+}
+
+func DeleteUser(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+		if isCurrentUser(r, username) {
+			httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "user.delete_self", "you cannot delete yourself")
+			return
+		}
+		if !canManageUser(app, w, r, username) {
+			return
+		}
+
+		err := app.Users.Delete(r.Context(), username)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "delete_user", username)
+			} else if errors.Is(err, store.ErrConflict) {
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "db.delete_user.owner", "user %q still owns surveys: transfer them first", username)
+			} else {
+				httpx.LogInternalError(w, "db.delete_user", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Sets a new password for a user, revoking their refresh tokens.
+// The password is generated unless given, and then disclosed only in this response
+func ResetUserPassword(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+
+		body := struct {
+			Password string `json:"password"`
+		}{}
+		err := render.DecodeJSON(r.Body, &body)
+		if err != nil && !errors.Is(err, io.EOF) {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+		if body.Password != "" {
+			if errs := validation.Password(body.Password); len(errs) > 0 {
+				httpx.LogInvalid(w, "request.validate", errs)
+				return
+			}
+		}
+
+		if !canManageUser(app, w, r, username) {
+			return
+		}
+
+		password, hash, ok := newPassword(w, body.Password)
+		if !ok {
+			return
+		}
+
+		err = app.Users.SetPassword(r.Context(), username, hash)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "set_password", username)
+			} else {
+				httpx.LogInternalError(w, "db.set_password", err)
+			}
+			return
+		}
+
+		if body.Password != "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		render.JSON(w, r, map[string]any{
+			"password": password,
+		})
+	}
+}
+
+// Tells whether the request is made by the given user
+func isCurrentUser(r *http.Request, username string) bool {
+	return auth.Username(r) == username
+}
+
+// Tells whether the request is made by an owner of the deployment
+func isOwner(r *http.Request) bool {
+	return auth.HasRole(auth.ClaimedUserRole(r), auth.RoleOwner)
+}
+
+// Only owners of the deployment may make other owners.
+// Will send an error response and return false otherwise
+func canGrantRole(w http.ResponseWriter, r *http.Request, role string) bool {
+	if role == auth.RoleOwner && !isOwner(r) {
+		httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "user.grant_owner", "only owners can grant the %s role", auth.RoleOwner)
+		return false
+	}
+	return true
+}
+
+// Only owners of the deployment may manage other owners.
+// Will send an error response and return false otherwise, or if the user does not exist
+func canManageUser(app app.App, w http.ResponseWriter, r *http.Request, username string) bool {
+	user, err := app.Users.Get(r.Context(), username)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpx.LogNotFound(w, "get_user", username)
+		} else {
+			httpx.LogInternalError(w, "db.get_user", err)
+		}
+		return false
+	}
+
+	if user.Role == auth.RoleOwner && !isOwner(r) {
+		httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "user.manage_owner", "only owners can manage other owners")
+		return false
+	}
+	return true
+}
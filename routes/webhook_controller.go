@@ -0,0 +1,298 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
+)
+
+const (
+	defaultDeliveries = 50
+	maxDeliveries     = 500
+)
+
+// Body of the requests creating or updating a webhook
+type webhookBody struct {
+	SurveyID *int     `json:"survey_id"`
+	URL      string   `json:"url"`
+	Secret   string   `json:"secret"`
+	Events   []string `json:"events"`
+	// Defaults to true
+	Active *bool `json:"active"`
+}
+
+// Decodes and checks a webhook definition of the active workspace from the request body.
+// Will send an error response and return false if invalid
+func decodeWebhook(app app.App, w http.ResponseWriter, r *http.Request) (model.Webhook, bool) {
+	body := webhookBody{}
+	err := render.DecodeJSON(r.Body, &body)
+	if err != nil {
+		httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+		return model.Webhook{}, false
+	}
+
+	webhook := model.Webhook{
+		SurveyID:    body.SurveyID,
+		URL:         body.URL,
+		Secret:      body.Secret,
+		Events:      body.Events,
+		Active:      body.Active == nil || *body.Active,
+		WorkspaceID: auth.ClaimedWorkspace(r),
+	}
+	errs := validation.Webhook(webhook)
+	if webhook.SurveyID != nil {
+		var survey model.Survey
+		survey, err = app.Surveys.Get(r.Context(), *webhook.SurveyID)
+		if errors.Is(err, store.ErrNotFound) || err == nil && survey.WorkspaceID != webhook.WorkspaceID {
+			errs = append(errs, validation.Error{Path: "survey_id", Message: "survey not found"})
+		} else if err != nil {
+			httpx.LogInternalError(w, "db.get_survey", err)
+			return webhook, false
+		}
+	}
+	if len(errs) > 0 {
+		httpx.LogInvalid(w, "request.validate", errs)
+		return webhook, false
+	}
+	return webhook, true
+}
+
+// Registers a webhook. Its secret is generated unless given, and disclosed only in this response
+func CreateWebhook(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook, ok := decodeWebhook(app, w, r)
+		if !ok {
+			return
+		}
+
+		if webhook.Secret == "" {
+			var err error
+			webhook.Secret, err = randomToken()
+			if err != nil {
+				httpx.LogInternalError(w, "webhook.generate_secret", err)
+				return
+			}
+		}
+
+		webhookId, err := app.Webhooks.Create(r.Context(), webhook)
+		if err != nil {
+			httpx.LogInternalError(w, "db.insert_webhook", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, map[string]any{
+			"id":     webhookId,
+			"secret": webhook.Secret,
+		})
+	}
+}
+
+func ListWebhooks(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhooks, err := app.Webhooks.List(r.Context(), auth.ClaimedWorkspace(r))
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_webhooks", err)
+			return
+		}
+
+		for i := range webhooks {
+			webhooks[i].Secret = ""
+		}
+		render.JSON(w, r, map[string]any{
+			"webhooks": webhooks,
+		})
+	}
+}
+
+func GetWebhook(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhookId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		webhook, err := app.Webhooks.Get(r.Context(), webhookId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_webhook", webhookId)
+			} else {
+				httpx.LogInternalError(w, "db.get_webhook", err)
+			}
+			return
+		}
+
+		webhook.Secret = ""
+		render.JSON(w, r, webhook)
+	}
+}
+
+// Replaces a webhook definition. The secret is kept unless a new one is given
+func UpdateWebhook(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhookId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		webhook, ok := decodeWebhook(app, w, r)
+		if !ok {
+			return
+		}
+		webhook.ID = webhookId
+
+		err = app.Webhooks.Update(r.Context(), webhook)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "update_webhook", webhookId)
+			} else {
+				httpx.LogInternalError(w, "db.update_webhook", err)
+			}
+			return
+		}
+
+		// pending deliveries may be due, if the webhook was reactivated
+		app.Dispatcher.Notify()
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func DeleteWebhook(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhookId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		err = app.Webhooks.Delete(r.Context(), webhookId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "delete_webhook", webhookId)
+			} else {
+				httpx.LogInternalError(w, "db.delete_webhook", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Lists the latest deliveries to a webhook, with the outcome of their last attempt.
+// Filter by state with ?status=pending|delivered|dead, and bound the list with ?limit
+func ListWebhookDeliveries(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhookId, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", model.DeliveryPending, model.DeliveryDelivered, model.DeliveryDead:
+		default:
+			httpx.LogStatusMsg(w, http.StatusBadRequest, log.DebugLevel, "request.get_query_param.status", "unknown delivery status %q", status)
+			return
+		}
+		limit, ok := getIntParam(w, r, "limit", defaultDeliveries, 1, maxDeliveries)
+		if !ok {
+			return
+		}
+
+		_, err = app.Webhooks.Get(r.Context(), webhookId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_webhook", webhookId)
+			} else {
+				httpx.LogInternalError(w, "db.get_webhook", err)
+			}
+			return
+		}
+
+		deliveries, err := app.Webhooks.ListDeliveries(r.Context(), webhookId, status, limit)
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_deliveries", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"deliveries": deliveries,
+		})
+	}
+}
+
+// Gets a delivery to a webhook, with the history of its attempts
+func GetWebhookDelivery(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhookId, deliveryId, ok := getDeliveryParams(w, r)
+		if !ok {
+			return
+		}
+
+		delivery, err := app.Webhooks.GetDelivery(r.Context(), webhookId, deliveryId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "get_delivery", []int{webhookId, deliveryId})
+			} else {
+				httpx.LogInternalError(w, "db.get_delivery", err)
+			}
+			return
+		}
+
+		render.JSON(w, r, delivery)
+	}
+}
+
+// Queues a delivery again, dead or not, for an immediate attempt
+func RedeliverWebhookDelivery(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhookId, deliveryId, ok := getDeliveryParams(w, r)
+		if !ok {
+			return
+		}
+
+		err := app.Webhooks.Redeliver(r.Context(), webhookId, deliveryId)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "redeliver", []int{webhookId, deliveryId})
+			} else {
+				httpx.LogInternalError(w, "db.redeliver", err)
+			}
+			return
+		}
+		app.Dispatcher.Notify()
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// Reads the webhook and delivery ids from the URL.
+// Will send an error response and return false if invalid
+func getDeliveryParams(w http.ResponseWriter, r *http.Request) (webhookId int, deliveryId int, ok bool) {
+	webhookId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.id")
+		return
+	}
+	deliveryId, err = strconv.Atoi(chi.URLParam(r, "delivery"))
+	if err != nil {
+		httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.delivery")
+		return
+	}
+	return webhookId, deliveryId, true
+}
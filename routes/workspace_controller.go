@@ -0,0 +1,346 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/mbolis/quick-survey/app"
+	"github.com/mbolis/quick-survey/auth"
+	"github.com/mbolis/quick-survey/httpx"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/store"
+	"github.com/mbolis/quick-survey/validation"
+)
+
+// Creates a workspace, with the current user as its owner
+func CreateWorkspace(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			Name string `json:"name"`
+		}{}
+		err := render.DecodeJSON(r.Body, &body)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+
+		body.Name = strings.TrimSpace(body.Name)
+
+		if errs := validation.WorkspaceName(body.Name); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
+			return
+		}
+
+		workspaceId, err := app.Workspaces.Create(r.Context(), body.Name)
+		if err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "db.insert_workspace.conflict", "workspace %q already exists", body.Name)
+			} else {
+				httpx.LogInternalError(w, "db.insert_workspace", err)
+			}
+			return
+		}
+
+		err = app.Workspaces.AddMember(r.Context(), workspaceId, auth.Username(r), auth.RoleOwner)
+		if err != nil {
+			httpx.LogInternalError(w, "db.add_member", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, map[string]any{
+			"id":   workspaceId,
+			"name": body.Name,
+		})
+	}
+}
+
+// Lists every workspace to users whose deployment role allows it,
+// otherwise those they are a member of, with their role in each
+func ListWorkspaces(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var workspaces []model.Workspace
+		var err error
+		if auth.Can(auth.ClaimedUserRole(r), auth.WorkspacesManage) {
+			workspaces, err = app.Workspaces.List(r.Context())
+		} else {
+			workspaces, err = app.Workspaces.ListFor(r.Context(), auth.Username(r))
+		}
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_workspaces", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"workspaces": workspaces,
+			"active":     auth.ClaimedWorkspace(r),
+		})
+	}
+}
+
+// Workspace whose members are managed: the one in the URL, if any, or else the active one.
+// Will send an error response and return false if it does not exist
+func getMembersWorkspace(app app.App, w http.ResponseWriter, r *http.Request) (int, bool) {
+	param := chi.URLParam(r, "workspace")
+	if param == "" {
+		return auth.ClaimedWorkspace(r), true
+	}
+
+	workspaceId, err := strconv.Atoi(param)
+	if err != nil {
+		httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.get_url_param.workspace")
+		return 0, false
+	}
+	_, err = app.Workspaces.Get(r.Context(), workspaceId)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpx.LogNotFound(w, "get_workspace", workspaceId)
+		} else {
+			httpx.LogInternalError(w, "db.get_workspace", err)
+		}
+		return 0, false
+	}
+	return workspaceId, true
+}
+
+func ListMembers(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceId, ok := getMembersWorkspace(app, w, r)
+		if !ok {
+			return
+		}
+
+		members, err := app.Workspaces.ListMembers(r.Context(), workspaceId)
+		if err != nil {
+			httpx.LogInternalError(w, "db.get_members", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"members": members,
+		})
+	}
+}
+
+// Invites an existing user to a workspace, as a viewer unless another role is given
+func InviteMember(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceId, ok := getMembersWorkspace(app, w, r)
+		if !ok {
+			return
+		}
+
+		body := struct {
+			Username string `json:"username"`
+			Role     string `json:"role"`
+		}{}
+		err := render.DecodeJSON(r.Body, &body)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+		if body.Role == "" {
+			body.Role = auth.RoleViewer
+		}
+
+		if errs := validation.Role(body.Role); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
+			return
+		}
+		if !canGrantMemberRole(w, r, workspaceId, body.Role) {
+			return
+		}
+
+		err = app.Workspaces.AddMember(r.Context(), workspaceId, body.Username, body.Role)
+		if err != nil {
+			if errors.Is(err, store.ErrConflict) {
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "db.add_member.conflict", "user %q is already a member", body.Username)
+			} else if errors.Is(err, store.ErrNotFound) {
+				httpx.LogStatusMsg(w, http.StatusUnprocessableEntity, log.DebugLevel, "db.add_member.unknown_user", "no such user: %q", body.Username)
+			} else {
+				httpx.LogInternalError(w, "db.add_member", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		render.JSON(w, r, map[string]any{
+			"username": body.Username,
+			"role":     body.Role,
+		})
+	}
+}
+
+// Changes the role of a member of a workspace, revoking their refresh tokens so that it applies from their next login
+func UpdateMember(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceId, ok := getMembersWorkspace(app, w, r)
+		if !ok {
+			return
+		}
+		username := chi.URLParam(r, "username")
+
+		body := struct {
+			Role string `json:"role"`
+		}{}
+		err := render.DecodeJSON(r.Body, &body)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+		if errs := validation.Role(body.Role); len(errs) > 0 {
+			httpx.LogInvalid(w, "request.validate", errs)
+			return
+		}
+
+		if isCurrentUser(r, username) {
+			httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "member.set_own_role", "you cannot change your own role")
+			return
+		}
+		if !canManageMember(app, w, r, workspaceId, username) || !canGrantMemberRole(w, r, workspaceId, body.Role) {
+			return
+		}
+
+		err = app.Workspaces.SetMemberRole(r.Context(), workspaceId, username, body.Role)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "set_member_role", username)
+			} else {
+				httpx.LogInternalError(w, "db.set_member_role", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Removes a member from a workspace, with the access granted to them there
+func RemoveMember(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		workspaceId, ok := getMembersWorkspace(app, w, r)
+		if !ok {
+			return
+		}
+		username := chi.URLParam(r, "username")
+
+		if isCurrentUser(r, username) {
+			httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "member.remove_self", "you cannot remove yourself")
+			return
+		}
+		if !canManageMember(app, w, r, workspaceId, username) {
+			return
+		}
+
+		err := app.Workspaces.RemoveMember(r.Context(), workspaceId, username)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				httpx.LogNotFound(w, "remove_member", username)
+			} else if errors.Is(err, store.ErrConflict) {
+				httpx.LogStatusMsg(w, http.StatusConflict, log.DebugLevel, "db.remove_member.owner", "user %q still owns surveys here: transfer them first", username)
+			} else {
+				httpx.LogInternalError(w, "db.remove_member", err)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// Transfers every survey of the active workspace owned by a member to another, as when the first leaves
+func TransferMemberSurveys(app app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := chi.URLParam(r, "username")
+
+		body := struct {
+			To string `json:"to"`
+		}{}
+		err := render.DecodeJSON(r.Body, &body)
+		if err != nil {
+			httpx.LogStatus(w, http.StatusBadRequest, log.DebugLevel, "request.parse_body")
+			return
+		}
+
+		if !checkMember(app, w, r, username) {
+			return
+		}
+		if !checkNewOwner(app, w, r, body.To) {
+			return
+		}
+
+		n, err := app.Shares.TransferAll(r.Context(), auth.ClaimedWorkspace(r), username, body.To)
+		if err != nil {
+			httpx.LogInternalError(w, "db.transfer_surveys", err)
+			return
+		}
+
+		render.JSON(w, r, map[string]any{
+			"transferred": n,
+		})
+	}
+}
+
+// Gets a member of the active workspace.
+// Will send an error response and return false if the user is not one
+func getMember(app app.App, w http.ResponseWriter, r *http.Request, username string) (model.Member, bool) {
+	member, err := app.Workspaces.GetMember(r.Context(), auth.ClaimedWorkspace(r), username)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpx.LogStatusMsg(w, http.StatusUnprocessableEntity, log.DebugLevel, "member.unknown", "user %q is not a member of this workspace", username)
+		} else {
+			httpx.LogInternalError(w, "db.get_member", err)
+		}
+		return member, false
+	}
+	return member, true
+}
+
+// Will send an error response and return false unless the user is a member of the active workspace
+func checkMember(app app.App, w http.ResponseWriter, r *http.Request, username string) bool {
+	_, ok := getMember(app, w, r, username)
+	return ok
+}
+
+// Tells whether the request is made by an owner of the workspace, or by someone managing every workspace
+func isWorkspaceOwner(r *http.Request, workspaceId int) bool {
+	if auth.Can(auth.ClaimedUserRole(r), auth.WorkspacesManage) {
+		return true
+	}
+	return workspaceId == auth.ClaimedWorkspace(r) && auth.HasRole(auth.ClaimedRoles(r), auth.RoleOwner)
+}
+
+// Only owners of the workspace may make other owners.
+// Will send an error response and return false otherwise
+func canGrantMemberRole(w http.ResponseWriter, r *http.Request, workspaceId int, role string) bool {
+	if role == auth.RoleOwner && !isWorkspaceOwner(r, workspaceId) {
+		httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "member.grant_owner", "only owners can grant the %s role", auth.RoleOwner)
+		return false
+	}
+	return true
+}
+
+// Only owners of the workspace may manage its other owners.
+// Will send an error response and return false otherwise, or if the user is not a member
+func canManageMember(app app.App, w http.ResponseWriter, r *http.Request, workspaceId int, username string) bool {
+	member, err := app.Workspaces.GetMember(r.Context(), workspaceId, username)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			httpx.LogNotFound(w, "get_member", username)
+		} else {
+			httpx.LogInternalError(w, "db.get_member", err)
+		}
+		return false
+	}
+
+	if member.Role == auth.RoleOwner && !isWorkspaceOwner(r, workspaceId) {
+		httpx.LogStatusMsg(w, http.StatusForbidden, log.DebugLevel, "member.manage_owner", "only owners can manage other owners")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,290 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/mbolis/quick-survey/export"
+	"github.com/mbolis/quick-survey/model"
+)
+
+// Contingency table of the answers to two fields, with row and column percentages
+// and Pearson's chi-square test of independence
+type CrossTab struct {
+	Row    *Axis `json:"row"`
+	Column *Axis `json:"column"`
+	// Counts by row category, then column category
+	Counts         [][]int     `json:"counts"`
+	RowPercents    [][]float64 `json:"row_percents"`
+	ColumnPercents [][]float64 `json:"column_percents"`
+	RowTotals      []int       `json:"row_totals"`
+	ColumnTotals   []int       `json:"column_totals"`
+	Total          int         `json:"total"`
+	// Submissions left out as either field is unanswered
+	Missing   int        `json:"missing"`
+	ChiSquare *ChiSquare `json:"chi_square"`
+
+	pairs [][2]any
+}
+
+// Field whose answers are split along one side of the table
+type Axis struct {
+	Name       string     `json:"name"`
+	Label      string     `json:"label"`
+	Type       string     `json:"type"`
+	Categories []Category `json:"categories"`
+
+	field model.SurveyField
+	bins  int
+	index map[string]int
+	// range of number fields
+	min, max float64
+	seen     bool
+}
+
+type Category struct {
+	Label string `json:"label"`
+	// Answer value, for select and checkbox fields
+	Value any `json:"value"`
+	// Bin range, for number fields
+	From *float64 `json:"from,omitempty"`
+	To   *float64 `json:"to,omitempty"`
+}
+
+type ChiSquare struct {
+	Statistic float64 `json:"statistic"`
+	DF        int     `json:"df"`
+	// Left out when there are no degrees of freedom
+	PValue *float64 `json:"p_value"`
+}
+
+// Creates an empty CrossTab between two fields; number fields are split into the given number of bins
+func NewCrossTab(row, column model.SurveyField, bins int) (*CrossTab, error) {
+	if bins < 1 {
+		bins = DefaultBins
+	}
+	for _, f := range []model.SurveyField{row, column} {
+		switch f.Type {
+		case "select", "checkbox", "number":
+		default:
+			return nil, fmt.Errorf("field %q of type %q cannot be cross-tabulated", f.Name, f.Type)
+		}
+	}
+	return &CrossTab{Row: newAxis(row, bins), Column: newAxis(column, bins)}, nil
+}
+
+func newAxis(f model.SurveyField, bins int) *Axis {
+	a := &Axis{Name: f.Name, Label: f.Label, Type: f.Type, field: f, bins: bins, index: map[string]int{}}
+	switch f.Type {
+	case "select":
+		for _, o := range f.Options {
+			a.add(o.Value, o.Label)
+		}
+	case "checkbox":
+		a.add(true, "true")
+		a.add(false, "false")
+	}
+	return a
+}
+
+func (a *Axis) add(value any, label string) {
+	a.index[export.Text(value)] = len(a.Categories)
+	a.Categories = append(a.Categories, Category{Label: label, Value: value})
+}
+
+// Accounts for a submission in the table
+func (c *CrossTab) Add(sub model.Submission) {
+	row := sub.Fields[c.Row.Name]
+	col := sub.Fields[c.Column.Name]
+	if !c.Row.accepts(row.Value) || !c.Column.accepts(col.Value) {
+		c.Missing++
+		return
+	}
+
+	// values that are no longer among the options get their own category
+	c.Row.observe(row)
+	c.Column.observe(col)
+	c.pairs = append(c.pairs, [2]any{row.Value, col.Value})
+}
+
+func (a *Axis) accepts(value any) bool {
+	switch a.Type {
+	case "checkbox":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		n, ok := value.(float64)
+		return ok && !math.IsNaN(n) && !math.IsInf(n, 0)
+	}
+	return !IsEmpty(value)
+}
+
+func (a *Axis) observe(answer model.SubmissionField) {
+	switch a.Type {
+	case "select":
+		if _, ok := a.index[export.Text(answer.Value)]; !ok {
+			label := answer.ValueLabel
+			if label == "" {
+				label = export.Text(answer.Value)
+			}
+			a.add(answer.Value, label)
+		}
+	case "number":
+		n := answer.Value.(float64)
+		if !a.seen || n < a.min {
+			a.min = n
+		}
+		if !a.seen || n > a.max {
+			a.max = n
+		}
+		a.seen = true
+	}
+}
+
+// Turns number ranges into bins, once all values are known
+func (a *Axis) finish() {
+	if a.Type != "number" || !a.seen {
+		return
+	}
+	bins := Histogram(nil, a.min, a.max, a.bins)
+	for _, b := range bins {
+		from, to := b.From, b.To
+		a.Categories = append(a.Categories, Category{
+			Label: fmt.Sprintf("%g–%g", from, to),
+			From:  &from,
+			To:    &to,
+		})
+	}
+}
+
+func (a *Axis) category(value any) int {
+	if a.Type == "number" {
+		if a.min == a.max {
+			return 0
+		}
+		return BinIndex(value.(float64), a.min, a.max, a.bins)
+	}
+	return a.index[export.Text(value)]
+}
+
+// Completes the table and its statistics, once all submissions are added
+func (c *CrossTab) Finish() *CrossTab {
+	c.Row.finish()
+	c.Column.finish()
+	rows, cols := len(c.Row.Categories), len(c.Column.Categories)
+
+	c.Counts = make([][]int, rows)
+	for i := range c.Counts {
+		c.Counts[i] = make([]int, cols)
+	}
+	c.RowTotals = make([]int, rows)
+	c.ColumnTotals = make([]int, cols)
+	for _, p := range c.pairs {
+		i, j := c.Row.category(p[0]), c.Column.category(p[1])
+		c.Counts[i][j]++
+		c.RowTotals[i]++
+		c.ColumnTotals[j]++
+		c.Total++
+	}
+	c.pairs = nil
+
+	c.RowPercents = make([][]float64, rows)
+	c.ColumnPercents = make([][]float64, rows)
+	for i := range c.Counts {
+		c.RowPercents[i] = make([]float64, cols)
+		c.ColumnPercents[i] = make([]float64, cols)
+		for j, n := range c.Counts[i] {
+			c.RowPercents[i][j] = 100 * ratio(n, c.RowTotals[i])
+			c.ColumnPercents[i][j] = 100 * ratio(n, c.ColumnTotals[j])
+		}
+	}
+
+	c.ChiSquare = c.chiSquare()
+	return c
+}
+
+// Pearson's chi-square test, ignoring empty rows and columns
+func (c *CrossTab) chiSquare() *ChiSquare {
+	chi := &ChiSquare{}
+	rows, cols := 0, 0
+	for _, t := range c.RowTotals {
+		if t > 0 {
+			rows++
+		}
+	}
+	for _, t := range c.ColumnTotals {
+		if t > 0 {
+			cols++
+		}
+	}
+	if rows < 2 || cols < 2 {
+		return chi
+	}
+
+	for i, rt := range c.RowTotals {
+		for j, ct := range c.ColumnTotals {
+			if rt == 0 || ct == 0 {
+				continue
+			}
+			expected := float64(rt) * float64(ct) / float64(c.Total)
+			diff := float64(c.Counts[i][j]) - expected
+			chi.Statistic += diff * diff / expected
+		}
+	}
+	chi.DF = (rows - 1) * (cols - 1)
+	p := gammaQ(float64(chi.DF)/2, chi.Statistic/2)
+	chi.PValue = &p
+	return chi
+}
+
+// Regularized upper incomplete gamma function Q(a, x),
+// by series expansion for x < a+1 and continued fraction otherwise
+func gammaQ(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lg, _ := math.Lgamma(a)
+	prefix := math.Exp(-x + a*math.Log(x) - lg)
+
+	const (
+		maxIter = 1000
+		eps     = 1e-15
+		tiny    = 1e-300
+	)
+
+	if x < a+1 {
+		sum, term := 1/a, 1/a
+		for n := 1; n < maxIter; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*eps {
+				break
+			}
+		}
+		return math.Max(0, 1-sum*prefix)
+	}
+
+	// modified Lentz's method
+	b := x + 1 - a
+	cf, d := 1/tiny, 1/b
+	h := d
+	for n := 1; n < maxIter; n++ {
+		an := -float64(n) * (float64(n) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		cf = b + an/cf
+		if math.Abs(cf) < tiny {
+			cf = tiny
+		}
+		d = 1 / d
+		delta := d * cf
+		h *= delta
+		if math.Abs(delta-1) < eps {
+			break
+		}
+	}
+	return prefix * h
+}
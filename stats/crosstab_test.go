@@ -0,0 +1,234 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+func TestGammaQ(t *testing.T) {
+	tests := []struct {
+		name string
+		a, x float64
+		want float64
+	}{
+		{"zero x", 2, 0, 1},
+		{"negative x", 2, -1, 1},
+		// Q(1, x) = e^-x
+		{"exponential, series", 1, 0.5, math.Exp(-0.5)},
+		{"exponential, continued fraction", 1, 3, math.Exp(-3)},
+		// Q(n, x) = e^-x * sum of x^k/k! for k < n
+		{"integer a, series", 5, 2, 7 * math.Exp(-2)},
+		{"integer a, continued fraction", 3, 10, 61 * math.Exp(-10)},
+		// Q(1/2, x) = erfc(sqrt(x))
+		{"half a, series", 0.5, 0.25, math.Erfc(0.5)},
+		{"half a, continued fraction", 0.5, 1.9207, math.Erfc(math.Sqrt(1.9207))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := gammaQ(tt.a, tt.x)
+			if math.Abs(got-tt.want) > 1e-9*tt.want {
+				t.Errorf("gammaQ(%g, %g) = %g, want %g", tt.a, tt.x, got, tt.want)
+			}
+		})
+	}
+}
+
+var (
+	colorField = model.SurveyField{Name: "color", Label: "Color", Type: "select", Options: []model.FieldOption{
+		{Value: "red", Label: "Red"},
+		{Value: "blue", Label: "Blue"},
+	}}
+	agreeField = model.SurveyField{Name: "agree", Label: "Agree", Type: "checkbox"}
+	ageField   = model.SurveyField{Name: "age", Label: "Age", Type: "number"}
+)
+
+func answers(values map[string]any) model.Submission {
+	s := model.Submission{Fields: map[string]model.SubmissionField{}}
+	for name, v := range values {
+		s.Fields[name] = model.SubmissionField{Name: name, Value: v}
+	}
+	return s
+}
+
+// Submissions answering color and agree, n times each pair
+func colorAgree(counts map[string]map[bool]int) []model.Submission {
+	subs := []model.Submission{}
+	for color, byAgree := range counts {
+		for agree, n := range byAgree {
+			for i := 0; i < n; i++ {
+				subs = append(subs, answers(map[string]any{"color": color, "agree": agree}))
+			}
+		}
+	}
+	return subs
+}
+
+func TestCrossTab(t *testing.T) {
+	tests := []struct {
+		name        string
+		row, column model.SurveyField
+		bins        int
+		subs        []model.Submission
+		wantRows    []string
+		wantCounts  [][]int
+		wantMissing int
+		// chi-square statistic and degrees of freedom; no p-value if df is 0
+		wantChi float64
+		wantDF  int
+	}{
+		{
+			name: "two by two",
+			row:  colorField, column: agreeField,
+			subs: colorAgree(map[string]map[bool]int{
+				"red":  {true: 10, false: 20},
+				"blue": {true: 30, false: 40},
+			}),
+			wantRows:   []string{"Red", "Blue"},
+			wantCounts: [][]int{{10, 20}, {30, 40}},
+			// expected counts 12, 18, 28, 42
+			wantChi: 4.0/12 + 4.0/18 + 4.0/28 + 4.0/42,
+			wantDF:  1,
+		},
+		{
+			name: "independent answers",
+			row:  colorField, column: agreeField,
+			subs: colorAgree(map[string]map[bool]int{
+				"red":  {true: 5, false: 5},
+				"blue": {true: 10, false: 10},
+			}),
+			wantRows:   []string{"Red", "Blue"},
+			wantCounts: [][]int{{5, 5}, {10, 10}},
+			wantChi:    0,
+			wantDF:     1,
+		},
+		{
+			name: "single row has no test",
+			row:  colorField, column: agreeField,
+			subs: colorAgree(map[string]map[bool]int{
+				"red": {true: 3, false: 1},
+			}),
+			wantRows:   []string{"Red", "Blue"},
+			wantCounts: [][]int{{3, 1}, {0, 0}},
+			wantDF:     0,
+		},
+		{
+			name: "unanswered and removed options",
+			row:  colorField, column: agreeField,
+			subs: []model.Submission{
+				answers(map[string]any{"color": "red", "agree": true}),
+				answers(map[string]any{"color": "green", "agree": false}),
+				answers(map[string]any{"color": "", "agree": true}),
+				answers(map[string]any{"color": "blue"}),
+				answers(map[string]any{"agree": "yes", "color": "red"}),
+			},
+			wantRows:    []string{"Red", "Blue", "green"},
+			wantCounts:  [][]int{{1, 0}, {0, 0}, {0, 1}},
+			wantMissing: 3,
+			wantChi:     2,
+			wantDF:      1,
+		},
+		{
+			name: "numbers in bins",
+			row:  ageField, column: agreeField, bins: 2,
+			subs: []model.Submission{
+				answers(map[string]any{"age": 20.0, "agree": true}),
+				answers(map[string]any{"age": 29.0, "agree": true}),
+				answers(map[string]any{"age": 31.0, "agree": false}),
+				answers(map[string]any{"age": 40.0, "agree": false}),
+			},
+			wantRows:   []string{"20–30", "30–40"},
+			wantCounts: [][]int{{2, 0}, {0, 2}},
+			wantChi:    4,
+			wantDF:     1,
+		},
+		{
+			name: "equal numbers in one bin",
+			row:  ageField, column: agreeField, bins: 2,
+			subs: []model.Submission{
+				answers(map[string]any{"age": 30.0, "agree": true}),
+				answers(map[string]any{"age": 30.0, "agree": false}),
+			},
+			wantRows:   []string{"30–30"},
+			wantCounts: [][]int{{1, 1}},
+			wantDF:     0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewCrossTab(tt.row, tt.column, tt.bins)
+			if err != nil {
+				t.Fatalf("NewCrossTab: %v", err)
+			}
+			for _, s := range tt.subs {
+				c.Add(s)
+			}
+			c.Finish()
+
+			rows := []string{}
+			for _, cat := range c.Row.Categories {
+				rows = append(rows, cat.Label)
+			}
+			if !reflect.DeepEqual(rows, tt.wantRows) {
+				t.Errorf("rows = %q, want %q", rows, tt.wantRows)
+			}
+			if !reflect.DeepEqual(c.Counts, tt.wantCounts) {
+				t.Errorf("counts = %v, want %v", c.Counts, tt.wantCounts)
+			}
+			if c.Missing != tt.wantMissing {
+				t.Errorf("missing = %d, want %d", c.Missing, tt.wantMissing)
+			}
+
+			chi := c.ChiSquare
+			if chi.DF != tt.wantDF {
+				t.Errorf("df = %d, want %d", chi.DF, tt.wantDF)
+			}
+			if math.Abs(chi.Statistic-tt.wantChi) > 1e-9 {
+				t.Errorf("statistic = %g, want %g", chi.Statistic, tt.wantChi)
+			}
+			if tt.wantDF == 0 {
+				if chi.PValue != nil {
+					t.Errorf("p-value = %g, want none", *chi.PValue)
+				}
+				return
+			}
+			// with one degree of freedom, p = erfc(sqrt(statistic / 2))
+			wantP := math.Erfc(math.Sqrt(tt.wantChi / 2))
+			if chi.PValue == nil || math.Abs(*chi.PValue-wantP) > 1e-9 {
+				t.Errorf("p-value = %v, want %g", chi.PValue, wantP)
+			}
+		})
+	}
+}
+
+func TestNewCrossTabRejectsText(t *testing.T) {
+	text := model.SurveyField{Name: "comment", Type: "text"}
+	if _, err := NewCrossTab(colorField, text, 0); err == nil {
+		t.Error("NewCrossTab accepted a text field")
+	}
+}
+
+func TestCrossTabPercents(t *testing.T) {
+	c, _ := NewCrossTab(colorField, agreeField, 0)
+	for _, s := range colorAgree(map[string]map[bool]int{
+		"red":  {true: 1, false: 3},
+		"blue": {true: 1},
+	}) {
+		c.Add(s)
+	}
+	c.Finish()
+
+	wantRow := [][]float64{{25, 75}, {100, 0}}
+	wantColumn := [][]float64{{50, 100}, {50, 0}}
+	if !reflect.DeepEqual(c.RowPercents, wantRow) {
+		t.Errorf("row percents = %v, want %v", c.RowPercents, wantRow)
+	}
+	if !reflect.DeepEqual(c.ColumnPercents, wantColumn) {
+		t.Errorf("column percents = %v, want %v", c.ColumnPercents, wantColumn)
+	}
+	if c.Total != 5 || !reflect.DeepEqual(c.RowTotals, []int{4, 1}) || !reflect.DeepEqual(c.ColumnTotals, []int{2, 3}) {
+		t.Errorf("totals = %d %v %v, want 5 [4 1] [2 3]", c.Total, c.RowTotals, c.ColumnTotals)
+	}
+}
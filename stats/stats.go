@@ -0,0 +1,248 @@
+// Package stats computes aggregate statistics over survey submissions.
+package stats
+
+import (
+	"math"
+	"sort"
+
+	"github.com/mbolis/quick-survey/export"
+	"github.com/mbolis/quick-survey/model"
+)
+
+const DefaultBins = 10
+
+// Summary of all the submissions to a survey
+type Summary struct {
+	Submissions int      `json:"submissions"`
+	Fields      []*Field `json:"fields"`
+
+	bins int
+}
+
+// Summary of the answers to a single field.
+// Only the section matching the field type is filled in
+type Field struct {
+	Name    string `json:"name"`
+	Label   string `json:"label"`
+	Type    string `json:"type"`
+	Retired bool   `json:"retired,omitempty"`
+	// Submissions that include the field, answered or not
+	Responses int `json:"responses"`
+	// Submissions that left the field blank, or do not include it at all
+	Empty int `json:"empty"`
+	// Share of all the submissions that left the field empty
+	EmptyRate float64 `json:"empty_rate"`
+
+	Options  []*Option `json:"options,omitempty"`
+	Checkbox *Checkbox `json:"checkbox,omitempty"`
+	Number   *Number   `json:"number,omitempty"`
+
+	field  model.SurveyField
+	counts map[string]*Option
+	values []float64
+}
+
+type Option struct {
+	Value   string  `json:"value"`
+	Label   string  `json:"label"`
+	Count   int     `json:"count"`
+	Percent float64 `json:"percent"`
+}
+
+type Checkbox struct {
+	True         int     `json:"true"`
+	False        int     `json:"false"`
+	TruePercent  float64 `json:"true_percent"`
+	FalsePercent float64 `json:"false_percent"`
+}
+
+type Number struct {
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Mean      float64 `json:"mean"`
+	Median    float64 `json:"median"`
+	StdDev    float64 `json:"stddev"`
+	Histogram []Bin   `json:"histogram"`
+}
+
+// Histogram bin, including from and excluding to, except the last one which includes both
+type Bin struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+// Creates an empty Summary for the given fields; numbers are split into the given number of bins
+func NewSummary(fields []model.SurveyField, bins int) *Summary {
+	if bins < 1 {
+		bins = DefaultBins
+	}
+	s := &Summary{Fields: make([]*Field, len(fields)), bins: bins}
+	for i, f := range fields {
+		field := &Field{Name: f.Name, Label: f.Label, Type: f.Type, Retired: f.Retired, field: f}
+		if f.Type == "select" {
+			field.counts = map[string]*Option{}
+			for _, o := range f.Options {
+				opt := &Option{Value: o.Value, Label: o.Label}
+				field.Options = append(field.Options, opt)
+				field.counts[o.Value] = opt
+			}
+		}
+		s.Fields[i] = field
+	}
+	return s
+}
+
+// Accounts for a submission in the summary
+func (s *Summary) Add(sub model.Submission) {
+	s.Submissions++
+	for _, f := range s.Fields {
+		answer, ok := sub.Fields[f.Name]
+		if !ok {
+			// added after the submission, or not answered at all
+			f.Empty++
+			continue
+		}
+		f.add(answer)
+	}
+}
+
+func (f *Field) add(answer model.SubmissionField) {
+	f.Responses++
+	if IsEmpty(answer.Value) {
+		f.Empty++
+		return
+	}
+
+	switch f.Type {
+	case "select":
+		value := export.Text(answer.Value)
+		opt, ok := f.counts[value]
+		if !ok {
+			// no longer among the options
+			opt = &Option{Value: value, Label: answer.ValueLabel}
+			f.counts[value] = opt
+			f.Options = append(f.Options, opt)
+		}
+		opt.Count++
+	case "checkbox":
+		if f.Checkbox == nil {
+			f.Checkbox = &Checkbox{}
+		}
+		if b, _ := answer.Value.(bool); b {
+			f.Checkbox.True++
+		} else {
+			f.Checkbox.False++
+		}
+	case "number":
+		if n, ok := answer.Value.(float64); ok {
+			f.values = append(f.values, n)
+		}
+	}
+}
+
+// Completes the computation of the statistics, once all submissions are added
+func (s *Summary) Finish() *Summary {
+	for _, f := range s.Fields {
+		f.EmptyRate = ratio(f.Empty, s.Submissions)
+		answered := s.Submissions - f.Empty
+
+		for _, o := range f.Options {
+			o.Percent = 100 * ratio(o.Count, answered)
+		}
+		if f.Checkbox != nil {
+			f.Checkbox.TruePercent = 100 * ratio(f.Checkbox.True, answered)
+			f.Checkbox.FalsePercent = 100 * ratio(f.Checkbox.False, answered)
+		}
+		if len(f.values) > 0 {
+			f.Number = summarizeNumbers(f.values, s.bins)
+			f.values = nil
+		}
+	}
+	return s
+}
+
+func summarizeNumbers(values []float64, bins int) *Number {
+	sort.Float64s(values)
+	n := len(values)
+	num := &Number{Min: values[0], Max: values[n-1]}
+
+	sum := 0.
+	for _, v := range values {
+		sum += v
+	}
+	num.Mean = sum / float64(n)
+
+	if n%2 == 1 {
+		num.Median = values[n/2]
+	} else {
+		num.Median = (values[n/2-1] + values[n/2]) / 2
+	}
+
+	// sample standard deviation
+	if n > 1 {
+		squares := 0.
+		for _, v := range values {
+			squares += (v - num.Mean) * (v - num.Mean)
+		}
+		num.StdDev = math.Sqrt(squares / float64(n-1))
+	}
+
+	num.Histogram = Histogram(values, num.Min, num.Max, bins)
+	return num
+}
+
+// Splits the range between min and max into equal bins, counting the values in each
+func Histogram(values []float64, min, max float64, bins int) []Bin {
+	if min == max {
+		return []Bin{{From: min, To: max, Count: len(values)}}
+	}
+
+	width := (max - min) / float64(bins)
+	hist := make([]Bin, bins)
+	for i := range hist {
+		hist[i].From = min + float64(i)*width
+		hist[i].To = min + float64(i+1)*width
+	}
+	hist[bins-1].To = max
+
+	for _, v := range values {
+		hist[BinIndex(v, min, max, bins)].Count++
+	}
+	return hist
+}
+
+// Tells which of the equal bins between min and max holds the value
+func BinIndex(v, min, max float64, bins int) int {
+	if max <= min {
+		return 0
+	}
+	i := int((v - min) / (max - min) * float64(bins))
+	if i >= bins {
+		i = bins - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+// Tells whether an answer was left blank
+func IsEmpty(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+func ratio(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
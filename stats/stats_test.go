@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+func TestSummary(t *testing.T) {
+	fields := []model.SurveyField{
+		{Name: "size", Label: "Size", Type: "select", Options: []model.FieldOption{
+			{Value: "s", Label: "Small"},
+			{Value: "l", Label: "Large"},
+		}},
+		{Name: "age", Label: "Age", Type: "number"},
+	}
+	submissions := []map[string]any{
+		{"size": "s", "age": 20.0},
+		{"size": "l", "age": 30.0},
+		{"size": "s", "age": ""},
+		// submitted before the fields were added
+		{},
+	}
+
+	s := NewSummary(fields, 2)
+	for _, values := range submissions {
+		sub := model.Submission{Fields: map[string]model.SubmissionField{}}
+		for name, v := range values {
+			sub.Fields[name] = model.SubmissionField{Name: name, Value: v}
+		}
+		s.Add(sub)
+	}
+	s.Finish()
+
+	if s.Submissions != 4 {
+		t.Errorf("submissions = %d, want 4", s.Submissions)
+	}
+
+	size := s.Fields[0]
+	if size.Responses != 3 || size.Empty != 1 || size.EmptyRate != 0.25 {
+		t.Errorf("size responses = %d, empty = %d, rate = %g", size.Responses, size.Empty, size.EmptyRate)
+	}
+	wantOptions := []Option{
+		{Value: "s", Label: "Small", Count: 2, Percent: 66.67},
+		{Value: "l", Label: "Large", Count: 1, Percent: 33.33},
+	}
+	for i, o := range size.Options {
+		want := wantOptions[i]
+		if o.Value != want.Value || o.Label != want.Label || o.Count != want.Count || math.Abs(o.Percent-want.Percent) > 0.01 {
+			t.Errorf("size option %d = %+v, want %+v", i, *o, want)
+		}
+	}
+
+	age := s.Fields[1]
+	if age.Responses != 3 || age.Empty != 2 || age.EmptyRate != 0.5 {
+		t.Errorf("age responses = %d, empty = %d, rate = %g", age.Responses, age.Empty, age.EmptyRate)
+	}
+	wantNumber := &Number{
+		Min: 20, Max: 30, Mean: 25, Median: 25, StdDev: 7.0710678118654755,
+		Histogram: []Bin{{From: 20, To: 25, Count: 1}, {From: 25, To: 30, Count: 1}},
+	}
+	if !reflect.DeepEqual(age.Number, wantNumber) {
+		t.Errorf("age number = %+v, want %+v", age.Number, wantNumber)
+	}
+}
@@ -0,0 +1,114 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Bucket sizes for time series
+const (
+	IntervalMinute = "minute"
+	IntervalHour   = "hour"
+	IntervalDay    = "day"
+	IntervalWeek   = "week"
+)
+
+// Upper limit to the buckets in a series, to keep responses reasonable
+const MaxBuckets = 10000
+
+type Bucket struct {
+	// Start of the bucket, in the series time zone
+	Time  time.Time `json:"time"`
+	Count int       `json:"count"`
+}
+
+// Counts events by interval in the given location, from the first event to the last.
+// Intervals are aligned to the local clock, weeks starting on Monday.
+// If cumulative, each bucket also counts all the events before it
+func TimeSeries(times []time.Time, interval string, loc *time.Location, cumulative bool) ([]Bucket, error) {
+	start, err := bucketStart(interval)
+	if err != nil {
+		return nil, err
+	}
+	if len(times) == 0 {
+		return []Bucket{}, nil
+	}
+
+	sorted := make([]time.Time, len(times))
+	copy(sorted, times)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	buckets := []Bucket{{Time: start(sorted[0].In(loc))}}
+	for _, t := range sorted {
+		t = t.In(loc)
+		// open empty buckets until the one holding t
+		for {
+			next := nextBucket(start, interval, buckets[len(buckets)-1].Time)
+			if t.Before(next) {
+				break
+			}
+			if len(buckets) == MaxBuckets {
+				return nil, fmt.Errorf("more than %d buckets: choose a larger interval", MaxBuckets)
+			}
+			buckets = append(buckets, Bucket{Time: next})
+		}
+		buckets[len(buckets)-1].Count++
+	}
+
+	if cumulative {
+		for i := 1; i < len(buckets); i++ {
+			buckets[i].Count += buckets[i-1].Count
+		}
+	}
+	return buckets, nil
+}
+
+// Returns a function that finds the start of the bucket holding a local time
+func bucketStart(interval string) (func(time.Time) time.Time, error) {
+	switch interval {
+	case IntervalMinute:
+		return func(t time.Time) time.Time { return truncateLocal(t, time.Minute) }, nil
+	case IntervalHour:
+		return func(t time.Time) time.Time { return truncateLocal(t, time.Hour) }, nil
+	case IntervalDay:
+		return func(t time.Time) time.Time {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		}, nil
+	case IntervalWeek:
+		return func(t time.Time) time.Time {
+			monday := t.Day() - (int(t.Weekday())+6)%7
+			return time.Date(t.Year(), t.Month(), monday, 0, 0, 0, 0, t.Location())
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown interval %q", interval)
+}
+
+// Truncates to a multiple of d since the zero time, as seen on the local clock
+func truncateLocal(t time.Time, d time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(d).Add(-shift)
+}
+
+// Finds the start of the bucket following the one starting at t,
+// even across daylight saving time changes
+func nextBucket(start func(time.Time) time.Time, interval string, t time.Time) time.Time {
+	switch interval {
+	case IntervalDay:
+		return start(t.AddDate(0, 0, 1))
+	case IntervalWeek:
+		return start(t.AddDate(0, 0, 7))
+	}
+
+	step := time.Minute
+	if interval == IntervalHour {
+		step = time.Hour
+	}
+	next := start(t.Add(step))
+	if !next.After(t) {
+		// the clock went back by less than the step: keep the bucket whole
+		next = t.Add(step)
+	}
+	return next
+}
@@ -0,0 +1,157 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s not available: %v", name, err)
+	}
+	return loc
+}
+
+func utc(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestTimeSeries(t *testing.T) {
+	rome := mustLoad(t, "Europe/Rome")
+	kolkata := mustLoad(t, "Asia/Kolkata")
+
+	type bucket struct {
+		// start of the bucket, as an instant
+		time  string
+		count int
+	}
+	tests := []struct {
+		name       string
+		times      []string
+		interval   string
+		loc        *time.Location
+		cumulative bool
+		want       []bucket
+	}{
+		{
+			name:     "no events",
+			interval: IntervalDay, loc: time.UTC,
+			want: []bucket{},
+		},
+		{
+			name:     "empty buckets in between",
+			times:    []string{"2024-05-01T12:30:00Z", "2024-05-01T10:05:00Z", "2024-05-01T10:55:00Z"},
+			interval: IntervalHour, loc: time.UTC,
+			want: []bucket{{"2024-05-01T10:00:00Z", 2}, {"2024-05-01T11:00:00Z", 0}, {"2024-05-01T12:00:00Z", 1}},
+		},
+		{
+			name:     "cumulative",
+			times:    []string{"2024-05-01T10:05:00Z", "2024-05-01T10:55:00Z", "2024-05-01T12:30:00Z"},
+			interval: IntervalHour, loc: time.UTC, cumulative: true,
+			want: []bucket{{"2024-05-01T10:00:00Z", 2}, {"2024-05-01T11:00:00Z", 2}, {"2024-05-01T12:00:00Z", 3}},
+		},
+		{
+			name:     "minutes",
+			times:    []string{"2024-05-01T10:00:59Z", "2024-05-01T10:01:00Z"},
+			interval: IntervalMinute, loc: time.UTC,
+			want: []bucket{{"2024-05-01T10:00:00Z", 1}, {"2024-05-01T10:01:00Z", 1}},
+		},
+		{
+			name:     "days start at local midnight",
+			times:    []string{"2024-05-01T21:30:00Z", "2024-05-01T22:30:00Z"},
+			interval: IntervalDay, loc: rome,
+			// 23:30 and 00:30 in Rome, two hours ahead
+			want: []bucket{{"2024-04-30T22:00:00Z", 1}, {"2024-05-01T22:00:00Z", 1}},
+		},
+		{
+			name:     "hours on a half-hour offset",
+			times:    []string{"2024-01-01T10:45:00Z"},
+			interval: IntervalHour, loc: kolkata,
+			// 16:15 in Kolkata
+			want: []bucket{{"2024-01-01T10:30:00Z", 1}},
+		},
+		{
+			name:     "weeks start on Monday",
+			times:    []string{"2024-10-17T12:00:00Z", "2024-10-20T12:00:00Z", "2024-10-21T12:00:00Z"},
+			interval: IntervalWeek, loc: time.UTC,
+			want: []bucket{{"2024-10-14T00:00:00Z", 2}, {"2024-10-21T00:00:00Z", 1}},
+		},
+		{
+			name:     "day losing an hour to daylight saving time",
+			times:    []string{"2024-03-30T11:00:00Z", "2024-03-31T10:00:00Z", "2024-03-31T22:30:00Z"},
+			interval: IntervalDay, loc: rome,
+			// midnight is at 23:00 UTC before the change on March 31st, and at 22:00 UTC after it
+			want: []bucket{{"2024-03-29T23:00:00Z", 1}, {"2024-03-30T23:00:00Z", 1}, {"2024-03-31T22:00:00Z", 1}},
+		},
+		{
+			name:     "day gaining an hour from daylight saving time",
+			times:    []string{"2024-10-26T12:00:00Z", "2024-10-27T22:59:00Z"},
+			interval: IntervalDay, loc: rome,
+			want: []bucket{{"2024-10-25T22:00:00Z", 1}, {"2024-10-26T22:00:00Z", 1}},
+		},
+		{
+			name:     "hour repeated as clocks go back",
+			times:    []string{"2024-10-27T00:30:00Z", "2024-10-27T01:30:00Z", "2024-10-27T02:30:00Z"},
+			interval: IntervalHour, loc: rome,
+			// 02:30 summer time, 02:30 standard time, then 03:30
+			want: []bucket{{"2024-10-27T00:00:00Z", 1}, {"2024-10-27T01:00:00Z", 1}, {"2024-10-27T02:00:00Z", 1}},
+		},
+		{
+			name:     "hour skipped as clocks go forward",
+			times:    []string{"2024-03-31T00:30:00Z", "2024-03-31T01:30:00Z"},
+			interval: IntervalHour, loc: rome,
+			// 01:30 standard time, then 03:30 summer time
+			want: []bucket{{"2024-03-31T00:00:00Z", 1}, {"2024-03-31T01:00:00Z", 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			times := make([]time.Time, len(tt.times))
+			for i, s := range tt.times {
+				times[i] = utc(s)
+			}
+
+			buckets, err := TimeSeries(times, tt.interval, tt.loc, tt.cumulative)
+			if err != nil {
+				t.Fatalf("TimeSeries: %v", err)
+			}
+			if len(buckets) != len(tt.want) {
+				t.Fatalf("got %d buckets %v, want %d", len(buckets), buckets, len(tt.want))
+			}
+			for i, b := range buckets {
+				want := tt.want[i]
+				if !b.Time.Equal(utc(want.time)) || b.Count != want.count {
+					t.Errorf("bucket %d = %s %d, want %s %d", i, b.Time.UTC().Format(time.RFC3339), b.Count, want.time, want.count)
+				}
+				if b.Time.Location() != tt.loc {
+					t.Errorf("bucket %d is in %s, want %s", i, b.Time.Location(), tt.loc)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeSeriesErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		times    []time.Time
+		interval string
+	}{
+		{"unknown interval", []time.Time{utc("2024-05-01T10:00:00Z")}, "fortnight"},
+		{"unknown interval without events", nil, "fortnight"},
+		{"too many buckets", []time.Time{utc("2024-05-01T10:00:00Z"), utc("2024-05-10T10:00:00Z")}, IntervalMinute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := TimeSeries(tt.times, tt.interval, time.UTC, false); err == nil {
+				t.Error("TimeSeries did not fail")
+			}
+		})
+	}
+}
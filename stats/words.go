@@ -0,0 +1,239 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Options for counting terms in text answers
+type WordOptions struct {
+	// Languages whose stopwords are ignored
+	Languages []string
+	// Language of the stemmer, or empty not to stem
+	Stem string
+	// Number of consecutive words per term
+	NGram int
+	// Terms counted fewer times are left out
+	MinCount int
+	// Maximum number of terms returned, most frequent first
+	Limit int
+}
+
+type Term struct {
+	// Most frequent form of the term
+	Term string `json:"term"`
+	// Stemmed form, when stemming
+	Stem  string `json:"stem,omitempty"`
+	Count int    `json:"count"`
+	// Number of answers where the term appears
+	Documents int `json:"documents"`
+}
+
+// Counts term frequencies over text answers
+type WordCounter struct {
+	opts    WordOptions
+	stem    func(string) string
+	answers int
+	terms   map[string]*termCount
+}
+
+type termCount struct {
+	Term
+	forms   map[string]int
+	lastDoc int
+}
+
+// Stemmers by language
+var stemmers = map[string]func(string) string{
+	"en": stemEnglish,
+	"it": stemItalian,
+}
+
+// Tells whether a stopword list exists for the language
+func HasStopwords(lang string) bool {
+	return stopwords[lang] != nil
+}
+
+// Tells whether a stemmer exists for the language
+func HasStemmer(lang string) bool {
+	return stemmers[lang] != nil
+}
+
+func NewWordCounter(opts WordOptions) (*WordCounter, error) {
+	for _, lang := range opts.Languages {
+		if !HasStopwords(lang) {
+			return nil, fmt.Errorf("no stopwords for language %q", lang)
+		}
+	}
+	if opts.Stem != "" && !HasStemmer(opts.Stem) {
+		return nil, fmt.Errorf("no stemmer for language %q", opts.Stem)
+	}
+	if opts.NGram < 1 {
+		opts.NGram = 1
+	}
+
+	return &WordCounter{
+		opts:  opts,
+		stem:  stemmers[opts.Stem],
+		terms: map[string]*termCount{},
+	}, nil
+}
+
+// Counts the terms in a text answer
+func (c *WordCounter) Add(text string) {
+	c.answers++
+	words := tokenize(text)
+
+	n := c.opts.NGram
+	for i := 0; i+n <= len(words); i++ {
+		gram := words[i : i+n]
+		// n-grams may hold stopwords, but neither begin nor end with one
+		if c.isStopword(gram[0]) || c.isStopword(gram[n-1]) {
+			continue
+		}
+
+		form := strings.Join(gram, " ")
+		key := form
+		if c.stem != nil {
+			stems := make([]string, n)
+			for j, w := range gram {
+				stems[j] = c.stem(w)
+			}
+			key = strings.Join(stems, " ")
+		}
+
+		t, ok := c.terms[key]
+		if !ok {
+			t = &termCount{forms: map[string]int{}}
+			if c.stem != nil {
+				t.Stem = key
+			}
+			c.terms[key] = t
+		}
+		t.Count++
+		t.forms[form]++
+		if t.lastDoc != c.answers {
+			t.lastDoc = c.answers
+			t.Documents++
+		}
+	}
+}
+
+func (c *WordCounter) isStopword(w string) bool {
+	for _, lang := range c.opts.Languages {
+		if stopwords[lang][w] {
+			return true
+		}
+	}
+	return false
+}
+
+// Number of answers counted
+func (c *WordCounter) Answers() int {
+	return c.answers
+}
+
+// Lists the counted terms, most frequent first
+func (c *WordCounter) Terms() []Term {
+	terms := []Term{}
+	for _, t := range c.terms {
+		if t.Count < c.opts.MinCount {
+			continue
+		}
+
+		best := 0
+		for form, n := range t.forms {
+			if n > best || n == best && form < t.Term.Term {
+				t.Term.Term = form
+				best = n
+			}
+		}
+		terms = append(terms, t.Term)
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if c.opts.Limit > 0 && len(terms) > c.opts.Limit {
+		terms = terms[:c.opts.Limit]
+	}
+	return terms
+}
+
+// Splits text into lowercase words, leaving out links and mentions
+func tokenize(text string) []string {
+	words := []string{}
+	for _, chunk := range strings.Fields(strings.ToLower(text)) {
+		if strings.HasPrefix(chunk, "@") || strings.HasPrefix(chunk, "http:") ||
+			strings.HasPrefix(chunk, "https:") || strings.HasPrefix(chunk, "//") {
+			continue
+		}
+		words = append(words, strings.FieldsFunc(chunk, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})...)
+	}
+	return words
+}
+
+// Light English stemmer, that only removes plurals (Harman's S-stemmer)
+func stemEnglish(w string) string {
+	n := len(w)
+	if n < 3 || w[n-1] != 's' {
+		return w
+	}
+	switch w[n-2] {
+	case 'u', 's':
+		return w
+	case 'e':
+		if n > 3 && w[n-3] == 'i' && w[n-4] != 'a' && w[n-4] != 'e' {
+			return w[:n-3] + "y"
+		}
+		switch w[n-3] {
+		case 'i', 'a', 'o', 'e':
+			return w
+		}
+	}
+	return w[:n-1]
+}
+
+// Light Italian stemmer, that removes inflectional endings (Savoy's)
+func stemItalian(w string) string {
+	r := []rune(w)
+	n := len(r)
+	if n < 6 {
+		return w
+	}
+	for i, c := range r {
+		switch c {
+		case 'à', 'á', 'â', 'ä':
+			r[i] = 'a'
+		case 'ò', 'ó', 'ô', 'ö':
+			r[i] = 'o'
+		case 'è', 'é', 'ê', 'ë':
+			r[i] = 'e'
+		case 'ù', 'ú', 'û', 'ü':
+			r[i] = 'u'
+		case 'ì', 'í', 'î', 'ï':
+			r[i] = 'i'
+		}
+	}
+
+	switch r[n-1] {
+	case 'e', 'i':
+		if r[n-2] == 'i' || r[n-2] == 'h' {
+			return string(r[:n-2])
+		}
+		return string(r[:n-1])
+	case 'a', 'o':
+		if r[n-2] == 'i' {
+			return string(r[:n-2])
+		}
+		return string(r[:n-1])
+	}
+	return string(r)
+}
@@ -0,0 +1,249 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+// Any type that can run queries: either *sql.DB or *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Loads the active (i.e. not retired) fields of a survey, in display order.
+func getFields(ctx context.Context, q querier, surveyId int) ([]model.SurveyField, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT f.id, f.type, f.name, f.label, f.required, f.options
+		FROM survey_field f
+		WHERE f.survey_id = ?
+			AND f.retired_at IS NULL
+		ORDER BY f.position, f.id`,
+		surveyId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_survey.fields: %w", err)
+	}
+	defer rows.Close()
+
+	fields := []model.SurveyField{}
+	for rows.Next() {
+		f := model.SurveyField{}
+		var opts string
+		err = rows.Scan(&f.ID, &f.Type, &f.Name, &f.Label, &f.Required, &opts)
+		if err != nil {
+			return nil, fmt.Errorf("get_survey.fields.scan: %w", err)
+		}
+
+		if opts != "" {
+			err = json.Unmarshal([]byte(opts), &f.Options)
+			if err != nil {
+				return nil, fmt.Errorf("get_survey.fields.parse_options: %w", err)
+			}
+		}
+
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+func (s *surveyStore) AllFields(ctx context.Context, id int) ([]model.SurveyField, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT f.id, f.type, f.name, f.label, f.required, f.options, f.retired_at IS NOT NULL
+		FROM survey_field f
+		INNER JOIN survey s ON (s.id = f.survey_id)
+		WHERE f.survey_id = ?
+			AND s.deleted_at IS NULL
+		ORDER BY f.retired_at IS NOT NULL, f.position, f.id`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_all_fields: %w", err)
+	}
+	defer rows.Close()
+
+	fields := []model.SurveyField{}
+	for rows.Next() {
+		f := model.SurveyField{}
+		var opts string
+		err = rows.Scan(&f.ID, &f.Type, &f.Name, &f.Label, &f.Required, &opts, &f.Retired)
+		if err != nil {
+			return nil, fmt.Errorf("get_all_fields.scan: %w", err)
+		}
+
+		if opts != "" {
+			err = json.Unmarshal([]byte(opts), &f.Options)
+			if err != nil {
+				return nil, fmt.Errorf("get_all_fields.parse_options: %w", err)
+			}
+		}
+
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+func insertFields(ctx context.Context, tx *sql.Tx, surveyId int, fields []model.SurveyField) error {
+	names := make([]string, 0, len(fields))
+	for i, f := range fields {
+		f.Name = fieldName(f.Label, names)
+		names = append(names, f.Name)
+
+		err := insertField(ctx, tx, surveyId, i, f)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertField(ctx context.Context, tx *sql.Tx, surveyId int, position int, f model.SurveyField) error {
+	optionsJson, err := marshalOptions(f.Options)
+	if err != nil {
+		return fmt.Errorf("insert_fields.parse_options: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO survey_field (survey_id, type, name, label, required, options, position)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		surveyId, f.Type, f.Name, f.Label, f.Required, optionsJson, position,
+	)
+	if err != nil {
+		return fmt.Errorf("insert_fields.insert: %w", err)
+	}
+	return nil
+}
+
+// Reconciles the stored fields of a survey with the given ones, matching them by ID:
+// matching fields are updated in place, new ones are inserted and missing ones are retired,
+// so that existing submissions keep pointing to the field they answered.
+func updateFields(ctx context.Context, tx *sql.Tx, surveyId int, fields []model.SurveyField) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT f.id, f.name, f.retired_at IS NOT NULL
+		FROM survey_field f
+		WHERE f.survey_id = ?`,
+		surveyId,
+	)
+	if err != nil {
+		return fmt.Errorf("update_fields.get: %w", err)
+	}
+	defer rows.Close()
+
+	// names stay reserved even for retired fields
+	names := []string{}
+	current := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		var retired bool
+		err = rows.Scan(&id, &name, &retired)
+		if err != nil {
+			return fmt.Errorf("update_fields.get.scan: %w", err)
+		}
+
+		names = append(names, name)
+		if !retired {
+			current[id] = name
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("update_fields.get: %w", err)
+	}
+	rows.Close()
+
+	for i, f := range fields {
+		if _, ok := current[f.ID]; !ok {
+			f.Name = fieldName(f.Label, names)
+			names = append(names, f.Name)
+
+			err = insertField(ctx, tx, surveyId, i, f)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		delete(current, f.ID)
+
+		optionsJson, err := marshalOptions(f.Options)
+		if err != nil {
+			return fmt.Errorf("update_fields.parse_options: %w", err)
+		}
+
+		// the version only changes when the definition does, not when the field is moved
+		_, err = tx.ExecContext(ctx, `
+			UPDATE survey_field
+			SET
+				version = version + (type <> ?1 OR label <> ?2 OR required <> ?3 OR options <> ?4),
+				type = ?1,
+				label = ?2,
+				required = ?3,
+				options = ?4,
+				position = ?5
+			WHERE id = ?6`,
+			f.Type, f.Label, f.Required, optionsJson, i, f.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("update_fields.update: %w", err)
+		}
+	}
+
+	for id := range current {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE survey_field
+			SET
+				version = version+1,
+				retired_at = ?
+			WHERE id = ?`,
+			time.Now(),
+			id,
+		)
+		if err != nil {
+			return fmt.Errorf("update_fields.retire: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func marshalOptions(options []model.FieldOption) (string, error) {
+	if options == nil {
+		return "", nil
+	}
+	optionsJson, err := json.Marshal(options)
+	return string(optionsJson), err
+}
+
+var reNoIdent = regexp.MustCompile(`\W+`)
+
+// Derives a field name from its label, disambiguating it against the names already taken.
+func fieldName(label string, taken []string) string {
+	base := strings.ToLower(label)
+	base = reNoIdent.ReplaceAllLiteralString(base, " ")
+	base = strings.Join(strings.Fields(base), "_")
+	if base == "" {
+		base = "field"
+	}
+
+	name := base
+	for n := 1; contains(taken, name); n++ {
+		name = fmt.Sprintf("%s__%d", base, n)
+	}
+	return name
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,213 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/mbolis/quick-survey/model"
+)
+
+type groupStore struct {
+	db *sql.DB
+}
+
+// Creates a GroupStore backed by the given SQLite DB.
+func NewGroupStore(db *sql.DB) GroupStore {
+	return &groupStore{db}
+}
+
+func (s *groupStore) Create(ctx context.Context, workspaceId int, name string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_group (workspace_id, name, created_at)
+		VALUES (?, ?, ?)`,
+		workspaceId,
+		name,
+		time.Now(),
+	)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("insert_group: %w", err)
+	}
+	return nil
+}
+
+func (s *groupStore) Get(ctx context.Context, workspaceId int, name string) (model.Group, error) {
+	group := model.Group{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT name, created_at, workspace_id
+		FROM user_group
+		WHERE workspace_id = ?
+			AND name = ?`,
+		workspaceId,
+		name,
+	).Scan(&group.Name, &group.CreatedAt, &group.WorkspaceID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return group, ErrNotFound
+	}
+	if err != nil {
+		return group, fmt.Errorf("get_group: %w", err)
+	}
+
+	groups := []model.Group{group}
+	err = s.loadMembers(ctx, workspaceId, groups)
+	return groups[0], err
+}
+
+func (s *groupStore) List(ctx context.Context, workspaceId int) ([]model.Group, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, created_at, workspace_id
+		FROM user_group
+		WHERE workspace_id = ?
+		ORDER BY name`,
+		workspaceId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_groups: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []model.Group{}
+	for rows.Next() {
+		group := model.Group{}
+		err = rows.Scan(&group.Name, &group.CreatedAt, &group.WorkspaceID)
+		if err != nil {
+			return nil, fmt.Errorf("get_groups.scan: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get_groups: %w", err)
+	}
+
+	err = s.loadMembers(ctx, workspaceId, groups)
+	return groups, err
+}
+
+// Fills in the members of the given groups of the workspace
+func (s *groupStore) loadMembers(ctx context.Context, workspaceId int, groups []model.Group) error {
+	byName := make(map[string]*model.Group, len(groups))
+	for i := range groups {
+		groups[i].Members = []string{}
+		byName[groups[i].Name] = &groups[i]
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT group_name, username
+		FROM user_group_member
+		WHERE workspace_id = ?
+		ORDER BY group_name, username`,
+		workspaceId,
+	)
+	if err != nil {
+		return fmt.Errorf("get_members: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, username string
+		err = rows.Scan(&name, &username)
+		if err != nil {
+			return fmt.Errorf("get_members.scan: %w", err)
+		}
+		if group, ok := byName[name]; ok {
+			group.Members = append(group.Members, username)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *groupStore) Delete(ctx context.Context, workspaceId int, name string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// children first, as foreign keys restrict deletion
+	steps := []struct{ code, query string }{
+		{"delete_group.shares", `DELETE FROM survey_share WHERE workspace_id = ? AND group_name = ?`},
+		{"delete_group.members", `DELETE FROM user_group_member WHERE workspace_id = ? AND group_name = ?`},
+	}
+	for _, step := range steps {
+		_, err = tx.ExecContext(ctx, step.query, workspaceId, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.code, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM user_group WHERE workspace_id = ? AND name = ?`, workspaceId, name)
+	if err != nil {
+		return fmt.Errorf("delete_group: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete_group.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *groupStore) AddMember(ctx context.Context, workspaceId int, name string, username string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_group_member (workspace_id, group_name, username)
+		VALUES (?, ?, ?)
+		ON CONFLICT DO NOTHING`,
+		workspaceId,
+		name,
+		username,
+	)
+	if isForeignKeyError(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("add_member: %w", err)
+	}
+	return nil
+}
+
+func (s *groupStore) RemoveMember(ctx context.Context, workspaceId int, name string, username string) error {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM user_group_member
+		WHERE workspace_id = ?
+			AND group_name = ?
+			AND username = ?`,
+		workspaceId,
+		name,
+		username,
+	)
+	if err != nil {
+		return fmt.Errorf("remove_member: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("remove_member.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Tells whether the error is due to a reference to a missing row, or to deleting a referenced one
+func isForeignKeyError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// ON DELETE RESTRICT is enforced by a trigger
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey || sqliteErr.ExtendedCode == sqlite3.ErrConstraintTrigger
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+type inviteStore struct {
+	db *sql.DB
+}
+
+// Creates an InviteStore backed by the given SQLite DB.
+func NewInviteStore(db *sql.DB) InviteStore {
+	return &inviteStore{db}
+}
+
+func (s *inviteStore) Insert(ctx context.Context, surveyId int, tokens []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT 1 FROM survey
+		WHERE id = ?
+			AND deleted_at IS NULL`,
+		surveyId,
+	).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("insert_invites.survey: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO survey_invite (token, survey_id, created_at)
+		VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("insert_invites.prepare: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, token := range tokens {
+		_, err = stmt.ExecContext(ctx, token, surveyId, now)
+		if err != nil {
+			return fmt.Errorf("insert_invites.insert: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *inviteStore) ListBySurvey(ctx context.Context, surveyId int) ([]model.Invite, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			i.token, i.created_at,
+			EXISTS (
+				SELECT 1 FROM submission s
+				WHERE s.survey_id = i.survey_id
+					AND s.respondent_key = ? || i.token
+			)
+		FROM survey_invite i
+		WHERE i.survey_id = ?
+		ORDER BY i.created_at, i.token`,
+		model.RespondentKey(model.DedupeInvite, ""),
+		surveyId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_invites: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []model.Invite{}
+	for rows.Next() {
+		i := model.Invite{}
+		err = rows.Scan(&i.Token, &i.CreatedAt, &i.Used)
+		if err != nil {
+			return nil, fmt.Errorf("get_invites.scan: %w", err)
+		}
+
+		invites = append(invites, i)
+	}
+	return invites, rows.Err()
+}
+
+func (s *inviteStore) Exists(ctx context.Context, surveyId int, token string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM survey_invite
+		WHERE survey_id = ?
+			AND token = ?`,
+		surveyId,
+		token,
+	).Scan(&exists)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("get_invite.scan: %w", err)
+	}
+	return exists, nil
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+type notificationStore struct {
+	db *sql.DB
+}
+
+// Creates a NotificationStore backed by the given SQLite DB.
+func NewNotificationStore(db *sql.DB) NotificationStore {
+	return &notificationStore{db}
+}
+
+func (s *notificationStore) Subscribe(ctx context.Context, surveyId int, email string, mode string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT 1 FROM survey
+		WHERE id = ?
+			AND deleted_at IS NULL`,
+		surveyId,
+	).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("subscribe.survey: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO survey_subscriber (survey_id, email, mode, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (survey_id, email) DO UPDATE SET
+			mode = excluded.mode`,
+		surveyId,
+		email,
+		mode,
+		textTime(time.Now()),
+	)
+	if err != nil {
+		return fmt.Errorf("subscribe: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *notificationStore) ListSubscribers(ctx context.Context, surveyId int) ([]model.Subscriber, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT survey_id, email, mode, created_at, last_digest_at
+		FROM survey_subscriber
+		WHERE survey_id = ?
+		ORDER BY email`,
+		surveyId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_subscribers: %w", err)
+	}
+	return scanSubscribers(rows, "get_subscribers")
+}
+
+func scanSubscribers(rows *sql.Rows, code string) ([]model.Subscriber, error) {
+	defer rows.Close()
+
+	subscribers := []model.Subscriber{}
+	for rows.Next() {
+		sub := model.Subscriber{}
+		err := rows.Scan(&sub.SurveyID, &sub.Email, &sub.Mode, &sub.CreatedAt, &sub.LastDigestAt)
+		if err != nil {
+			return nil, fmt.Errorf("%s.scan: %w", code, err)
+		}
+		subscribers = append(subscribers, sub)
+	}
+	return subscribers, rows.Err()
+}
+
+func (s *notificationStore) Unsubscribe(ctx context.Context, surveyId int, email string) error {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM survey_subscriber
+		WHERE survey_id = ?
+			AND email = ?`,
+		surveyId,
+		email,
+	)
+	if err != nil {
+		return fmt.Errorf("unsubscribe: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("unsubscribe.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *notificationStore) DueDigests(ctx context.Context, until time.Time) ([]model.Subscriber, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ss.survey_id, ss.email, ss.mode, ss.created_at, ss.last_digest_at
+		FROM survey_subscriber ss
+		INNER JOIN survey s ON (s.id = ss.survey_id)
+		WHERE ss.mode = ?
+			AND COALESCE(ss.last_digest_at, ss.created_at) < ?
+			AND s.deleted_at IS NULL
+		ORDER BY ss.survey_id, ss.email`,
+		model.SubscribeDigest,
+		textTime(until),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_due_digests: %w", err)
+	}
+	return scanSubscribers(rows, "get_due_digests")
+}
+
+func (s *notificationStore) SetDigested(ctx context.Context, surveyId int, email string, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE survey_subscriber SET last_digest_at = ?
+		WHERE survey_id = ?
+			AND email = ?`,
+		textTime(until),
+		surveyId,
+		email,
+	)
+	if err != nil {
+		return fmt.Errorf("set_digested: %w", err)
+	}
+	return nil
+}
+
+func (s *notificationStore) QueueEmails(ctx context.Context, emails []model.Email) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO email_outbox (recipient, subject, text_body, html_body, status, attempts, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("queue_emails.prepare: %w", err)
+	}
+	defer stmt.Close()
+
+	now := textTime(time.Now())
+	for _, e := range emails {
+		_, err = stmt.ExecContext(ctx, e.To, e.Subject, e.Text, e.HTML, model.EmailPending, now, now)
+		if err != nil {
+			return fmt.Errorf("queue_emails.insert: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *notificationStore) DueEmails(ctx context.Context, now time.Time, limit int) ([]model.Email, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, recipient, subject, text_body, html_body, attempts
+		FROM email_outbox
+		WHERE status = ?
+			AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?`,
+		model.EmailPending,
+		textTime(now),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_due_emails: %w", err)
+	}
+	defer rows.Close()
+
+	emails := []model.Email{}
+	for rows.Next() {
+		e := model.Email{}
+		err = rows.Scan(&e.ID, &e.To, &e.Subject, &e.Text, &e.HTML, &e.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("get_due_emails.scan: %w", err)
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
+
+func (s *notificationStore) RecordEmailAttempt(ctx context.Context, id int, status string, nextAttemptAt time.Time, errMsg string) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE email_outbox SET
+			status = ?,
+			attempts = attempts + 1,
+			next_attempt_at = ?,
+			last_error = NULLIF(?, '')
+		WHERE id = ?`,
+		status,
+		textTime(nextAttemptAt),
+		errMsg,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("record_email_attempt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+type presentationStore struct {
+	db *sql.DB
+}
+
+// Creates a PresentationStore backed by the given SQLite DB.
+func NewPresentationStore(db *sql.DB) PresentationStore {
+	return &presentationStore{db}
+}
+
+func (s *presentationStore) Get(ctx context.Context, surveyId int) (model.Presentation, error) {
+	p := model.Presentation{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT p.survey_id, p.field_id, p.show_results, p.started_at, p.updated_at
+		FROM presentation p
+		INNER JOIN survey s ON (s.id = p.survey_id)
+		WHERE p.survey_id = ?
+			AND s.deleted_at IS NULL`,
+		surveyId,
+	).Scan(&p.SurveyID, &p.FieldID, &p.ShowResults, &p.StartedAt, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, ErrNotFound
+	}
+	if err != nil {
+		return p, fmt.Errorf("get_presentation: %w", err)
+	}
+	return p, nil
+}
+
+func (s *presentationStore) Save(ctx context.Context, p model.Presentation) error {
+	now := time.Now()
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO presentation (survey_id, field_id, show_results, started_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (survey_id) DO UPDATE SET
+			field_id = excluded.field_id,
+			show_results = excluded.show_results,
+			updated_at = excluded.updated_at`,
+		p.SurveyID,
+		p.FieldID,
+		p.ShowResults,
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("save_presentation: %w", err)
+	}
+	return nil
+}
+
+func (s *presentationStore) Delete(ctx context.Context, surveyId int) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM presentation WHERE survey_id = ?`, surveyId)
+	if err != nil {
+		return fmt.Errorf("delete_presentation: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete_presentation.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *presentationStore) InsertAnswer(ctx context.Context, answer model.PresentationAnswer) (id int, err error) {
+	if answer.Time.IsZero() {
+		answer.Time = time.Now()
+	}
+	var valueJson []byte
+	if answer.Value != nil {
+		valueJson, err = json.Marshal(answer.Value)
+		if err != nil {
+			return 0, fmt.Errorf("insert_answer.parse_value: %w", err)
+		}
+	}
+
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO presentation_answer (survey_id, field_id, value, time, ip, respondent_key)
+		VALUES (?, ?, ?, ?, ?, NULLIF(?, ''))
+		RETURNING id`,
+		answer.SurveyID,
+		answer.FieldID,
+		string(valueJson),
+		answer.Time,
+		answer.IP,
+		answer.RespondentKey,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrDuplicate
+	}
+	if err != nil {
+		return 0, fmt.Errorf("insert_answer: %w", err)
+	}
+	return id, nil
+}
+
+func (s *presentationStore) Answered(ctx context.Context, fieldId int, respondentKey string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM presentation_answer
+		WHERE field_id = ?
+			AND respondent_key = ?`,
+		fieldId,
+		respondentKey,
+	).Scan(&exists)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("get_answer.scan: %w", err)
+	}
+	return exists, nil
+}
+
+func (s *presentationStore) ListAnswers(ctx context.Context, fieldId int) ([]model.PresentationAnswer, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, survey_id, field_id, value, time, ip, IFNULL(respondent_key, '')
+		FROM presentation_answer
+		WHERE field_id = ?
+		ORDER BY id`,
+		fieldId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list_answers: %w", err)
+	}
+	defer rows.Close()
+
+	answers := []model.PresentationAnswer{}
+	for rows.Next() {
+		a := model.PresentationAnswer{}
+		var value string
+		err = rows.Scan(&a.ID, &a.SurveyID, &a.FieldID, &value, &a.Time, &a.IP, &a.RespondentKey)
+		if err != nil {
+			return nil, fmt.Errorf("list_answers.scan: %w", err)
+		}
+		if value != "" {
+			err = json.Unmarshal([]byte(value), &a.Value)
+			if err != nil {
+				return nil, fmt.Errorf("list_answers.parse_value: %w", err)
+			}
+		}
+		answers = append(answers, a)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, fmt.Errorf("list_answers: %w", err)
+	}
+	return answers, nil
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+type shareStore struct {
+	db *sql.DB
+}
+
+// Creates a ShareStore backed by the given SQLite DB.
+func NewShareStore(db *sql.DB) ShareStore {
+	return &shareStore{db}
+}
+
+func (s *shareStore) Access(ctx context.Context, workspaceId int, surveyId int, username string) (string, error) {
+	var access sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT `+accessExpr+`
+		FROM survey s
+		WHERE s.id = ?
+			AND s.workspace_id = ?`,
+		username, username, username, surveyId, workspaceId,
+	).Scan(&access)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("get_access: %w", err)
+	}
+	return access.String, nil
+}
+
+func (s *shareStore) List(ctx context.Context, surveyId int) ([]model.Share, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT survey_id, username, group_name, access, created_at
+		FROM survey_share
+		WHERE survey_id = ?
+		ORDER BY group_name IS NOT NULL, username, group_name`,
+		surveyId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_shares: %w", err)
+	}
+	defer rows.Close()
+
+	shares := []model.Share{}
+	for rows.Next() {
+		share := model.Share{}
+		var username, group sql.NullString
+		err = rows.Scan(&share.SurveyID, &username, &group, &share.Access, &share.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("get_shares.scan: %w", err)
+		}
+		share.Username, share.Group = username.String, group.String
+		shares = append(shares, share)
+	}
+	return shares, rows.Err()
+}
+
+func (s *shareStore) Grant(ctx context.Context, share model.Share) error {
+	grantee, value := "username", share.Username
+	if share.Group != "" {
+		grantee, value = "group_name", share.Group
+	}
+
+	// the share takes the workspace of the survey, which the group must belong to
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO survey_share (survey_id, workspace_id, `+grantee+`, access, created_at)
+		SELECT id, workspace_id, ?, ?, ?
+		FROM survey
+		WHERE id = ?
+		ON CONFLICT (survey_id, `+grantee+`) WHERE `+grantee+` IS NOT NULL
+		DO UPDATE SET access = excluded.access`,
+		value,
+		share.Access,
+		time.Now(),
+		share.SurveyID,
+	)
+	if isForeignKeyError(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("grant_access: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("grant_access.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *shareStore) Revoke(ctx context.Context, surveyId int, username string, group string) error {
+	res, err := s.db.ExecContext(ctx, `
+		DELETE FROM survey_share
+		WHERE survey_id = ?
+			AND (username = NULLIF(?, '') OR group_name = NULLIF(?, ''))`,
+		surveyId,
+		username,
+		group,
+	)
+	if err != nil {
+		return fmt.Errorf("revoke_access: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("revoke_access.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *shareStore) SetOwner(ctx context.Context, surveyId int, username string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE survey SET owner = ? WHERE id = ?`, username, surveyId)
+	if isForeignKeyError(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("set_owner: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set_owner.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *shareStore) TransferAll(ctx context.Context, workspaceId int, from string, to string) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE survey SET owner = ?
+		WHERE owner = ?
+			AND workspace_id = ?`,
+		to,
+		from,
+		workspaceId,
+	)
+	if isForeignKeyError(err) {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("transfer_surveys: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("transfer_surveys.verify: %w", err)
+	}
+	return int(n), nil
+}
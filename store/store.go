@@ -0,0 +1,194 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+var (
+	// Returned when the requested entity does not exist
+	ErrNotFound = errors.New("not found")
+	// Returned when an optimistic lock check fails
+	ErrConflict = errors.New("conflict")
+	// Returned when the respondent already submitted an answer to the survey
+	ErrDuplicate = errors.New("duplicate")
+)
+
+// Times compared as text in queries are stored in UTC, so that they compare correctly
+func textTime(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// Anonymizes respondent IPs, as implemented by privacy.Anonymizer
+type Anonymizer interface {
+	IP(mode string, ip string) (string, error)
+	Pseudonym(surveyId int, ip string) string
+}
+
+type SurveyStore interface {
+	Create(ctx context.Context, survey model.Survey) (id int, err error)
+	Get(ctx context.Context, id int) (model.Survey, error)
+	List(ctx context.Context, workspaceId int) ([]model.Survey, error)
+	// Lists the surveys of the workspace owned by or shared with the user, with the access they have
+	ListFor(ctx context.Context, workspaceId int, username string) ([]model.Survey, error)
+	// Updates the survey. Moving it to a stricter privacy mode also anonymizes the IPs
+	// and the respondent keys already stored, so that the mode protects past submissions too
+	Update(ctx context.Context, survey model.Survey) error
+	// Soft-deletes the survey, moving it to the trash
+	Delete(ctx context.Context, id int) error
+	// Lists every field the survey ever had: the active ones in order, followed by the retired ones
+	AllFields(ctx context.Context, id int) ([]model.SurveyField, error)
+	ListDeleted(ctx context.Context, workspaceId int) ([]model.Survey, error)
+	// Lists the surveys of the workspace in the trash owned by or shared with the user, with the access they have
+	ListDeletedFor(ctx context.Context, workspaceId int, username string) ([]model.Survey, error)
+	Restore(ctx context.Context, id int) error
+	// Permanently deletes a survey from the trash, with all its submissions
+	Purge(ctx context.Context, id int) error
+	// Moves the survey to the given lifecycle state, failing with ErrConflict
+	// if that is not allowed from its current one
+	SetStatus(ctx context.Context, id int, status string) error
+	ListVersions(ctx context.Context, id int) ([]model.SurveyVersion, error)
+	GetVersion(ctx context.Context, id int, version int) (model.Survey, error)
+}
+
+type SubmissionStore interface {
+	// Inserts a submission pinned to the survey version it was validated against,
+	// failing with ErrConflict if the survey changed since, and with ErrDuplicate if the respondent already submitted
+	Insert(ctx context.Context, surveyId int, submission model.Submission) (id int, err error)
+	ListBySurvey(ctx context.Context, surveyId int) ([]model.Submission, error)
+	// Calls fn for each submission to the survey in turn, without loading them all in memory
+	Each(ctx context.Context, surveyId int, fn func(model.Submission) error) error
+	// Counts the submissions to the survey made after since and up to until
+	CountBetween(ctx context.Context, surveyId int, since, until time.Time) (int, error)
+	// Lists the first submissions to the survey made after since and up to until, up to limit of them
+	ListBetween(ctx context.Context, surveyId int, since, until time.Time, limit int) ([]model.Submission, error)
+	// Lists the time of every submission to the survey, in no particular order
+	ListTimes(ctx context.Context, surveyId int) ([]time.Time, error)
+	// Tells whether the identified respondent already answered the survey
+	Exists(ctx context.Context, surveyId int, respondentKey string) (bool, error)
+}
+
+type InviteStore interface {
+	Insert(ctx context.Context, surveyId int, tokens []string) error
+	ListBySurvey(ctx context.Context, surveyId int) ([]model.Invite, error)
+	Exists(ctx context.Context, surveyId int, token string) (bool, error)
+}
+
+type PresentationStore interface {
+	Get(ctx context.Context, surveyId int) (model.Presentation, error)
+	// Starts the presentation, or moves it to another question
+	Save(ctx context.Context, presentation model.Presentation) error
+	// Ends the presentation
+	Delete(ctx context.Context, surveyId int) error
+	// Records an answer to a question, failing with ErrDuplicate if the respondent answered it already
+	InsertAnswer(ctx context.Context, answer model.PresentationAnswer) (id int, err error)
+	// Whether the respondent answered the question already
+	Answered(ctx context.Context, fieldId int, respondentKey string) (bool, error)
+	ListAnswers(ctx context.Context, fieldId int) ([]model.PresentationAnswer, error)
+}
+
+type WebhookStore interface {
+	Create(ctx context.Context, webhook model.Webhook) (id int, err error)
+	Get(ctx context.Context, id int) (model.Webhook, error)
+	List(ctx context.Context, workspaceId int) ([]model.Webhook, error)
+	// Updates the webhook, keeping its secret if none is given
+	Update(ctx context.Context, webhook model.Webhook) error
+	// Deletes the webhook with all its deliveries
+	Delete(ctx context.Context, id int) error
+	// Queues the payload for every active webhook subscribed to the event, on the survey or on its whole workspace.
+	// Returns the number of deliveries queued
+	Enqueue(ctx context.Context, surveyId int, event string, payload []byte) (int, error)
+	// Lists up to limit pending deliveries to active webhooks that are due by the given time, oldest first
+	Due(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error)
+	// Records the outcome of an attempt, moving the delivery to the given state
+	RecordAttempt(ctx context.Context, deliveryId int, attempt model.WebhookAttempt, status string, nextAttemptAt time.Time) error
+	// Lists the latest deliveries to the webhook, optionally filtered by state
+	ListDeliveries(ctx context.Context, webhookId int, status string, limit int) ([]model.WebhookDelivery, error)
+	// Gets a delivery with the history of its attempts
+	GetDelivery(ctx context.Context, webhookId int, deliveryId int) (model.WebhookDelivery, error)
+	// Queues a delivery again for an immediate attempt, whatever its state
+	Redeliver(ctx context.Context, webhookId int, deliveryId int) error
+}
+
+type NotificationStore interface {
+	// Subscribes an address to the survey, or changes the mode of an existing subscription
+	Subscribe(ctx context.Context, surveyId int, email string, mode string) error
+	ListSubscribers(ctx context.Context, surveyId int) ([]model.Subscriber, error)
+	Unsubscribe(ctx context.Context, surveyId int, email string) error
+	// Lists the digest subscriptions not yet covered up to the given time
+	DueDigests(ctx context.Context, until time.Time) ([]model.Subscriber, error)
+	// Records that the submissions to the survey up to the given time were covered by a digest
+	SetDigested(ctx context.Context, surveyId int, email string, until time.Time) error
+	QueueEmails(ctx context.Context, emails []model.Email) error
+	// Lists up to limit pending emails that are due by the given time, oldest first
+	DueEmails(ctx context.Context, now time.Time, limit int) ([]model.Email, error)
+	// Records the outcome of an attempt at sending an email, moving it to the given state
+	RecordEmailAttempt(ctx context.Context, id int, status string, nextAttemptAt time.Time, errMsg string) error
+}
+
+type ShareStore interface {
+	// Tells the access of the user to the survey, even if in the trash: empty if none.
+	// Fails with ErrNotFound if the survey is not in the workspace
+	Access(ctx context.Context, workspaceId int, surveyId int, username string) (string, error)
+	List(ctx context.Context, surveyId int) ([]model.Share, error)
+	// Grants access to the user or group of the share, replacing any previous grant to them.
+	// Fails with ErrNotFound if the user does not exist, or the group is not in the workspace of the survey
+	Grant(ctx context.Context, share model.Share) error
+	// Revokes the access granted to the user or the group
+	Revoke(ctx context.Context, surveyId int, username string, group string) error
+	// Makes the user the owner of the survey
+	SetOwner(ctx context.Context, surveyId int, username string) error
+	// Gives every survey of the workspace owned by a user to another, returning how many they were
+	TransferAll(ctx context.Context, workspaceId int, from string, to string) (int, error)
+}
+
+type GroupStore interface {
+	// Creates an empty group in the workspace, failing with ErrConflict if the name is taken
+	Create(ctx context.Context, workspaceId int, name string) error
+	Get(ctx context.Context, workspaceId int, name string) (model.Group, error)
+	List(ctx context.Context, workspaceId int) ([]model.Group, error)
+	// Deletes the group, with the access granted to it
+	Delete(ctx context.Context, workspaceId int, name string) error
+	AddMember(ctx context.Context, workspaceId int, name string, username string) error
+	RemoveMember(ctx context.Context, workspaceId int, name string, username string) error
+}
+
+type WorkspaceStore interface {
+	// Creates a workspace, failing with ErrConflict if the name is taken
+	Create(ctx context.Context, name string) (id int, err error)
+	Get(ctx context.Context, id int) (model.Workspace, error)
+	List(ctx context.Context) ([]model.Workspace, error)
+	// Lists the workspaces the user is a member of, with their role in each
+	ListFor(ctx context.Context, username string) ([]model.Workspace, error)
+	ListMembers(ctx context.Context, id int) ([]model.Member, error)
+	GetMember(ctx context.Context, id int, username string) (model.Member, error)
+	// Makes the user a member of the workspace, failing with ErrConflict if they already are
+	AddMember(ctx context.Context, id int, username string, role string) error
+	// Changes the role of a member, revoking their refresh tokens so that it applies from their next login.
+	// Access tokens already issued keep the old role until they expire
+	SetMemberRole(ctx context.Context, id int, username string, role string) error
+	// Removes a member with the access granted to them in the workspace, revoking their refresh tokens.
+	// Fails with ErrConflict if they still own surveys in the workspace
+	RemoveMember(ctx context.Context, id int, username string) error
+}
+
+type UserStore interface {
+	// Creates a user with the given password hash, failing with ErrConflict if the name is taken
+	Create(ctx context.Context, username string, role string, passwordHash string) error
+	Get(ctx context.Context, username string) (model.User, error)
+	List(ctx context.Context) ([]model.User, error)
+	// Changes the password hash, revoking the refresh tokens of the user
+	SetPassword(ctx context.Context, username string, passwordHash string) error
+	// Changes the role, revoking the refresh tokens of the user so that it applies from their next login
+	SetRole(ctx context.Context, username string, role string) error
+	// Disables or enables the user. Disabling revokes their refresh tokens:
+	// access tokens already issued stay valid until they expire
+	SetDisabled(ctx context.Context, username string, disabled bool) error
+	// Deletes the user, failing with ErrConflict if they still own surveys
+	Delete(ctx context.Context, username string) error
+	// Counts the users that are not disabled
+	CountActive(ctx context.Context) (int, error)
+}
@@ -0,0 +1,362 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/mbolis/quick-survey/model"
+)
+
+type submissionStore struct {
+	db *sql.DB
+}
+
+// Creates a SubmissionStore backed by the given SQLite DB.
+func NewSubmissionStore(db *sql.DB) SubmissionStore {
+	return &submissionStore{db}
+}
+
+func (s *submissionStore) Insert(ctx context.Context, surveyId int, submission model.Submission) (id int, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if submission.Time.IsZero() {
+		submission.Time = time.Now()
+	}
+	// the version is checked by the insert itself, so that no update can slip in after the submission was validated
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO submission (survey_id, survey_version, time, ip, respondent_key)
+		SELECT s.id, s.version, ?, ?, NULLIF(?, '')
+		FROM survey s
+		WHERE s.id = ?
+			AND s.version = ?
+		RETURNING id`,
+		submission.Time,
+		submission.IP,
+		submission.RespondentKey,
+		surveyId,
+		submission.SurveyVersion,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrConflict
+	}
+	if isUniqueViolation(err) {
+		return 0, ErrDuplicate
+	}
+	if err != nil {
+		return 0, fmt.Errorf("insert_submission: %w", err)
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO submission_field (submission_id, field_id, value)
+		VALUES (?, ?, ?)`)
+	if err != nil {
+		return 0, fmt.Errorf("insert_submission.fields.prepare: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, f := range submission.Fields {
+		var valueJson []byte
+		if f.Value != nil {
+			valueJson, err = json.Marshal(f.Value)
+			if err != nil {
+				return 0, fmt.Errorf("insert_submission.fields.parse_value: %w", err)
+			}
+		}
+		_, err := stmt.ExecContext(ctx, id, f.ID, string(valueJson))
+		if err != nil {
+			return 0, fmt.Errorf("insert_submission.fields.insert: %w", err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return id, nil
+}
+
+func (s *submissionStore) ListBySurvey(ctx context.Context, surveyId int) ([]model.Submission, error) {
+	submissions := []model.Submission{}
+	err := s.Each(ctx, surveyId, func(submission model.Submission) error {
+		submissions = append(submissions, submission)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return submissions, nil
+}
+
+func (s *submissionStore) Each(ctx context.Context, surveyId int, fn func(model.Submission) error) error {
+	return s.each(ctx, surveyId, "", nil, fn)
+}
+
+// Submissions made after since and up to until, compared as instants whatever the time zone they are stored in
+const betweenFilter = `julianday(time) > julianday(?) AND julianday(time) <= julianday(?)`
+
+func (s *submissionStore) CountBetween(ctx context.Context, surveyId int, since, until time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM submission
+		WHERE survey_id = ?
+			AND `+betweenFilter,
+		surveyId,
+		since,
+		until,
+	).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count_submissions: %w", err)
+	}
+	return n, nil
+}
+
+func (s *submissionStore) ListBetween(ctx context.Context, surveyId int, since, until time.Time, limit int) ([]model.Submission, error) {
+	submissions := []model.Submission{}
+	err := s.each(ctx, surveyId, `
+		AND s.id IN (
+			SELECT id FROM submission
+			WHERE survey_id = ?
+				AND `+betweenFilter+`
+			ORDER BY id
+			LIMIT ?
+		)`,
+		[]any{surveyId, since, until, limit},
+		func(submission model.Submission) error {
+			submissions = append(submissions, submission)
+			return nil
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return submissions, nil
+}
+
+// Calls fn for each submission to the survey matching the filter, to be appended to the query conditions with its args
+func (s *submissionStore) each(ctx context.Context, surveyId int, filter string, args []any, fn func(model.Submission) error) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM survey
+		WHERE id = ?
+			AND deleted_at IS NULL`,
+		surveyId,
+	).Scan(&exists)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("get_submissions.survey: %w", err)
+	}
+
+	versions, err := getVersionFields(ctx, s.db, surveyId)
+	if err != nil {
+		return fmt.Errorf("get_submissions.versions: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			s.id, IFNULL(s.survey_version, 0), s.time, s.ip,
+			f.id, f.name, f.label, v.value
+		FROM submission s
+		LEFT JOIN submission_field v ON (s.id = v.submission_id)
+		LEFT JOIN survey_field f ON (f.id = v.field_id)
+		WHERE s.survey_id = ?`+filter+`
+		ORDER BY s.id, f.id`,
+		append([]any{surveyId}, args...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("get_submissions: %w", err)
+	}
+	defer rows.Close()
+
+	// rows are grouped by submission: emit each one as soon as the next begins
+	var current *model.Submission
+	for rows.Next() {
+		s := model.Submission{}
+		// fields are missing from submissions where none was answered
+		var fieldId sql.NullInt64
+		var name, label, value sql.NullString
+
+		err = rows.Scan(&s.ID, &s.SurveyVersion, &s.Time, &s.IP, &fieldId, &name, &label, &value)
+		if err != nil {
+			return fmt.Errorf("get_submissions.scan: %w", err)
+		}
+
+		if current == nil || current.ID != s.ID {
+			if current != nil {
+				err = fn(*current)
+				if err != nil {
+					return err
+				}
+			}
+			s.Fields = map[string]model.SubmissionField{}
+			current = &s
+		}
+		if !fieldId.Valid {
+			continue
+		}
+
+		f := model.SubmissionField{ID: int(fieldId.Int64), Name: name.String, Label: label.String}
+		if value.String != "" {
+			err = json.Unmarshal([]byte(value.String), &f.Value)
+			if err != nil {
+				return fmt.Errorf("get_submissions.parse_value: %w", err)
+			}
+		}
+
+		// show the field as it was when the submission was made
+		if seen, ok := versions[s.SurveyVersion][f.ID]; ok {
+			f.Label = seen.Label
+			for _, o := range seen.Options {
+				if o.Value == f.Value {
+					f.ValueLabel = o.Label
+				}
+			}
+		}
+
+		current.Fields[f.Name] = f
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("get_submissions: %w", err)
+	}
+
+	if current != nil {
+		return fn(*current)
+	}
+	return nil
+}
+
+func (s *submissionStore) ListTimes(ctx context.Context, surveyId int) ([]time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.time
+		FROM submission s
+		INNER JOIN survey v ON (v.id = s.survey_id)
+		WHERE s.survey_id = ?
+			AND v.deleted_at IS NULL`,
+		surveyId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_submission_times: %w", err)
+	}
+	defer rows.Close()
+
+	times := []time.Time{}
+	for rows.Next() {
+		var t time.Time
+		err = rows.Scan(&t)
+		if err != nil {
+			return nil, fmt.Errorf("get_submission_times.scan: %w", err)
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
+
+func (s *submissionStore) Exists(ctx context.Context, surveyId int, respondentKey string) (bool, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 1 FROM submission
+		WHERE survey_id = ?
+			AND respondent_key = ?`,
+		surveyId,
+		respondentKey,
+	).Scan(&exists)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("get_respondent.scan: %w", err)
+	}
+	return exists, nil
+}
+
+// Applies the privacy mode to the submissions and presentation answers already stored for the survey:
+// addresses still in the clear are anonymized, and the respondent keys derived from them replaced by pseudonyms,
+// as they would be for new ones
+func anonymizeSubmissions(ctx context.Context, tx *sql.Tx, anonymizer Anonymizer, surveyId int, mode string) error {
+	for _, table := range []string{"submission", "presentation_answer"} {
+		err := anonymizeRespondents(ctx, tx, anonymizer, table, surveyId, mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func anonymizeRespondents(ctx context.Context, tx *sql.Tx, anonymizer Anonymizer, table string, surveyId int, mode string) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, ip, respondent_key
+		FROM `+table+`
+		WHERE survey_id = ?`,
+		surveyId,
+	)
+	if err != nil {
+		return fmt.Errorf("anonymize_%s: %w", table, err)
+	}
+	defer rows.Close()
+
+	type update struct {
+		id  int
+		ip  string
+		key sql.NullString
+	}
+	updates := []update{}
+	for rows.Next() {
+		u := update{}
+		err = rows.Scan(&u.id, &u.ip, &u.key)
+		if err != nil {
+			return fmt.Errorf("anonymize_%s.scan: %w", table, err)
+		}
+
+		changed := false
+		if _, err := netip.ParseAddr(u.ip); err == nil {
+			anonymized, err := anonymizer.IP(mode, u.ip)
+			if err != nil {
+				return fmt.Errorf("anonymize_%s.ip: %w", table, err)
+			}
+			changed = changed || anonymized != u.ip
+			u.ip = anonymized
+		}
+		if ip, ok := strings.CutPrefix(u.key.String, model.RespondentKey(model.DedupeIP, "")); ok {
+			if _, err := netip.ParseAddr(ip); err == nil {
+				u.key.String = model.RespondentKey(model.DedupeIP, anonymizer.Pseudonym(surveyId, ip))
+				changed = true
+			}
+		}
+		if changed {
+			updates = append(updates, u)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("anonymize_%s.scan: %w", table, err)
+	}
+	rows.Close()
+
+	for _, u := range updates {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE `+table+`
+			SET ip = ?, respondent_key = ?
+			WHERE id = ?`,
+			u.ip,
+			u.key,
+			u.id,
+		)
+		if err != nil {
+			return fmt.Errorf("anonymize_%s.update: %w", table, err)
+		}
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
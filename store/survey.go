@@ -0,0 +1,413 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+type surveyStore struct {
+	db         *sql.DB
+	anonymizer Anonymizer
+}
+
+// Creates a SurveyStore backed by the given SQLite DB, anonymizing stored IPs with the given anonymizer.
+func NewSurveyStore(db *sql.DB, anonymizer Anonymizer) SurveyStore {
+	return &surveyStore{db, anonymizer}
+}
+
+func (s *surveyStore) Create(ctx context.Context, survey model.Survey) (id int, err error) {
+	var version int
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO survey (title, description, open_at, close_at, dedupe_policy, privacy_mode, owner, workspace_id)
+		VALUES (?, ?, ?, ?, COALESCE(NULLIF(?, ''), 'ip'), COALESCE(NULLIF(?, ''), 'full'), NULLIF(?, ''), ?)
+		RETURNING id, version`,
+		survey.Title,
+		survey.Description,
+		survey.OpenAt,
+		survey.CloseAt,
+		survey.DedupePolicy,
+		survey.PrivacyMode,
+		survey.Owner,
+		survey.WorkspaceID,
+	).Scan(&id, &version)
+	if err != nil {
+		return 0, fmt.Errorf("insert_survey: %w", err)
+	}
+
+	err = insertFields(ctx, tx, id, survey.Fields)
+	if err != nil {
+		return 0, err
+	}
+
+	err = insertSnapshot(ctx, tx, id, version)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return id, nil
+}
+
+func (s *surveyStore) Get(ctx context.Context, id int) (model.Survey, error) {
+	return getSurvey(ctx, s.db, id)
+}
+
+func getSurvey(ctx context.Context, q querier, id int) (model.Survey, error) {
+	survey, err := scanSurvey(q.QueryRowContext(ctx, `
+		SELECT `+surveyColumns+`
+		FROM survey s
+		WHERE s.id = ?
+			AND s.deleted_at IS NULL`,
+		id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return survey, ErrNotFound
+	}
+	if err != nil {
+		return survey, fmt.Errorf("get_survey: %w", err)
+	}
+
+	survey.Fields, err = getFields(ctx, q, id)
+	if err != nil {
+		return survey, err
+	}
+	return survey, nil
+}
+
+func (s *surveyStore) List(ctx context.Context, workspaceId int) ([]model.Survey, error) {
+	return listSurveys(ctx, s.db, "get_surveys", `
+		SELECT `+surveyColumns+`, NULL
+		FROM survey s
+		WHERE s.workspace_id = ?
+			AND s.deleted_at IS NULL`,
+		workspaceId,
+	)
+}
+
+func (s *surveyStore) ListFor(ctx context.Context, workspaceId int, username string) ([]model.Survey, error) {
+	return listSurveys(ctx, s.db, "get_user_surveys", `
+		SELECT `+surveyColumns+`, s.access
+		FROM (SELECT *, `+accessExpr+` AS access FROM survey s) s
+		WHERE s.workspace_id = ?
+			AND s.deleted_at IS NULL
+			AND s.access IS NOT NULL`,
+		username, username, username, workspaceId,
+	)
+}
+
+// Runs a query for the survey columns followed by the access of the user
+func listSurveys(ctx context.Context, q querier, code string, query string, args ...any) ([]model.Survey, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", code, err)
+	}
+	defer rows.Close()
+
+	surveys := []model.Survey{}
+	for rows.Next() {
+		var access sql.NullString
+		s, err := scanSurvey(rows, &access)
+		if err != nil {
+			return nil, fmt.Errorf("%s.scan: %w", code, err)
+		}
+		s.Access = access.String
+
+		surveys = append(surveys, s)
+	}
+	return surveys, rows.Err()
+}
+
+func (s *surveyStore) Update(ctx context.Context, survey model.Survey) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var oldMode string
+	err = tx.QueryRowContext(ctx, `SELECT privacy_mode FROM survey WHERE id = ?`, survey.ID).Scan(&oldMode)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("update_survey.privacy_mode: %w", err)
+	}
+
+	// bumping the version before anything else is written means concurrent updates cannot snapshot the same one
+	var version int
+	var mode string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE survey
+		SET
+			title = ?,
+			description = ?,
+			open_at = ?,
+			close_at = ?,
+			dedupe_policy = COALESCE(NULLIF(?, ''), dedupe_policy),
+			privacy_mode = COALESCE(NULLIF(?, ''), privacy_mode),
+			version = version + 1
+		WHERE	id = ?
+			AND version = ?
+			AND deleted_at IS NULL
+		RETURNING version, privacy_mode`,
+		survey.Title,
+		survey.Description,
+		survey.OpenAt,
+		survey.CloseAt,
+		survey.DedupePolicy,
+		survey.PrivacyMode,
+		survey.ID,
+		survey.Version,
+	).Scan(&version, &mode)
+	if errors.Is(err, sql.ErrNoRows) {
+		// optimistic lock
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("update_survey: %w", err)
+	}
+
+	if mode != oldMode && mode != model.PrivacyFull {
+		err = anonymizeSubmissions(ctx, tx, s.anonymizer, survey.ID, mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = updateFields(ctx, tx, survey.ID, survey.Fields)
+	if err != nil {
+		return err
+	}
+
+	err = insertSnapshot(ctx, tx, survey.ID, version)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// Moves the survey to the trash, from where it can be restored or purged.
+func (s *surveyStore) Delete(ctx context.Context, id int) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE survey
+		SET deleted_at = ?
+		WHERE id = ?
+			AND deleted_at IS NULL`,
+		textTime(time.Now()),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("delete_survey: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete_survey.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *surveyStore) ListDeleted(ctx context.Context, workspaceId int) ([]model.Survey, error) {
+	return listSurveys(ctx, s.db, "get_deleted_surveys", `
+		SELECT `+surveyColumns+`, NULL
+		FROM survey s
+		WHERE s.workspace_id = ?
+			AND s.deleted_at IS NOT NULL
+		ORDER BY s.deleted_at DESC`,
+		workspaceId,
+	)
+}
+
+func (s *surveyStore) ListDeletedFor(ctx context.Context, workspaceId int, username string) ([]model.Survey, error) {
+	return listSurveys(ctx, s.db, "get_deleted_user_surveys", `
+		SELECT `+surveyColumns+`, s.access
+		FROM (SELECT *, `+accessExpr+` AS access FROM survey s) s
+		WHERE s.workspace_id = ?
+			AND s.deleted_at IS NOT NULL
+			AND s.access IS NOT NULL
+		ORDER BY s.deleted_at DESC`,
+		username, username, username, workspaceId,
+	)
+}
+
+func (s *surveyStore) Restore(ctx context.Context, id int) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE survey
+		SET deleted_at = NULL
+		WHERE id = ?
+			AND deleted_at IS NOT NULL`,
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("restore_survey: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("restore_survey.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Permanently deletes a survey in the trash, together with its submissions.
+func (s *surveyStore) Purge(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var deleted bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT 1 FROM survey
+		WHERE id = ?
+			AND deleted_at IS NOT NULL`,
+		id,
+	).Scan(&deleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("purge_survey.get: %w", err)
+	}
+
+	// children first, as foreign keys restrict deletion
+	steps := []struct{ code, query string }{
+		{"purge_survey.submission_fields", `
+			DELETE FROM submission_field
+			WHERE submission_id IN (SELECT id FROM submission WHERE survey_id = ?)`},
+		{"purge_survey.submissions", `DELETE FROM submission WHERE survey_id = ?`},
+		{"purge_survey.invites", `DELETE FROM survey_invite WHERE survey_id = ?`},
+		{"purge_survey.presentation_answers", `DELETE FROM presentation_answer WHERE survey_id = ?`},
+		{"purge_survey.presentation", `DELETE FROM presentation WHERE survey_id = ?`},
+		{"purge_survey.webhook_attempts", `
+			DELETE FROM webhook_attempt
+			WHERE delivery_id IN (
+				SELECT d.id FROM webhook_delivery d
+				INNER JOIN webhook w ON (w.id = d.webhook_id)
+				WHERE w.survey_id = ?
+			)`},
+		{"purge_survey.webhook_deliveries", `
+			DELETE FROM webhook_delivery
+			WHERE webhook_id IN (SELECT id FROM webhook WHERE survey_id = ?)`},
+		{"purge_survey.webhooks", `DELETE FROM webhook WHERE survey_id = ?`},
+		{"purge_survey.subscribers", `DELETE FROM survey_subscriber WHERE survey_id = ?`},
+		{"purge_survey.shares", `DELETE FROM survey_share WHERE survey_id = ?`},
+		{"purge_survey.fields", `DELETE FROM survey_field WHERE survey_id = ?`},
+		{"purge_survey.versions", `DELETE FROM survey_version WHERE survey_id = ?`},
+		{"purge_survey", `DELETE FROM survey WHERE id = ?`},
+	}
+	for _, step := range steps {
+		_, err = tx.ExecContext(ctx, step.query, id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.code, err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *surveyStore) SetStatus(ctx context.Context, id int, status string) error {
+	from := model.StatusTransitions[status]
+	if len(from) == 0 {
+		return fmt.Errorf("set_status: unknown status %q", status)
+	}
+
+	args := []any{status, id}
+	for _, f := range from {
+		args = append(args, f)
+	}
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE survey
+		SET status = ?
+		WHERE id = ?
+			AND deleted_at IS NULL
+			AND status IN (?`+strings.Repeat(", ?", len(from)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("set_status: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set_status.verify: %w", err)
+	}
+	if n < 1 {
+		_, err = s.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+const surveyColumns = `s.id, s.version, s.status, s.open_at, s.close_at, s.deleted_at, s.dedupe_policy, s.privacy_mode, s.title, s.description, s.owner, s.workspace_id`
+
+// Access of a user, bound to its three parameters, to the survey s: NULL if none.
+// Owners have full access; otherwise the highest access shared with the user or their groups
+const accessExpr = `CASE
+	WHEN s.owner = ? THEN 'owner'
+	ELSE (
+		SELECT CASE MAX(sh.access = 'edit') WHEN 1 THEN 'edit' WHEN 0 THEN 'view' END
+		FROM survey_share sh
+		WHERE sh.survey_id = s.id
+			AND (sh.username = ? OR sh.group_name IN (
+				SELECT group_name FROM user_group_member
+				WHERE username = ?
+					AND workspace_id = sh.workspace_id
+			))
+	)
+END`
+
+// Any type that can scan a single row: either *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// Scans the survey columns, followed by the given extra ones
+func scanSurvey(row scanner, extra ...any) (model.Survey, error) {
+	survey := model.Survey{}
+	var openAt, closeAt, deletedAt sql.NullTime
+	var owner sql.NullString
+	err := row.Scan(append([]any{
+		&survey.ID, &survey.Version, &survey.Status, &openAt, &closeAt, &deletedAt,
+		&survey.DedupePolicy, &survey.PrivacyMode, &survey.Title, &survey.Description, &owner, &survey.WorkspaceID,
+	}, extra...)...)
+	survey.Owner = owner.String
+	if openAt.Valid {
+		survey.OpenAt = &openAt.Time
+	}
+	if closeAt.Valid {
+		survey.CloseAt = &closeAt.Time
+	}
+	if deletedAt.Valid {
+		survey.DeletedAt = &deletedAt.Time
+	}
+	return survey, err
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/mbolis/quick-survey/model"
+)
+
+type userStore struct {
+	db *sql.DB
+}
+
+// Creates a UserStore backed by the given SQLite DB.
+func NewUserStore(db *sql.DB) UserStore {
+	return &userStore{db}
+}
+
+func (s *userStore) Create(ctx context.Context, username string, role string, passwordHash string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user (username, role, password_hash, created_at)
+		VALUES (?, ?, ?, ?)`,
+		username,
+		role,
+		passwordHash,
+		time.Now(),
+	)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("insert_user: %w", err)
+	}
+	return nil
+}
+
+func scanUser(row interface{ Scan(...any) error }) (model.User, error) {
+	u := model.User{}
+	err := row.Scan(&u.Username, &u.Role, &u.CreatedAt, &u.DisabledAt)
+	u.Disabled = u.DisabledAt != nil
+	return u, err
+}
+
+func (s *userStore) Get(ctx context.Context, username string) (model.User, error) {
+	u, err := scanUser(s.db.QueryRowContext(ctx, `
+		SELECT username, role, created_at, disabled_at
+		FROM user
+		WHERE username = ?`,
+		username,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrNotFound
+	}
+	if err != nil {
+		return u, fmt.Errorf("get_user: %w", err)
+	}
+	return u, nil
+}
+
+func (s *userStore) List(ctx context.Context) ([]model.User, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT username, role, created_at, disabled_at
+		FROM user
+		ORDER BY username`)
+	if err != nil {
+		return nil, fmt.Errorf("get_users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []model.User{}
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get_users.scan: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// Runs the update on the user, then revokes their refresh tokens
+func (s *userStore) updateAndLogout(ctx context.Context, code string, username string, query string, args ...any) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", code, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s.verify: %w", code, err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM token WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("%s.tokens: %w", code, err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *userStore) SetPassword(ctx context.Context, username string, passwordHash string) error {
+	return s.updateAndLogout(ctx, "set_password", username, `
+		UPDATE user SET password_hash = ?
+		WHERE username = ?`,
+		passwordHash,
+		username,
+	)
+}
+
+func (s *userStore) SetRole(ctx context.Context, username string, role string) error {
+	return s.updateAndLogout(ctx, "set_role", username, `
+		UPDATE user SET role = ?
+		WHERE username = ?`,
+		role,
+		username,
+	)
+}
+
+func (s *userStore) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	if !disabled {
+		res, err := s.db.ExecContext(ctx, `UPDATE user SET disabled_at = NULL WHERE username = ?`, username)
+		if err != nil {
+			return fmt.Errorf("enable_user: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("enable_user.verify: %w", err)
+		}
+		if n < 1 {
+			return ErrNotFound
+		}
+		return nil
+	}
+
+	return s.updateAndLogout(ctx, "disable_user", username, `
+		UPDATE user SET disabled_at = COALESCE(disabled_at, ?)
+		WHERE username = ?`,
+		time.Now(),
+		username,
+	)
+}
+
+func (s *userStore) Delete(ctx context.Context, username string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// children first, as foreign keys restrict deletion
+	steps := []struct{ code, query string }{
+		{"delete_user.tokens", `DELETE FROM token WHERE username = ?`},
+		{"delete_user.shares", `DELETE FROM survey_share WHERE username = ?`},
+		{"delete_user.groups", `DELETE FROM user_group_member WHERE username = ?`},
+		{"delete_user.workspaces", `DELETE FROM workspace_member WHERE username = ?`},
+	}
+	for _, step := range steps {
+		_, err = tx.ExecContext(ctx, step.query, username)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.code, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM user WHERE username = ?`, username)
+	if isForeignKeyError(err) {
+		// still owns surveys
+		return ErrConflict
+	}
+	if err != nil {
+		return fmt.Errorf("delete_user: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete_user.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *userStore) CountActive(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM user WHERE disabled_at IS NULL`).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count_users: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+// Stores an immutable copy of the current definition of a survey, keyed by the version just written by the transaction.
+func insertSnapshot(ctx context.Context, tx *sql.Tx, surveyId int, version int) error {
+	survey, err := getSurvey(ctx, tx, surveyId)
+	if err != nil {
+		return fmt.Errorf("insert_snapshot: %w", err)
+	}
+	survey.Version = version
+
+	// the lifecycle state, policies and ownership are not part of the definition
+	survey.Status, survey.OpenAt, survey.CloseAt = "", nil, nil
+	survey.DedupePolicy, survey.PrivacyMode = "", ""
+	survey.Owner, survey.WorkspaceID = "", 0
+
+	definition, err := json.Marshal(survey)
+	if err != nil {
+		return fmt.Errorf("insert_snapshot.marshal: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO survey_version (survey_id, version, created_at, definition)
+		VALUES (?, ?, ?, ?)`,
+		survey.ID,
+		survey.Version,
+		time.Now(),
+		string(definition),
+	)
+	if err != nil {
+		return fmt.Errorf("insert_snapshot: %w", err)
+	}
+	return nil
+}
+
+func (s *surveyStore) ListVersions(ctx context.Context, id int) ([]model.SurveyVersion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT v.version, v.created_at
+		FROM survey_version v
+		WHERE v.survey_id = ?
+		ORDER BY v.version`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []model.SurveyVersion{}
+	for rows.Next() {
+		v := model.SurveyVersion{}
+		err = rows.Scan(&v.Version, &v.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("get_versions.scan: %w", err)
+		}
+
+		versions = append(versions, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("get_versions: %w", err)
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrNotFound
+	}
+	return versions, nil
+}
+
+func (s *surveyStore) GetVersion(ctx context.Context, id int, version int) (model.Survey, error) {
+	survey := model.Survey{}
+
+	var definition string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT v.definition
+		FROM survey_version v
+		WHERE v.survey_id = ?
+			AND v.version = ?`,
+		id,
+		version,
+	).Scan(&definition)
+	if errors.Is(err, sql.ErrNoRows) {
+		return survey, ErrNotFound
+	}
+	if err != nil {
+		return survey, fmt.Errorf("get_version: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(definition), &survey)
+	if err != nil {
+		return survey, fmt.Errorf("get_version.parse_definition: %w", err)
+	}
+	return survey, nil
+}
+
+// Loads the fields of every version of a survey, indexed by version and field ID.
+func getVersionFields(ctx context.Context, q querier, surveyId int) (map[int]map[int]model.SurveyField, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT v.version, v.definition
+		FROM survey_version v
+		WHERE v.survey_id = ?`,
+		surveyId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := map[int]map[int]model.SurveyField{}
+	for rows.Next() {
+		var version int
+		var definition string
+		err = rows.Scan(&version, &definition)
+		if err != nil {
+			return nil, fmt.Errorf("get_versions.scan: %w", err)
+		}
+
+		survey := model.Survey{}
+		err = json.Unmarshal([]byte(definition), &survey)
+		if err != nil {
+			return nil, fmt.Errorf("get_versions.parse_definition: %w", err)
+		}
+
+		fields := map[int]model.SurveyField{}
+		for _, f := range survey.Fields {
+			fields[f.ID] = f
+		}
+		versions[version] = fields
+	}
+	return versions, rows.Err()
+}
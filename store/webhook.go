@@ -0,0 +1,408 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+type webhookStore struct {
+	db *sql.DB
+}
+
+// Creates a WebhookStore backed by the given SQLite DB.
+func NewWebhookStore(db *sql.DB) WebhookStore {
+	return &webhookStore{db}
+}
+
+func (s *webhookStore) Create(ctx context.Context, webhook model.Webhook) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook (workspace_id, survey_id, url, secret, events, active, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		webhook.WorkspaceID,
+		webhook.SurveyID,
+		webhook.URL,
+		webhook.Secret,
+		strings.Join(webhook.Events, ","),
+		webhook.Active,
+		time.Now(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert_webhook: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("insert_webhook.get_id: %w", err)
+	}
+	return int(id), nil
+}
+
+const webhookColumns = `w.id, w.workspace_id, w.survey_id, w.url, w.secret, w.events, w.active, w.created_at`
+
+func scanWebhook(row interface{ Scan(...any) error }) (model.Webhook, error) {
+	w := model.Webhook{}
+	var events string
+	err := row.Scan(&w.ID, &w.WorkspaceID, &w.SurveyID, &w.URL, &w.Secret, &events, &w.Active, &w.CreatedAt)
+	w.Events = strings.Split(events, ",")
+	return w, err
+}
+
+func (s *webhookStore) Get(ctx context.Context, id int) (model.Webhook, error) {
+	w, err := scanWebhook(s.db.QueryRowContext(ctx, `
+		SELECT `+webhookColumns+`
+		FROM webhook w
+		WHERE w.id = ?`,
+		id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return w, ErrNotFound
+	}
+	if err != nil {
+		return w, fmt.Errorf("get_webhook: %w", err)
+	}
+	return w, nil
+}
+
+func (s *webhookStore) List(ctx context.Context, workspaceId int) ([]model.Webhook, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+webhookColumns+`
+		FROM webhook w
+		WHERE w.workspace_id = ?
+		ORDER BY w.id`,
+		workspaceId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []model.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get_webhooks.scan: %w", err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (s *webhookStore) Update(ctx context.Context, webhook model.Webhook) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE webhook SET
+			survey_id = ?,
+			url = ?,
+			secret = COALESCE(NULLIF(?, ''), secret),
+			events = ?,
+			active = ?
+		WHERE id = ?`,
+		webhook.SurveyID,
+		webhook.URL,
+		webhook.Secret,
+		strings.Join(webhook.Events, ","),
+		webhook.Active,
+		webhook.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update_webhook: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("update_webhook.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *webhookStore) Delete(ctx context.Context, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	// children first, as foreign keys restrict deletion
+	steps := []struct{ code, query string }{
+		{"delete_webhook.attempts", `
+			DELETE FROM webhook_attempt
+			WHERE delivery_id IN (SELECT id FROM webhook_delivery WHERE webhook_id = ?)`},
+		{"delete_webhook.deliveries", `DELETE FROM webhook_delivery WHERE webhook_id = ?`},
+	}
+	for _, step := range steps {
+		_, err = tx.ExecContext(ctx, step.query, id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.code, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM webhook WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete_webhook: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete_webhook.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *webhookStore) Enqueue(ctx context.Context, surveyId int, event string, payload []byte) (int, error) {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO webhook_delivery (webhook_id, event, payload, status, attempts, next_attempt_at, created_at)
+		SELECT w.id, ?, ?, ?, 0, ?, ?
+		FROM webhook w
+		WHERE w.active
+			AND (w.survey_id = ? OR w.survey_id IS NULL AND w.workspace_id = (SELECT workspace_id FROM survey WHERE id = ?))
+			AND ',' || w.events || ',' LIKE '%,' || ? || ',%'`,
+		event,
+		string(payload),
+		model.DeliveryPending,
+		textTime(now),
+		now,
+		surveyId,
+		surveyId,
+		event,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("enqueue_deliveries: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("enqueue_deliveries.verify: %w", err)
+	}
+	return int(n), nil
+}
+
+func (s *webhookStore) Due(ctx context.Context, now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at, d.created_at,
+			w.url, w.secret
+		FROM webhook_delivery d
+		INNER JOIN webhook w ON (w.id = d.webhook_id)
+		WHERE d.status = ?
+			AND d.next_attempt_at <= ?
+			AND w.active
+		ORDER BY d.next_attempt_at, d.id
+		LIMIT ?`,
+		model.DeliveryPending,
+		textTime(now),
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_due_deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		d := model.WebhookDelivery{}
+		var payload string
+		err = rows.Scan(&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("get_due_deliveries.scan: %w", err)
+		}
+		d.Payload = []byte(payload)
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *webhookStore) RecordAttempt(ctx context.Context, deliveryId int, attempt model.WebhookAttempt, status string, nextAttemptAt time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO webhook_attempt (delivery_id, attempted_at, status_code, error, duration_ms)
+		VALUES (?, ?, ?, NULLIF(?, ''), ?)`,
+		deliveryId,
+		attempt.AttemptedAt,
+		attempt.StatusCode,
+		attempt.Error,
+		attempt.DurationMS,
+	)
+	if err != nil {
+		return fmt.Errorf("record_attempt.insert: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE webhook_delivery SET
+			status = ?,
+			attempts = attempts + 1,
+			next_attempt_at = ?
+		WHERE id = ?`,
+		status,
+		textTime(nextAttemptAt),
+		deliveryId,
+	)
+	if err != nil {
+		return fmt.Errorf("record_attempt.update: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("record_attempt.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+const deliveryColumns = `
+	d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at, d.created_at,
+	a.attempted_at, a.status_code, a.error, a.duration_ms`
+
+// Scans a delivery joined with its last attempt, if any
+func scanDelivery(row interface{ Scan(...any) error }) (model.WebhookDelivery, error) {
+	d := model.WebhookDelivery{}
+	var payload string
+	var attemptedAt *time.Time
+	var statusCode *int
+	var errMsg *string
+	var duration *int64
+	err := row.Scan(
+		&d.ID, &d.WebhookID, &d.Event, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt, &d.CreatedAt,
+		&attemptedAt, &statusCode, &errMsg, &duration,
+	)
+	if err != nil {
+		return d, err
+	}
+
+	d.Payload = []byte(payload)
+	if attemptedAt != nil {
+		d.LastAttempt = &model.WebhookAttempt{AttemptedAt: *attemptedAt, StatusCode: statusCode}
+		if errMsg != nil {
+			d.LastAttempt.Error = *errMsg
+		}
+		if duration != nil {
+			d.LastAttempt.DurationMS = *duration
+		}
+	}
+	return d, nil
+}
+
+func (s *webhookStore) ListDeliveries(ctx context.Context, webhookId int, status string, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_delivery d
+		LEFT JOIN webhook_attempt a ON (a.id = (
+			SELECT MAX(id) FROM webhook_attempt WHERE delivery_id = d.id
+		))
+		WHERE d.webhook_id = ?
+			AND (? = '' OR d.status = ?)
+		ORDER BY d.id DESC
+		LIMIT ?`,
+		webhookId,
+		status,
+		status,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []model.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("get_deliveries.scan: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+func (s *webhookStore) GetDelivery(ctx context.Context, webhookId int, deliveryId int) (model.WebhookDelivery, error) {
+	d, err := scanDelivery(s.db.QueryRowContext(ctx, `
+		SELECT `+deliveryColumns+`
+		FROM webhook_delivery d
+		LEFT JOIN webhook_attempt a ON (a.id = (
+			SELECT MAX(id) FROM webhook_attempt WHERE delivery_id = d.id
+		))
+		WHERE d.webhook_id = ?
+			AND d.id = ?`,
+		webhookId,
+		deliveryId,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, ErrNotFound
+	}
+	if err != nil {
+		return d, fmt.Errorf("get_delivery: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT attempted_at, status_code, COALESCE(error, ''), duration_ms
+		FROM webhook_attempt
+		WHERE delivery_id = ?
+		ORDER BY id`,
+		deliveryId,
+	)
+	if err != nil {
+		return d, fmt.Errorf("get_delivery.attempts: %w", err)
+	}
+	defer rows.Close()
+
+	d.History = []model.WebhookAttempt{}
+	for rows.Next() {
+		a := model.WebhookAttempt{}
+		err = rows.Scan(&a.AttemptedAt, &a.StatusCode, &a.Error, &a.DurationMS)
+		if err != nil {
+			return d, fmt.Errorf("get_delivery.attempts.scan: %w", err)
+		}
+		d.History = append(d.History, a)
+	}
+	return d, rows.Err()
+}
+
+func (s *webhookStore) Redeliver(ctx context.Context, webhookId int, deliveryId int) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE webhook_delivery SET
+			status = ?,
+			attempts = 0,
+			next_attempt_at = ?
+		WHERE webhook_id = ?
+			AND id = ?`,
+		model.DeliveryPending,
+		textTime(time.Now()),
+		webhookId,
+		deliveryId,
+	)
+	if err != nil {
+		return fmt.Errorf("redeliver: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("redeliver.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+	return nil
+}
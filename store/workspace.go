@@ -0,0 +1,270 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/mbolis/quick-survey/model"
+)
+
+type workspaceStore struct {
+	db *sql.DB
+}
+
+// Creates a WorkspaceStore backed by the given SQLite DB.
+func NewWorkspaceStore(db *sql.DB) WorkspaceStore {
+	return &workspaceStore{db}
+}
+
+func (s *workspaceStore) Create(ctx context.Context, name string) (id int, err error) {
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO workspace (name, created_at)
+		VALUES (?, ?)
+		RETURNING id`,
+		name,
+		time.Now(),
+	).Scan(&id)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return 0, ErrConflict
+	}
+	if err != nil {
+		return 0, fmt.Errorf("insert_workspace: %w", err)
+	}
+	return id, nil
+}
+
+func (s *workspaceStore) Get(ctx context.Context, id int) (model.Workspace, error) {
+	ws := model.Workspace{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, name, created_at
+		FROM workspace
+		WHERE id = ?`,
+		id,
+	).Scan(&ws.ID, &ws.Name, &ws.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ws, ErrNotFound
+	}
+	if err != nil {
+		return ws, fmt.Errorf("get_workspace: %w", err)
+	}
+	return ws, nil
+}
+
+func (s *workspaceStore) List(ctx context.Context) ([]model.Workspace, error) {
+	return s.list(ctx, "get_workspaces", `
+		SELECT id, name, created_at, ''
+		FROM workspace
+		ORDER BY id`)
+}
+
+func (s *workspaceStore) ListFor(ctx context.Context, username string) ([]model.Workspace, error) {
+	return s.list(ctx, "get_user_workspaces", `
+		SELECT w.id, w.name, w.created_at, m.role
+		FROM workspace w
+		INNER JOIN workspace_member m ON (m.workspace_id = w.id)
+		WHERE m.username = ?
+		ORDER BY w.id`,
+		username,
+	)
+}
+
+func (s *workspaceStore) list(ctx context.Context, code string, query string, args ...any) ([]model.Workspace, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", code, err)
+	}
+	defer rows.Close()
+
+	workspaces := []model.Workspace{}
+	for rows.Next() {
+		ws := model.Workspace{}
+		err = rows.Scan(&ws.ID, &ws.Name, &ws.CreatedAt, &ws.Role)
+		if err != nil {
+			return nil, fmt.Errorf("%s.scan: %w", code, err)
+		}
+		workspaces = append(workspaces, ws)
+	}
+	return workspaces, rows.Err()
+}
+
+const memberColumns = `m.username, m.role, m.created_at, u.disabled_at IS NOT NULL`
+
+func (s *workspaceStore) ListMembers(ctx context.Context, id int) ([]model.Member, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+memberColumns+`
+		FROM workspace_member m
+		INNER JOIN user u ON (u.username = m.username)
+		WHERE m.workspace_id = ?
+		ORDER BY m.username`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get_members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []model.Member{}
+	for rows.Next() {
+		m := model.Member{}
+		err = rows.Scan(&m.Username, &m.Role, &m.CreatedAt, &m.Disabled)
+		if err != nil {
+			return nil, fmt.Errorf("get_members.scan: %w", err)
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+func (s *workspaceStore) GetMember(ctx context.Context, id int, username string) (model.Member, error) {
+	m := model.Member{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT `+memberColumns+`
+		FROM workspace_member m
+		INNER JOIN user u ON (u.username = m.username)
+		WHERE m.workspace_id = ?
+			AND m.username = ?`,
+		id,
+		username,
+	).Scan(&m.Username, &m.Role, &m.CreatedAt, &m.Disabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, ErrNotFound
+	}
+	if err != nil {
+		return m, fmt.Errorf("get_member: %w", err)
+	}
+	return m, nil
+}
+
+func (s *workspaceStore) AddMember(ctx context.Context, id int, username string, role string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO workspace_member (workspace_id, username, role, created_at)
+		VALUES (?, ?, ?, ?)`,
+		id,
+		username,
+		role,
+		time.Now(),
+	)
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		return ErrConflict
+	}
+	if isForeignKeyError(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("add_member: %w", err)
+	}
+	return nil
+}
+
+func (s *workspaceStore) SetMemberRole(ctx context.Context, id int, username string, role string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE workspace_member SET role = ?
+		WHERE workspace_id = ?
+			AND username = ?`,
+		role,
+		id,
+		username,
+	)
+	if err != nil {
+		return fmt.Errorf("set_member_role: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("set_member_role.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM token WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("set_member_role.tokens: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *workspaceStore) RemoveMember(ctx context.Context, id int, username string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin_tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	var owned int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM survey
+		WHERE workspace_id = ?
+			AND owner = ?`,
+		id,
+		username,
+	).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("remove_member.get_surveys: %w", err)
+	}
+	if owned > 0 {
+		return ErrConflict
+	}
+
+	steps := []struct{ code, query string }{
+		{"remove_member.shares", `
+			DELETE FROM survey_share
+			WHERE username = ?
+				AND survey_id IN (SELECT id FROM survey WHERE workspace_id = ?)`},
+		{"remove_member.groups", `
+			DELETE FROM user_group_member
+			WHERE username = ?
+				AND workspace_id = ?`},
+	}
+	for _, step := range steps {
+		_, err = tx.ExecContext(ctx, step.query, username, id)
+		if err != nil {
+			return fmt.Errorf("%s: %w", step.code, err)
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		DELETE FROM workspace_member
+		WHERE workspace_id = ?
+			AND username = ?`,
+		id,
+		username,
+	)
+	if err != nil {
+		return fmt.Errorf("remove_member: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("remove_member.verify: %w", err)
+	}
+	if n < 1 {
+		return ErrNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM token WHERE username = ?`, username)
+	if err != nil {
+		return fmt.Errorf("remove_member.tokens: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package validation
+
+import "github.com/mbolis/quick-survey/model"
+
+// Checks a survey share, returning the list of failures (empty if valid).
+func Share(share model.Share) Errors {
+	errs := Errors{}
+
+	if (share.Username == "") == (share.Group == "") {
+		errs.add("username", "exactly one of username or group must be given")
+	}
+
+	switch share.Access {
+	case model.AccessView, model.AccessEdit:
+	default:
+		errs.add("access", "must be %q or %q", model.AccessView, model.AccessEdit)
+	}
+
+	return errs
+}
+
+// Checks a group name, returning the list of failures (empty if valid).
+func GroupName(name string) Errors {
+	errs := Errors{}
+	if !reUsername.MatchString(name) {
+		errs.add("name", "must be 1 to 64 letters, digits or any of . _ @ -")
+	}
+	return errs
+}
@@ -0,0 +1,160 @@
+package validation
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+// Checks a submission against the survey it answers, returning the list of failures (empty if valid).
+// Accepted values are normalized in place, e.g. numeric strings are converted to numbers.
+func Submission(survey model.Survey, submission *model.Submission) Errors {
+	errs := Errors{}
+
+	fieldsById := map[int]model.SurveyField{}
+	for _, f := range survey.Fields {
+		fieldsById[f.ID] = f
+	}
+
+	keys := make([]string, 0, len(submission.Fields))
+	for key := range submission.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	answered := map[int]bool{}
+	for _, key := range keys {
+		sf := submission.Fields[key]
+		path := "fields." + key
+
+		// answers are keyed by the name of their field, which is how they are looked up later
+		f, ok := fieldsById[sf.ID]
+		if !ok || key != f.Name {
+			errs.add(path, "unknown field")
+			continue
+		}
+		if answered[f.ID] {
+			errs.add(path, "duplicate answer")
+			continue
+		}
+		answered[f.ID] = true
+
+		if isEmpty(sf.Value) {
+			if f.Required {
+				errs.add("fields."+f.Name, "required")
+			}
+			continue
+		}
+
+		value, err := FieldTypes[f.Type].normalize(f, sf.Value)
+		if err != nil {
+			errs.add("fields."+f.Name, "%s", err)
+			continue
+		}
+		sf.Value = value
+		submission.Fields[key] = sf
+	}
+
+	for _, f := range survey.Fields {
+		if f.Required && !answered[f.ID] {
+			errs.add("fields."+f.Name, "required")
+		}
+	}
+
+	return errs
+}
+
+// Checks a submission that answers a single question, as in live presentations.
+// Accepted values are normalized in place.
+func Answer(field model.SurveyField, submission *model.Submission) Errors {
+	errs := Errors{}
+
+	for key, sf := range submission.Fields {
+		if key != field.Name || sf.ID != field.ID {
+			errs.add("fields."+key, "unknown field")
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	sf, ok := submission.Fields[field.Name]
+	if !ok || isEmpty(sf.Value) {
+		errs.add("fields."+field.Name, "required")
+		return errs
+	}
+
+	value, err := FieldTypes[field.Type].normalize(field, sf.Value)
+	if err != nil {
+		errs.add("fields."+field.Name, "%s", err)
+		return errs
+	}
+	sf.Value = value
+	submission.Fields[field.Name] = sf
+	return errs
+}
+
+func isEmpty(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(v) == ""
+	}
+	return false
+}
+
+func (t FieldType) normalize(f model.SurveyField, value any) (any, error) {
+	if t.Normalize == nil {
+		return value, nil
+	}
+	return t.Normalize(f, value)
+}
+
+func normalizeText(_ model.SurveyField, value any) (any, error) {
+	if _, ok := value.(string); !ok {
+		return nil, errors.New("must be a string")
+	}
+	return value, nil
+}
+
+func normalizeNumber(_ model.SurveyField, value any) (any, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return nil, errors.New("must be a number")
+		}
+		return n, nil
+	}
+	return nil, errors.New("must be a number")
+}
+
+func normalizeCheckbox(f model.SurveyField, value any) (any, error) {
+	checked, ok := value.(bool)
+	if !ok {
+		return nil, errors.New("must be a boolean")
+	}
+	if f.Required && !checked {
+		return nil, errors.New("required")
+	}
+	return checked, nil
+}
+
+func normalizeSelect(f model.SurveyField, value any) (any, error) {
+	v, ok := value.(string)
+	if !ok {
+		return nil, errors.New("must be a string")
+	}
+	for _, o := range f.Options {
+		if o.Value == v {
+			return v, nil
+		}
+	}
+	return nil, errors.New("not one of the available options")
+}
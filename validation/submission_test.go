@@ -0,0 +1,87 @@
+package validation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+func TestSubmission(t *testing.T) {
+	survey := model.Survey{Fields: []model.SurveyField{
+		{ID: 1, Type: "text", Name: "name", Required: true},
+		{ID: 2, Type: "number", Name: "age"},
+		{ID: 3, Type: "select", Name: "color", Options: []model.FieldOption{{Value: "red"}, {Value: "blue"}}},
+	}}
+	tests := []struct {
+		name       string
+		fields     map[string]model.SubmissionField
+		wantErrs   string
+		wantValues map[string]any
+	}{
+		{
+			name: "valid",
+			fields: map[string]model.SubmissionField{
+				"name":  {ID: 1, Value: "Ada"},
+				"age":   {ID: 2, Value: " 36 "},
+				"color": {ID: 3, Value: "red"},
+			},
+			wantValues: map[string]any{"name": "Ada", "age": 36.0, "color": "red"},
+		},
+		{
+			name:     "missing required field",
+			fields:   map[string]model.SubmissionField{"age": {ID: 2, Value: 36.0}},
+			wantErrs: "fields.name: required",
+		},
+		{
+			name:     "blank required field",
+			fields:   map[string]model.SubmissionField{"name": {ID: 1, Value: "  "}},
+			wantErrs: "fields.name: required",
+		},
+		{
+			name: "unknown field",
+			fields: map[string]model.SubmissionField{
+				"name":  {ID: 1, Value: "Ada"},
+				"shape": {ID: 9, Value: "square"},
+			},
+			wantErrs: "fields.shape: unknown field",
+		},
+		{
+			name: "key other than the field name",
+			fields: map[string]model.SubmissionField{
+				"name": {ID: 1, Value: "Ada"},
+				"foo":  {ID: 2, Value: 36.0},
+			},
+			wantErrs: "fields.foo: unknown field",
+		},
+		{
+			name: "invalid values",
+			fields: map[string]model.SubmissionField{
+				"name":  {ID: 1, Value: 42.0},
+				"age":   {ID: 2, Value: "old"},
+				"color": {ID: 3, Value: "green"},
+			},
+			wantErrs: "fields.age: must be a number; fields.color: not one of the available options; fields.name: must be a string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			submission := model.Submission{Fields: tt.fields}
+			errs := Submission(survey, &submission)
+			if got := errs.Error(); got != tt.wantErrs {
+				t.Fatalf("errors = %q, want %q", got, tt.wantErrs)
+			}
+			if tt.wantValues == nil {
+				return
+			}
+
+			values := map[string]any{}
+			for key, f := range submission.Fields {
+				values[key] = f.Value
+			}
+			if !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("values = %v, want %v", values, tt.wantValues)
+			}
+		})
+	}
+}
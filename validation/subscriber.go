@@ -0,0 +1,28 @@
+package validation
+
+import (
+	"net/mail"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+const MaxEmailLength = 255
+
+// Checks a subscription to a survey, returning the list of failures (empty if valid).
+func Subscriber(sub model.Subscriber) Errors {
+	errs := Errors{}
+
+	if addr, err := mail.ParseAddress(sub.Email); err != nil || addr.Address != sub.Email {
+		errs.add("email", "must be a bare email address")
+	} else if len(sub.Email) > MaxEmailLength {
+		errs.add("email", "must be at most %d characters long", MaxEmailLength)
+	}
+
+	switch sub.Mode {
+	case model.SubscribeInstant, model.SubscribeDigest:
+	default:
+		errs.add("mode", "must be %q or %q", model.SubscribeInstant, model.SubscribeDigest)
+	}
+
+	return errs
+}
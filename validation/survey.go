@@ -0,0 +1,102 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mbolis/quick-survey/model"
+)
+
+const (
+	MaxTitleLength = 255
+	MaxLabelLength = 255
+)
+
+type FieldType struct {
+	// Whether the field declares a list of options to choose from
+	HasOptions bool
+	// Checks a non-empty submitted value, returning it in canonical form
+	Normalize func(f model.SurveyField, value any) (any, error)
+}
+
+// Registry of the known survey field types
+var FieldTypes = map[string]FieldType{
+	"text":     {Normalize: normalizeText},
+	"number":   {Normalize: normalizeNumber},
+	"checkbox": {Normalize: normalizeCheckbox},
+	"textarea": {Normalize: normalizeText},
+	"select":   {HasOptions: true, Normalize: normalizeSelect},
+}
+
+// Checks a survey definition, returning the list of failures (empty if valid).
+func Survey(survey model.Survey) Errors {
+	errs := Errors{}
+
+	checkText(&errs, "title", survey.Title, MaxTitleLength)
+
+	switch survey.DedupePolicy {
+	case "", model.DedupeNone, model.DedupeIP, model.DedupeCookie, model.DedupeInvite, model.DedupeUser:
+	default:
+		errs.add("dedupe_policy", "unknown dedupe policy %q", survey.DedupePolicy)
+	}
+
+	switch survey.PrivacyMode {
+	case "", model.PrivacyFull, model.PrivacyTruncated, model.PrivacyHashed:
+	default:
+		errs.add("privacy_mode", "unknown privacy mode %q", survey.PrivacyMode)
+	}
+
+	if survey.OpenAt != nil && survey.CloseAt != nil && !survey.CloseAt.After(*survey.OpenAt) {
+		errs.add("close_at", "must be after open_at")
+	}
+
+	for i, f := range survey.Fields {
+		path := fmt.Sprintf("fields[%d]", i)
+
+		checkText(&errs, path+".label", f.Label, MaxLabelLength)
+
+		fieldType, ok := FieldTypes[f.Type]
+		if !ok {
+			errs.add(path+".type", "unknown field type %q", f.Type)
+			continue
+		}
+
+		if fieldType.HasOptions {
+			checkOptions(&errs, path+".options", f.Options)
+		} else if len(f.Options) > 0 {
+			errs.add(path+".options", "not allowed for field type %q", f.Type)
+		}
+	}
+
+	return errs
+}
+
+func checkText(errs *Errors, path string, value string, maxLength int) {
+	if strings.TrimSpace(value) == "" {
+		errs.add(path, "must not be empty")
+	} else if utf8.RuneCountInString(value) > maxLength {
+		errs.add(path, "must be at most %d characters long", maxLength)
+	}
+}
+
+func checkOptions(errs *Errors, path string, options []model.FieldOption) {
+	if len(options) == 0 {
+		errs.add(path, "must not be empty")
+		return
+	}
+
+	values := map[string]bool{}
+	for i, o := range options {
+		optPath := fmt.Sprintf("%s[%d]", path, i)
+
+		checkText(errs, optPath+".label", o.Label, MaxLabelLength)
+
+		if o.Value == "" {
+			errs.add(optPath+".value", "must not be empty")
+		} else if values[o.Value] {
+			errs.add(optPath+".value", "duplicate value %q", o.Value)
+		}
+		values[o.Value] = true
+	}
+}
@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mbolis/quick-survey/auth"
+)
+
+const (
+	MinPasswordLength = 8
+	// bcrypt ignores anything longer
+	MaxPasswordBytes = 72
+)
+
+var reUsername = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// Checks a user name, returning the list of failures (empty if valid).
+func Username(username string) Errors {
+	errs := Errors{}
+	if !reUsername.MatchString(username) {
+		errs.add("username", "must be 1 to 64 letters, digits or any of . _ @ -")
+	}
+	return errs
+}
+
+// Checks a new password, returning the list of failures (empty if valid).
+func Password(password string) Errors {
+	errs := Errors{}
+	if utf8.RuneCountInString(password) < MinPasswordLength {
+		errs.add("password", "must be at least %d characters long", MinPasswordLength)
+	} else if len(password) > MaxPasswordBytes {
+		errs.add("password", "must be at most %d bytes long", MaxPasswordBytes)
+	}
+	return errs
+}
+
+// Checks a user role, returning the list of failures (empty if valid).
+func Role(role string) Errors {
+	errs := Errors{}
+	if !auth.IsRole(role) {
+		errs.add("role", "must be one of %s", strings.Join(auth.Roles, ", "))
+	}
+	return errs
+}
@@ -0,0 +1,27 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A single validation failure, located by the path of the offending value
+type Error struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// A list of validation failures
+type Errors []Error
+
+func (errs Errors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Path + ": " + e.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (errs *Errors) add(path string, msg string, args ...any) {
+	*errs = append(*errs, Error{path, fmt.Sprintf(msg, args...)})
+}
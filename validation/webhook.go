@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/webhooks"
+)
+
+const MaxURLLength = 2048
+
+// Checks a webhook definition, returning the list of failures (empty if valid).
+func Webhook(webhook model.Webhook) Errors {
+	errs := Errors{}
+
+	if u, err := url.Parse(webhook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		errs.add("url", "must be an absolute http or https URL")
+	} else if !allowedHost(u.Hostname()) {
+		errs.add("url", "must not point to a loopback or link-local address")
+	} else if len(webhook.URL) > MaxURLLength {
+		errs.add("url", "must be at most %d characters long", MaxURLLength)
+	}
+
+	if len(webhook.Events) == 0 {
+		errs.add("events", "must not be empty")
+	}
+	seen := map[string]bool{}
+	for i, e := range webhook.Events {
+		if seen[e] {
+			errs.add(fmt.Sprintf("events[%d]", i), "duplicate event %q", e)
+		} else if !webhooks.IsEvent(e) {
+			errs.add(fmt.Sprintf("events[%d]", i), "unknown event %q", e)
+		}
+		seen[e] = true
+	}
+
+	return errs
+}
+
+// Tells whether the host may be the target of webhooks, as far as can be told without resolving it
+func allowedHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return webhooks.AllowedAddr(addr)
+	}
+	return true
+}
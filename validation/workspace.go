@@ -0,0 +1,14 @@
+package validation
+
+import "unicode/utf8"
+
+const MaxWorkspaceNameLength = 255
+
+// Checks a workspace name, returning the list of failures (empty if valid).
+func WorkspaceName(name string) Errors {
+	errs := Errors{}
+	if n := utf8.RuneCountInString(name); n == 0 || n > MaxWorkspaceNameLength {
+		errs.add("name", "must be 1 to %d characters long", MaxWorkspaceNameLength)
+	}
+	return errs
+}
@@ -0,0 +1,225 @@
+// Package webhooks delivers survey events to external HTTP endpoints,
+// from a persistent queue with retries.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/mbolis/quick-survey/events"
+	"github.com/mbolis/quick-survey/log"
+	"github.com/mbolis/quick-survey/model"
+	"github.com/mbolis/quick-survey/queue"
+	"github.com/mbolis/quick-survey/store"
+)
+
+// Event types that webhooks may subscribe to
+var Events = []string{
+	events.SubmissionCreated,
+	events.SurveyPublished,
+	events.SurveyClosed,
+	events.SurveyArchived,
+}
+
+// Request headers sent with each delivery
+const (
+	HeaderEvent     = "X-QuickSurvey-Event"
+	HeaderDelivery  = "X-QuickSurvey-Delivery"
+	HeaderSignature = "X-QuickSurvey-Signature"
+)
+
+const (
+	// Attempts before a delivery is given up as dead
+	MaxAttempts = 10
+
+	requestTimeout = 10 * time.Second
+)
+
+// Delays between delivery attempts
+var Backoff = queue.Backoff{Base: 30 * time.Second, Max: 6 * time.Hour}
+
+// Body of a delivery request
+type Payload struct {
+	Event    string    `json:"event"`
+	SurveyID int       `json:"survey_id"`
+	Time     time.Time `json:"time"`
+	Data     any       `json:"data"`
+}
+
+// Signs a payload with the webhook secret, as sent in the signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Tells whether deliveries may be sent to the address:
+// loopback, link-local and unspecified ones are refused, not to expose services of the host itself
+func AllowedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsUnspecified()
+}
+
+// Refuses connections to addresses that are not allowed, whatever the host name resolved to
+func checkDialAddr(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !AllowedAddr(addrPort.Addr()) {
+		return fmt.Errorf("address not allowed: %s", addrPort.Addr())
+	}
+	return nil
+}
+
+// Queues events for delivery and delivers them in the background
+type Dispatcher struct {
+	*queue.Worker
+	store  store.WebhookStore
+	client *http.Client
+}
+
+func NewDispatcher(s store.WebhookStore) *Dispatcher {
+	d := &Dispatcher{
+		store: s,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			// no proxy: deliveries go straight to their target, so that its address can be checked
+			Transport: &http.Transport{
+				DialContext: (&net.Dialer{Timeout: requestTimeout, Control: checkDialAddr}).DialContext,
+			},
+		},
+	}
+	d.Worker = queue.NewWorker(d.deliverDue)
+	return d
+}
+
+// Queues an event about a survey for every webhook subscribed to it.
+// It is meant to be called once the change is committed: failures are only logged,
+// and delivery happens in the background
+func (d *Dispatcher) Enqueue(surveyId int, e events.Event) {
+	if !IsEvent(e.Type) {
+		return
+	}
+
+	body, err := json.Marshal(Payload{Event: e.Type, SurveyID: surveyId, Time: time.Now(), Data: e.Data})
+	if err != nil {
+		log.Errorf("webhooks.enqueue.marshal: %s", err)
+		return
+	}
+
+	ctx, cancel := queue.EnqueueContext()
+	defer cancel()
+
+	n, err := d.store.Enqueue(ctx, surveyId, e.Type, body)
+	if err != nil {
+		log.Errorf("webhooks.enqueue: %s", err)
+		return
+	}
+	if n > 0 {
+		d.Notify()
+	}
+}
+
+// Tells whether webhooks may subscribe to the event type
+func IsEvent(eventType string) bool {
+	for _, t := range Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Attempts up to limit due deliveries, returning how many there were
+func (d *Dispatcher) deliverDue(ctx context.Context, limit int) int {
+	due, err := d.store.Due(ctx, time.Now(), limit)
+	if err != nil {
+		log.Errorf("webhooks.get_due: %s", err)
+		return 0
+	}
+
+	for _, delivery := range due {
+		d.deliver(ctx, delivery)
+	}
+	return len(due)
+}
+
+// Attempts a delivery and records its outcome, scheduling a retry on failure
+func (d *Dispatcher) deliver(ctx context.Context, delivery model.WebhookDelivery) {
+	start := time.Now()
+	statusCode, err := d.send(ctx, delivery)
+	if ctx.Err() != nil {
+		// shutting down: the delivery stays due
+		return
+	}
+
+	attempt := model.WebhookAttempt{
+		AttemptedAt: start,
+		DurationMS:  time.Since(start).Milliseconds(),
+	}
+	if statusCode != 0 {
+		attempt.StatusCode = &statusCode
+	}
+
+	status, next := model.DeliveryDelivered, time.Now()
+	if err != nil {
+		attempt.Error = err.Error()
+		attempts := delivery.Attempts + 1
+		if attempts >= MaxAttempts {
+			status = model.DeliveryDead
+			log.Warnf("webhooks.deliver.dead: delivery %d to webhook %d: %s", delivery.ID, delivery.WebhookID, err)
+		} else {
+			status, next = model.DeliveryPending, next.Add(Backoff.Delay(attempts))
+			log.Debugf("webhooks.deliver: delivery %d to webhook %d: %s", delivery.ID, delivery.WebhookID, err)
+		}
+	}
+
+	err = d.store.RecordAttempt(ctx, delivery.ID, attempt, status, next)
+	if err != nil {
+		log.Errorf("webhooks.record_attempt: %s", err)
+	}
+}
+
+// Sends the payload, returning the response status if one was received
+func (d *Dispatcher) send(ctx context.Context, delivery model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("user-agent", "quick-survey-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.Itoa(delivery.ID))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drain a little, so that the connection may be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}